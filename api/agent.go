@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// defaultSessionTitle é usado ao criar uma sessão a partir do primeiro prompt;
+// o agente gera um título definitivo em segundo plano.
+const defaultSessionTitle = "Nova sessão"
+
+// SendPrompt envia um prompt ao agente da sessão junto com o arquivo atual e os anexos
+// (veja PromptContext). Se sessionID estiver vazio uma nova sessão é criada.
+// Retorna o ID da sessão usada. A resposta chega ao frontend em
+// streaming pelos eventos EventMessage e EventAgent; se a sessão estiver ocupada
+// o prompt é enfileirado e executado ao final da requisição atual.
+func (a *App) SendPrompt(sessionID, text string) (string, error) {
+	// Prompts enfileirados não levam anexos; nesse caso eles ficam para o próximo envio.
+	queued := a.IsSessionBusy(sessionID)
+	_, attachments := a.buildPromptContext()
+	sessionID, err := a.startPrompt(sessionID, text, attachments...)
+	if err != nil {
+		return "", err
+	}
+	// Os anexos são enviados uma única vez; o arquivo atual acompanha todo prompt.
+	if !queued {
+		clear(a.attachedFiles)
+	}
+	a.currentSession = sessionID
+	return sessionID, nil
+}
+
+// startPrompt envia o prompt ao agente da sessão (veja SetSessionAgent),
+// criando uma sessão com o coder se sessionID estiver vazio, e retorna o ID da
+// sessão usada.
+func (a *App) startPrompt(sessionID, text string, attachments ...message.Attachment) (string, error) {
+	if a.coderAgent == nil {
+		return "", fmt.Errorf("agente não configurado")
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("o prompt não pode ser vazio")
+	}
+
+	if sessionID == "" {
+		sess, err := a.sessions.Create(a.ctx, defaultSessionTitle)
+		if err != nil {
+			return "", fmt.Errorf("erro ao criar a sessão: %w", err)
+		}
+		sessionID = sess.ID
+	}
+
+	ag, err := a.sessionAgent(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := ag.Run(a.ctx, sessionID, text, attachments...); err != nil {
+		return "", fmt.Errorf("erro ao enviar o prompt: %w", err)
+	}
+	return sessionID, nil
+}
+
+// CancelPrompt cancela a requisição em andamento na sessão e descarta a fila.
+// Vale para todos os agentes, pois o agente da sessão pode ter sido trocado
+// durante a requisição.
+func (a *App) CancelPrompt(sessionID string) {
+	for _, ag := range a.allAgents() {
+		ag.Cancel(sessionID)
+	}
+}
+
+// QueuedPrompts retorna quantos prompts aguardam na fila da sessão.
+func (a *App) QueuedPrompts(sessionID string) int {
+	n := 0
+	for _, ag := range a.allAgents() {
+		n += ag.QueuedPrompts(sessionID)
+	}
+	return n
+}
+
+// IsSessionBusy informa se algum agente está processando um prompt na sessão.
+func (a *App) IsSessionBusy(sessionID string) bool {
+	return slices.ContainsFunc(a.allAgents(), func(ag agent.Service) bool {
+		return ag.IsSessionBusy(sessionID)
+	})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+)
+
+// ErrAgentNotFound é retornado quando um ID não corresponde a nenhum agente.
+var ErrAgentNotFound = errors.New("agente não encontrado")
+
+// AgentInfo descreve um agente que pode responder às sessões: o coder ou um
+// agente definido pelo usuário em "agents" no crush.json.
+type AgentInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Model       string `json:"model"` // large ou small
+}
+
+func newAgentInfo(cfg config.Agent) AgentInfo {
+	return AgentInfo{
+		ID:          cfg.ID,
+		Name:        cfg.Name,
+		Description: cfg.Description,
+		Model:       string(cfg.Model),
+	}
+}
+
+// setupAgents cria os agentes definidos pelo usuário. Um agente com erro na
+// configuração é ignorado para não impedir o uso dos demais.
+func (a *App) setupAgents() {
+	a.agents = make(map[string]agent.Service)
+	for _, agentCfg := range a.config.CustomAgents() {
+		ag, err := agent.NewAgent(a.ctx, agentCfg, a.permissions, a.sessions, a.messages, a.files, a.lspClients)
+		if err != nil {
+			slog.Error("Failed to create agent", "agent", agentCfg.ID, "error", err)
+			continue
+		}
+		a.agents[agentCfg.ID] = ag
+	}
+}
+
+// allAgents retorna o coder seguido dos agentes definidos pelo usuário.
+func (a *App) allAgents() []agent.Service {
+	if a.coderAgent == nil {
+		return nil
+	}
+	agents := []agent.Service{a.coderAgent}
+	for _, agentCfg := range a.config.CustomAgents() {
+		if ag, ok := a.agents[agentCfg.ID]; ok {
+			agents = append(agents, ag)
+		}
+	}
+	return agents
+}
+
+// agentByID retorna o agente com o ID informado; vazio é o coder.
+func (a *App) agentByID(id string) (agent.Service, error) {
+	if a.coderAgent == nil {
+		return nil, fmt.Errorf("agente não configurado")
+	}
+	if id == "" || id == "coder" {
+		return a.coderAgent, nil
+	}
+	ag, ok := a.agents[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	return ag, nil
+}
+
+// sessionAgent retorna o agente escolhido para a sessão.
+func (a *App) sessionAgent(sessionID string) (agent.Service, error) {
+	if a.coderAgent == nil {
+		return nil, fmt.Errorf("agente não configurado")
+	}
+	sess, err := a.sessions.Get(a.ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar a sessão %s: %w", sessionID, err)
+	}
+	return a.agentByID(sess.AgentID)
+}
+
+// ListAgents retorna os agentes que podem ser escolhidos para uma sessão: o
+// coder e, em ordem de ID, os agentes definidos pelo usuário. Os agentes
+// definidos pelo usuário também podem ser chamados pelo coder como
+// sub-agentes, pela ferramenta agent.
+func (a *App) ListAgents() []AgentInfo {
+	infos := []AgentInfo{newAgentInfo(a.config.Agents["coder"])}
+	for _, agentCfg := range a.config.CustomAgents() {
+		if _, ok := a.agents[agentCfg.ID]; ok {
+			infos = append(infos, newAgentInfo(agentCfg))
+		}
+	}
+	return infos
+}
+
+// SetSessionAgent escolhe o agente que responde aos próximos prompts da
+// sessão. agentID vazio ou "coder" volta ao coder.
+func (a *App) SetSessionAgent(sessionID, agentID string) (SessionInfo, error) {
+	if agentID == "coder" {
+		agentID = ""
+	}
+	if _, err := a.agentByID(agentID); err != nil {
+		return SessionInfo{}, err
+	}
+	if a.IsSessionBusy(sessionID) {
+		return SessionInfo{}, fmt.Errorf("a sessão %s está ocupada; aguarde o fim da requisição atual", sessionID)
+	}
+	sess, err := a.sessions.Get(a.ctx, sessionID)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao carregar a sessão %s: %w", sessionID, err)
+	}
+	sess.AgentID = agentID
+	sess, err = a.sessions.Save(a.ctx, sess)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao salvar a sessão %s: %w", sessionID, err)
+	}
+	return newSessionInfo(sess), nil
+}
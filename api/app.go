@@ -2,24 +2,30 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/upperxcode/jx2ai-agent/api/internal/config"
 	"github.com/upperxcode/jx2ai-agent/api/internal/csync"
 	"github.com/upperxcode/jx2ai-agent/api/internal/db"
 	"github.com/upperxcode/jx2ai-agent/api/internal/env"
+	"github.com/upperxcode/jx2ai-agent/api/internal/fsext"
 	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
 	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
 	"github.com/upperxcode/jx2ai-agent/api/internal/lsp"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
 	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
 )
 
 // FileInfo representa a informação de um arquivo ou diretório para o frontend.
@@ -45,6 +51,7 @@ func Config() (*config.Config, error) {
 type CommandInfo struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Usage       string `json:"usage"`
 }
 
 // UIState representa o estado atual da interface que o backend gerencia.
@@ -52,18 +59,27 @@ type UIState struct {
 	CurrentFile   string   `json:"currentFile"`   // O arquivo atualmente em foco.
 	AttachedFiles []string `json:"attachedFiles"` // Lista de arquivos anexados para contexto.
 	ViewContent   string   `json:"viewContent"`   // Conteúdo para ser exibido diretamente (usado pelo comando /view).
+	ContextTokens int      `json:"contextTokens"` // Estimativa de tokens do arquivo atual e dos anexos no próximo prompt.
 }
 
 // App struct
 type App struct {
-	ctx           context.Context
-	currentFile   string
-	attachedFiles map[string]bool // Usando um map para facilitar a adição/remoção e evitar duplicatas
-	toolbelt      map[string]tools.BaseTool
-	config        *config.Config
-	lspClients    *csync.Map[string, *lsp.Client]
-	permissions   permission.Service
-	files         history.Service
+	ctx            context.Context
+	currentFile    string
+	currentSession string          // Sessão aberta na UI, usada pelos comandos.
+	attachedFiles  map[string]bool // Usando um map para facilitar a adição/remoção e evitar duplicatas
+	toolbelt       map[string]tools.BaseTool
+	config         *config.Config
+	lspClients     *csync.Map[string, *lsp.Client]
+	permissions    permission.Service
+	files          history.Service
+	sessions       session.Service
+	messages       message.Service
+	coderAgent     agent.Service
+	agents         map[string]agent.Service // Agentes definidos pelo usuário, por ID.
+
+	eventsCancel context.CancelFunc
+	eventsWG     sync.WaitGroup
 }
 
 // NewApp creates a new App application struct
@@ -102,7 +118,16 @@ func NewAppWithServices(ctx context.Context) (*App, error) {
 	if err != nil {
 		return nil, fmt.Errorf("erro ao obter o diretório de trabalho: %w", err)
 	}
+	// Ferramentas somente leitura da UI nunca pedem permissão; as demais
+	// seguem a configuração e, fora da lista, abrem o diálogo no frontend.
+	// A lista vale só dentro do diretório de trabalho: acessos fora dele
+	// sempre pedem permissão com a política "ask".
 	allowed := []string{tools.ViewToolName, tools.CurrentFileToolName}
+	skipRequests := false
+	if cfg.Permissions != nil {
+		allowed = append(allowed, cfg.Permissions.AllowedTools...)
+		skipRequests = cfg.Permissions.SkipRequests
+	}
 
 	conn, err := db.Connect(ctx, cfg.Options.DataDirectory)
 	if err != nil {
@@ -116,8 +141,10 @@ func NewAppWithServices(ctx context.Context) (*App, error) {
 		config:        cfg,
 		attachedFiles: make(map[string]bool),
 		lspClients:    csync.NewMap[string, *lsp.Client](),
-		permissions:   permission.NewPermissionService(wd, true, allowed),
+		permissions:   permission.NewPermissionService(wd, skipRequests, allowed),
 		files:         history.NewService(q, conn),
+		sessions:      session.NewService(q),
+		messages:      message.NewService(q, conn),
 	}
 
 	// Inicializa os clientes LSP
@@ -128,7 +155,7 @@ func NewAppWithServices(ctx context.Context) (*App, error) {
 		}
 		client, err := lsp.New(ctx, name, lspConfig, config.NewEnvironmentVariableResolver(env.New()))
 		if err != nil {
-			if exec.IsNotFound(err) {
+			if errors.Is(err, exec.ErrNotFound) {
 				slog.Warn("LSP server command not found", "server", name, "command", lspConfig.Command)
 				continue
 			}
@@ -143,6 +170,20 @@ func NewAppWithServices(ctx context.Context) (*App, error) {
 		tools.ViewToolName:        tools.NewViewTool(app.lspClients, app.permissions, wd),
 		tools.WriteToolName:       tools.NewWriteTool(app.lspClients, app.permissions, app.files, wd),
 	}
+
+	if cfg.IsConfigured() {
+		coderCfg := cfg.Agents["coder"]
+		if coderCfg.ID == "" {
+			return nil, fmt.Errorf("configuração do agente coder ausente")
+		}
+		app.coderAgent, err = agent.NewAgent(ctx, coderCfg, app.permissions, app.sessions, app.messages, app.files, app.lspClients)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao criar o agente coder: %w", err)
+		}
+		app.setupAgents()
+	} else {
+		slog.Warn("No agent configuration found")
+	}
 	return app, nil
 }
 
@@ -150,6 +191,35 @@ func NewAppWithServices(ctx context.Context) (*App, error) {
 // so we can call the runtime methods
 func (a *App) Startup(ctx context.Context) {
 	a.ctx = ctx
+	if a.messages != nil {
+		a.setupEvents(ctx)
+	}
+}
+
+// Shutdown é chamado quando a aplicação é encerrada. Cancela as requisições
+// em andamento, encerra os clientes LSP e para o encaminhamento de eventos.
+func (a *App) Shutdown(ctx context.Context) {
+	if a.coderAgent != nil {
+		for _, ag := range a.allAgents() {
+			ag.CancelAll()
+		}
+		if err := agent.CloseMCPClients(); err != nil {
+			slog.Error("Failed to close MCP clients", "error", err)
+		}
+	}
+
+	for name, client := range a.lspClients.Seq2() {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := client.Close(shutdownCtx); err != nil {
+			slog.Error("Failed to shutdown LSP client", "name", name, "error", err)
+		}
+		cancel()
+	}
+
+	if a.eventsCancel != nil {
+		a.eventsCancel()
+		a.eventsWG.Wait()
+	}
 }
 
 // Greet returns a greeting for the given name
@@ -157,20 +227,45 @@ func (a *App) Greet(name string) string {
 	return fmt.Sprintf("Hello %s, It's show time!", name)
 }
 
-// ListCommands retorna a lista de comandos disponíveis para o frontend.
-// Isso simula a leitura dos arquivos de descrição das ferramentas.
+// ListCommands retorna a lista de comandos disponíveis para o frontend:
+// as ferramentas da toolbelt e as ferramentas dos servidores MCP.
 func (a *App) ListCommands() []CommandInfo {
 	var commands []CommandInfo
-	for _, tool := range a.toolbelt {
+	for _, tool := range a.commandTools() {
 		info := tool.Info()
-		commands = append(commands, CommandInfo{Name: info.Name, Description: info.Description})
+		commands = append(commands, CommandInfo{
+			Name:        info.Name,
+			Description: info.Description,
+			Usage:       tools.CommandUsage(info),
+		})
 	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
 	return commands
 }
 
+// commandTools retorna as ferramentas que podem ser invocadas como comandos.
+func (a *App) commandTools() map[string]tools.BaseTool {
+	all := make(map[string]tools.BaseTool, len(a.toolbelt))
+	for name, tool := range a.toolbelt {
+		all[name] = tool
+	}
+	// As ferramentas MCP pedem permissão, então só existem com os serviços inicializados.
+	if a.permissions != nil {
+		for _, tool := range agent.GetMCPTools(a.ctx, a.permissions, a.config) {
+			all[tool.Name()] = tool
+		}
+	}
+	return all
+}
+
 // ExecuteCommand recebe uma string de comando do frontend, a processa e retorna o novo estado da UI.
+// Os argumentos são convertidos para o input JSON da ferramenta a partir do schema de
+// parâmetros dela (veja tools.BuildCommandInput). "/comando --help" retorna o uso do comando.
 func (a *App) ExecuteCommand(commandString string) (UIState, error) {
-	parts := strings.Fields(strings.TrimPrefix(commandString, "/"))
+	parts, err := tools.SplitCommandLine(strings.TrimPrefix(strings.TrimSpace(commandString), "/"))
+	if err != nil {
+		return UIState{}, fmt.Errorf("comando inválido: %w", err)
+	}
 	if len(parts) == 0 {
 		return UIState{}, fmt.Errorf("comando inválido")
 	}
@@ -178,41 +273,29 @@ func (a *App) ExecuteCommand(commandString string) (UIState, error) {
 	command := parts[0]
 	args := parts[1:]
 
-	tool, ok := a.toolbelt[command]
+	tool, ok := a.commandTools()[command]
 	if !ok {
 		return UIState{}, fmt.Errorf("comando desconhecido: %s", command)
 	}
+	info := tool.Info()
+
+	if len(args) == 1 && (args[0] == "--help" || args[0] == "-h") {
+		uiState := a.getCurrentUIState()
+		uiState.ViewContent = tools.CommandUsage(info)
+		return uiState, nil
+	}
 
 	// Constrói o input para a ferramenta
-	var input string
-	switch command {
-	case tools.AttachToolName:
-		if len(args) >= 2 {
-			input = fmt.Sprintf(`{"sub_command": %s, "file_path": %s}`, strconv.Quote(args[0]), strconv.Quote(args[1]))
-		} else {
-			return UIState{}, fmt.Errorf("o comando 'attach' requer um subcomando (add/delete) e um caminho de arquivo")
-		}
-	case tools.CurrentFileToolName:
-		if len(args) >= 1 {
-			input = fmt.Sprintf(`{"file_path": %s}`, strconv.Quote(args[0]))
-		} else {
-			return UIState{}, fmt.Errorf("o comando 'currentfile' requer um caminho de arquivo")
-		}
-	case tools.WriteToolName:
-		if len(args) >= 1 {
-			input = fmt.Sprintf(`{"file_path": %s, "content": %s}`, strconv.Quote(args[0]), strconv.Quote(strings.Join(args[1:], " ")))
-		} else {
-			return UIState{}, fmt.Errorf("o comando 'write' requer um caminho de arquivo")
-		}
-	case tools.ViewToolName:
-		if len(args) >= 1 {
-			input = fmt.Sprintf(`{"file_path": %s}`, strconv.Quote(args[0]))
-		} else {
-			return UIState{}, fmt.Errorf("o comando 'view' requer um caminho de arquivo")
-		}
+	input, err := tools.BuildCommandInput(info, args)
+	if err != nil {
+		return UIState{}, fmt.Errorf("argumentos inválidos para o comando %s: %w\n\nUso: %s", command, err, tools.CommandUsage(info))
 	}
 
-	response, err := tool.Run(a.ctx, tools.ToolCall{Input: input})
+	response, err := tool.Run(a.commandContext(), tools.ToolCall{
+		ID:    uuid.NewString(),
+		Name:  info.Name,
+		Input: input,
+	})
 	if err != nil {
 		return UIState{}, fmt.Errorf("erro ao executar o comando %s: %w", command, err)
 	}
@@ -224,6 +307,19 @@ func (a *App) ExecuteCommand(commandString string) (UIState, error) {
 	return uiState, nil
 }
 
+// commandContext retorna o contexto de execução dos comandos da UI. As ferramentas que
+// registram histórico ou pedem permissão exigem uma sessão; usa a sessão aberta na UI e
+// um ID de mensagem novo, ao qual as versões de arquivo do comando ficam associadas.
+func (a *App) commandContext() context.Context {
+	if a.currentSession == "" {
+		return a.ctx
+	}
+	messageID := uuid.NewString()
+	ctx := context.WithValue(a.ctx, tools.SessionIDContextKey, a.currentSession)
+	ctx = context.WithValue(ctx, tools.MessageIDContextKey, messageID)
+	return history.WithMessageID(ctx, messageID)
+}
+
 // getCurrentUIState coleta o estado atual e o prepara para ser enviado ao frontend.
 func (a *App) getCurrentUIState() UIState {
 	// Converte o map de arquivos anexados em uma lista de strings
@@ -239,10 +335,13 @@ func (a *App) getCurrentUIState() UIState {
 		currentFileDisplay = a.currentFile
 	}
 
+	pc, _ := a.buildPromptContext()
+
 	return UIState{
 		CurrentFile:   currentFileDisplay,
 		AttachedFiles: attached,
 		ViewContent:   "",
+		ContextTokens: pc.TotalTokens,
 	}
 }
 
@@ -261,36 +360,48 @@ func (a *App) DetachFile(file string) {
 	delete(a.attachedFiles, file)
 }
 
-// LspClients retorna nil, pois a App da UI não gerencia clientes LSP.
+// LspClients retorna os clientes LSP abertos para o workspace, usados pelas ferramentas.
 func (a *App) LspClients() *csync.Map[string, *lsp.Client] {
 	return a.lspClients
 }
 
-// Permissions retorna nil, pois a App da UI não gerencia permissões de ferramentas.
+// Permissions retorna o serviço que decide e registra as permissões das ferramentas.
 func (a *App) Permissions() permission.Service {
 	return a.permissions
 }
 
-// Files retorna nil, pois a App da UI não gerencia o histórico de arquivos.
+// Files retorna o histórico das versões dos arquivos alterados nas sessões.
 func (a *App) Files() history.Service {
 	return a.files
 }
 
+// resolvePath resolve um caminho da UI dentro do workspace. A UI não abre
+// diálogos de permissão, então caminhos fora da raiz só são aceitos quando a
+// política configurada é "allow".
+func (a *App) resolvePath(path string) (string, error) {
+	ws, err := a.config.Workspace()
+	if err != nil {
+		return "", fmt.Errorf("erro ao abrir o workspace: %w", err)
+	}
+	fullPath, ask, err := ws.Check(path)
+	if err != nil {
+		return "", fmt.Errorf("caminho inválido '%s': %w", path, err)
+	}
+	if ask {
+		return "", fmt.Errorf("caminho inválido '%s': %w", path, fsext.ErrOutsideWorkspace)
+	}
+	return fullPath, nil
+}
+
 // ListDirectory retorna uma lista de arquivos e diretórios para um dado caminho.
 // A lista é ordenada alfabeticamente, com arquivos primeiro e depois diretórios.
 func (a *App) ListDirectory(path string) ([]FileInfo, error) {
-	// Medida de segurança: normaliza o caminho para evitar ataques de "path traversal"
-	cleanPath := filepath.Clean(path)
-
-	// Obtém o diretório de trabalho atual como base
-	cwd, err := os.Getwd()
+	// Medida de segurança: resolve o caminho no workspace para evitar "path traversal" e symlinks para fora
+	fullPath, err := a.resolvePath(path)
 	if err != nil {
-		return nil, fmt.Errorf("erro ao obter o diretório de trabalho: %w", err)
+		return nil, err
 	}
 
-	// Constrói o caminho completo e seguro
-	fullPath := filepath.Join(cwd, cleanPath)
-
 	entries, err := os.ReadDir(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao ler o diretório '%s': %w", fullPath, err)
@@ -317,18 +428,12 @@ func (a *App) ListDirectory(path string) ([]FileInfo, error) {
 
 // ReadFile lê o conteúdo de um arquivo e o retorna como uma string.
 func (a *App) ReadFile(path string) (string, error) {
-	// Medida de segurança: normaliza o caminho para evitar ataques de "path traversal"
-	cleanPath := filepath.Clean(path)
-
-	// Obtém o diretório de trabalho atual como base
-	cwd, err := os.Getwd()
+	// Medida de segurança: resolve o caminho no workspace para evitar "path traversal" e symlinks para fora
+	fullPath, err := a.resolvePath(path)
 	if err != nil {
-		return "", fmt.Errorf("erro ao obter o diretório de trabalho: %w", err)
+		return "", err
 	}
 
-	// Constrói o caminho completo e seguro
-	fullPath := filepath.Join(cwd, cleanPath)
-
 	content, err := os.ReadFile(fullPath)
 	if err != nil {
 		return "", fmt.Errorf("erro ao ler o arquivo '%s': %w", fullPath, err)
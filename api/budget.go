@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+)
+
+// BudgetInfo são os limites de custo (em USD) e de tokens das sessões e dos
+// prompts. Zero significa sem limite. Os gastos dos sub-agentes contam para a
+// sessão e o prompt que os iniciaram.
+type BudgetInfo struct {
+	SessionCost   float64 `json:"sessionCost"`
+	SessionTokens int64   `json:"sessionTokens"`
+	PromptCost    float64 `json:"promptCost"`
+	PromptTokens  int64   `json:"promptTokens"`
+	WarnAt        float64 `json:"warnAt"` // Fração de um limite que gera o aviso (evento "warning").
+}
+
+// Budget retorna os limites de gastos em uso.
+func (a *App) Budget() BudgetInfo {
+	b := a.config.Options.Budget
+	return BudgetInfo{
+		SessionCost:   b.SessionCost,
+		SessionTokens: b.SessionTokens,
+		PromptCost:    b.PromptCost,
+		PromptTokens:  b.PromptTokens,
+		WarnAt:        b.WarnAt,
+	}
+}
+
+// SetBudget altera os limites de gastos e os grava na configuração. Os novos
+// limites valem a partir do próximo prompt.
+func (a *App) SetBudget(b BudgetInfo) error {
+	if b.SessionCost < 0 || b.SessionTokens < 0 || b.PromptCost < 0 || b.PromptTokens < 0 {
+		return fmt.Errorf("os limites não podem ser negativos")
+	}
+	if b.WarnAt <= 0 || b.WarnAt > 1 {
+		return fmt.Errorf("o aviso deve estar entre 0 e 1 do limite")
+	}
+	budget := config.Budget{
+		SessionCost:   b.SessionCost,
+		SessionTokens: b.SessionTokens,
+		PromptCost:    b.PromptCost,
+		PromptTokens:  b.PromptTokens,
+		WarnAt:        b.WarnAt,
+	}
+	if err := a.config.SetConfigField("options.budget", budget); err != nil {
+		return fmt.Errorf("erro ao salvar o orçamento: %w", err)
+	}
+	a.config.Options.Budget = budget
+	return nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/diff"
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// Checkpoint é o estado dos arquivos ao final de uma resposta do agente. O ID
+// do checkpoint é o ID da mensagem do assistente.
+type Checkpoint struct {
+	MessageID string   `json:"messageId"`
+	CreatedAt int64    `json:"createdAt"`
+	Files     []string `json:"files"` // Arquivos alterados pelas ferramentas nesta resposta.
+}
+
+// CheckpointChange é a mudança que restaurar um checkpoint faz em um arquivo.
+type CheckpointChange struct {
+	Path      string `json:"path"`
+	Diff      string `json:"diff"` // Diff unificado do conteúdo atual para o do checkpoint.
+	Additions int    `json:"additions"`
+	Removals  int    `json:"removals"`
+	Removed   bool   `json:"removed"`  // O arquivo não existia no checkpoint e será removido.
+	Conflict  bool   `json:"conflict"` // O arquivo foi alterado desde a última versão registrada.
+}
+
+// ListCheckpoints retorna os checkpoints da sessão, um por resposta do agente,
+// do mais antigo para o mais recente.
+func (a *App) ListCheckpoints(sessionID string) ([]Checkpoint, error) {
+	msgs, err := a.messages.List(a.ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar as mensagens da sessão %s: %w", sessionID, err)
+	}
+	files, err := a.files.ListBySession(a.ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar o histórico de arquivos da sessão %s: %w", sessionID, err)
+	}
+	touched := make(map[string][]string)
+	for _, f := range files {
+		if f.MessageID == "" || f.IsRestore() || slices.Contains(touched[f.MessageID], f.Path) {
+			continue
+		}
+		touched[f.MessageID] = append(touched[f.MessageID], f.Path)
+	}
+
+	checkpoints := []Checkpoint{}
+	for _, msg := range msgs {
+		if msg.Role != message.Assistant {
+			continue
+		}
+		paths := touched[msg.ID]
+		if paths == nil {
+			paths = []string{}
+		}
+		checkpoints = append(checkpoints, Checkpoint{
+			MessageID: msg.ID,
+			CreatedAt: msg.CreatedAt,
+			Files:     paths,
+		})
+	}
+	return checkpoints, nil
+}
+
+// PreviewCheckpoint mostra o que RestoreCheckpoint mudaria nos arquivos, sem
+// alterá-los.
+func (a *App) PreviewCheckpoint(sessionID, messageID string) ([]CheckpointChange, error) {
+	reverts, err := a.planRestore(sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	changes := []CheckpointChange{}
+	for _, r := range reverts {
+		current, exists, err := readCurrent(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists && r.Created {
+			continue
+		}
+		unified, additions, removals := diff.GenerateDiff(current, r.Before, r.Path)
+		changes = append(changes, CheckpointChange{
+			Path:      r.Path,
+			Diff:      unified,
+			Additions: additions,
+			Removals:  removals,
+			Removed:   r.Created,
+			Conflict:  current != r.After,
+		})
+	}
+	return changes, nil
+}
+
+// RestoreCheckpoint devolve os arquivos ao estado do checkpoint, sem mudar as
+// mensagens. Arquivos alterados desde a última versão registrada são
+// conflitos e só são sobrescritos com overwrite.
+func (a *App) RestoreCheckpoint(sessionID, messageID string, overwrite bool) (RevertResult, error) {
+	if a.IsSessionBusy(sessionID) {
+		return RevertResult{}, fmt.Errorf("a sessão %s está ocupada; cancele a requisição antes de restaurar", sessionID)
+	}
+	reverts, err := a.planRestore(sessionID, messageID)
+	if err != nil {
+		return RevertResult{}, err
+	}
+	result, err := revertFiles(reverts, overwrite)
+	if err != nil {
+		return result, err
+	}
+	// Registra o conteúdo restaurado para que as próximas restaurações saibam
+	// o que os arquivos devem ter.
+	ctx := history.WithMessageID(a.ctx, history.RestoreMessageID(messageID))
+	for _, r := range reverts {
+		if !slices.Contains(result.Reverted, r.Path) {
+			continue
+		}
+		var err error
+		if r.Created {
+			_, err = a.files.CreateMissing(ctx, sessionID, r.Path)
+		} else {
+			_, err = a.files.CreateVersion(ctx, sessionID, r.Path, r.Before)
+		}
+		if err != nil {
+			return result, fmt.Errorf("erro ao registrar a versão restaurada de '%s': %w", r.Path, err)
+		}
+	}
+	return result, nil
+}
+
+func (a *App) planRestore(sessionID, messageID string) ([]history.Revert, error) {
+	msgs, err := a.messages.List(a.ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar as mensagens da sessão %s: %w", sessionID, err)
+	}
+	order := make([]string, len(msgs))
+	found := false
+	for i, msg := range msgs {
+		order[i] = msg.ID
+		found = found || (msg.ID == messageID && msg.Role == message.Assistant)
+	}
+	if !found {
+		return nil, fmt.Errorf("checkpoint %s não encontrado na sessão %s: %w", messageID, sessionID, sql.ErrNoRows)
+	}
+	files, err := a.files.ListBySession(a.ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao carregar o histórico de arquivos da sessão %s: %w", sessionID, err)
+	}
+	return history.PlanRestore(files, order, messageID), nil
+}
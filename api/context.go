@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+const (
+	// defaultContextBudget é o orçamento de tokens dos arquivos de contexto quando
+	// não há modelo configurado para obter a janela de contexto.
+	defaultContextBudget = 32_000
+	// maxContextBudget limita o orçamento mesmo em modelos com janelas enormes.
+	maxContextBudget = 100_000
+	// maxImageBytes é o tamanho máximo de uma imagem anexada.
+	maxImageBytes = 5 * 1024 * 1024
+	// truncatedMarker é adicionado ao fim de um arquivo de texto cortado pelo orçamento.
+	truncatedMarker = "\n[... conteúdo truncado para caber no orçamento de contexto ...]"
+)
+
+// ContextFile descreve como um arquivo anexado (ou o arquivo atual) será enviado ao agente.
+type ContextFile struct {
+	Path      string `json:"path"`
+	Kind      string `json:"kind"` // text, image ou skipped
+	Tokens    int    `json:"tokens"`
+	Truncated bool   `json:"truncated"`
+	Reason    string `json:"reason,omitempty"` // Motivo quando o arquivo é ignorado.
+}
+
+// PromptContext é a estimativa do custo dos arquivos de contexto do próximo prompt.
+type PromptContext struct {
+	Files       []ContextFile `json:"files"`
+	TotalTokens int           `json:"totalTokens"`
+	Budget      int           `json:"budget"`
+}
+
+// estimateTokens usa a aproximação usual de ~4 caracteres por token.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// estimateImageTokens segue a fórmula de largura*altura/750 usada pelos provedores,
+// limitada ao tamanho em que as imagens costumam ser redimensionadas.
+func estimateImageTokens(data []byte) int {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 1600
+	}
+	return min(max(cfg.Width*cfg.Height/750, 85), 1600)
+}
+
+// contextBudget retorna o orçamento de tokens para os arquivos de contexto:
+// um quarto da janela de contexto do modelo atual.
+func (a *App) contextBudget() int {
+	if a.coderAgent == nil || a.coderAgent.Model().ContextWindow == 0 {
+		return defaultContextBudget
+	}
+	return min(int(a.coderAgent.Model().ContextWindow/4), maxContextBudget)
+}
+
+func (a *App) supportsImages() bool {
+	return a.coderAgent != nil && a.coderAgent.Model().SupportsImages
+}
+
+// contextPaths retorna o arquivo atual seguido dos anexos, sem duplicatas.
+func (a *App) contextPaths() []string {
+	var paths []string
+	if a.currentFile != "" {
+		paths = append(paths, a.currentFile)
+	}
+	attached := make([]string, 0, len(a.attachedFiles))
+	for file := range a.attachedFiles {
+		attached = append(attached, file)
+	}
+	sort.Strings(attached)
+	for _, file := range attached {
+		if !slices.Contains(paths, file) {
+			paths = append(paths, file)
+		}
+	}
+	return paths
+}
+
+// buildPromptContext lê o arquivo atual e os anexos e os converte em anexos do
+// prompt: arquivos de texto viram blocos de texto limitados pelo orçamento e
+// imagens viram conteúdo binário.
+func (a *App) buildPromptContext() (PromptContext, []message.Attachment) {
+	budget := a.contextBudget()
+	pc := PromptContext{Files: []ContextFile{}, Budget: budget}
+	var attachments []message.Attachment
+
+	for _, path := range a.contextPaths() {
+		file := ContextFile{Path: path}
+		fullPath, err := a.resolvePath(path)
+		if err != nil {
+			file.Kind = "skipped"
+			file.Reason = err.Error()
+			pc.Files = append(pc.Files, file)
+			continue
+		}
+
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			file.Kind = "skipped"
+			file.Reason = fmt.Sprintf("erro ao ler o arquivo: %v", err)
+			pc.Files = append(pc.Files, file)
+			continue
+		}
+
+		mimeType := http.DetectContentType(content)
+		switch {
+		case strings.HasPrefix(mimeType, "image/"):
+			file.Kind = "image"
+			switch {
+			case !a.supportsImages():
+				file.Kind = "skipped"
+				file.Reason = "o modelo atual não suporta imagens"
+			case len(content) > maxImageBytes:
+				file.Kind = "skipped"
+				file.Reason = fmt.Sprintf("imagem maior que %d MB", maxImageBytes/1024/1024)
+			default:
+				file.Tokens = estimateImageTokens(content)
+				attachments = append(attachments, message.Attachment{
+					FilePath: path,
+					FileName: filepath.Base(path),
+					MimeType: mimeType,
+					Content:  content,
+				})
+			}
+		case strings.HasPrefix(mimeType, "text/") && utf8.Valid(content):
+			file.Kind = "text"
+			text := string(content)
+			remaining := budget - pc.TotalTokens
+			if estimateTokens(text) > remaining {
+				// Um arquivo cortado precisa de espaço para o aviso e para
+				// algum conteúdo; sem isso, seria enviado só o aviso.
+				available := remaining - estimateTokens(truncatedMarker)
+				if available <= 0 {
+					file.Kind = "skipped"
+					file.Reason = "orçamento de contexto esgotado"
+					break
+				}
+				text = truncateToTokens(text, available) + truncatedMarker
+				file.Truncated = true
+			}
+			file.Tokens = estimateTokens(text)
+			attachments = append(attachments, message.Attachment{
+				FilePath: path,
+				FileName: filepath.Base(path),
+				MimeType: "text/plain",
+				Content:  []byte(text),
+			})
+		default:
+			file.Kind = "skipped"
+			file.Reason = fmt.Sprintf("tipo de arquivo não suportado: %s", mimeType)
+		}
+		pc.TotalTokens += file.Tokens
+		pc.Files = append(pc.Files, file)
+	}
+	return pc, attachments
+}
+
+// truncateToTokens corta o texto para caber em tokens, preferindo terminar numa quebra de linha.
+func truncateToTokens(text string, tokens int) string {
+	limit := max(tokens, 0) * 4
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndexByte(cut, '\n'); i > 0 {
+		cut = cut[:i]
+	}
+	return cut
+}
+
+// PromptContext retorna a estimativa de tokens dos arquivos que serão enviados
+// com o próximo prompt, para o frontend exibir antes do envio.
+func (a *App) PromptContext() PromptContext {
+	pc, _ := a.buildPromptContext()
+	return pc
+}
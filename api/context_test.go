@@ -0,0 +1,104 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+)
+
+func TestTruncateToTokens(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "short", truncateToTokens("short", 10))
+	require.Equal(t, "abcdefgh", truncateToTokens("abcdefghijkl", 2))
+	// The cut prefers to end at a line break.
+	require.Equal(t, "one\ntwo", truncateToTokens("one\ntwo\nthree", 3))
+	require.Empty(t, truncateToTokens("abcdefgh", 0))
+	require.Empty(t, truncateToTokens("abcdefgh", -1))
+}
+
+func TestBuildPromptContext(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cfg, err := config.Load(dir, t.TempDir(), false)
+	require.NoError(t, err)
+	a := newTestApp(t)
+	a.config = cfg
+
+	write := func(name string, content []byte) string {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0o644))
+		return name
+	}
+	// Text files of an exact number of tokens, one per line.
+	text := func(tokens int) []byte {
+		return []byte(strings.Repeat("abc\n", tokens))
+	}
+	marker := estimateTokens(truncatedMarker)
+
+	t.Run("budget accounting", func(t *testing.T) {
+		a.currentFile = write("current.go", text(defaultContextBudget-100))
+		a.attachedFiles = map[string]bool{
+			write("a.txt", text(1000)):                               true,
+			write("b.txt", text(10)):                                 true,
+			write("c.png", []byte("\x89PNG\r\n\x1a\n"+"not really")): true,
+			write("d.bin", []byte{0, 1, 2, 3}):                       true,
+			"../outside.txt":                                         true,
+		}
+
+		pc, attachments := a.buildPromptContext()
+		require.Equal(t, defaultContextBudget, pc.Budget)
+		require.Len(t, pc.Files, 6)
+		byPath := make(map[string]ContextFile)
+		for _, f := range pc.Files {
+			byPath[f.Path] = f
+		}
+
+		require.Equal(t, "current.go", pc.Files[0].Path, "the current file comes first")
+		require.Equal(t, ContextFile{Path: "current.go", Kind: "text", Tokens: defaultContextBudget - 100}, byPath["current.go"])
+
+		truncated := byPath["a.txt"]
+		require.Equal(t, "text", truncated.Kind)
+		require.True(t, truncated.Truncated)
+		require.LessOrEqual(t, truncated.Tokens, 100)
+		require.Greater(t, truncated.Tokens, marker)
+
+		// What is left can't hold the marker and some content.
+		require.Equal(t, ContextFile{Path: "b.txt", Kind: "skipped", Reason: "orçamento de contexto esgotado"}, byPath["b.txt"])
+
+		require.Equal(t, "skipped", byPath["c.png"].Kind)
+		require.Equal(t, "o modelo atual não suporta imagens", byPath["c.png"].Reason)
+		require.Equal(t, "skipped", byPath["d.bin"].Kind)
+		require.Contains(t, byPath["d.bin"].Reason, "tipo de arquivo não suportado")
+		require.Equal(t, "skipped", byPath["../outside.txt"].Kind)
+
+		require.Equal(t, defaultContextBudget-100+truncated.Tokens, pc.TotalTokens)
+		require.LessOrEqual(t, pc.TotalTokens, pc.Budget)
+		require.Len(t, attachments, 2)
+		require.Equal(t, "current.go", attachments[0].FilePath)
+		require.True(t, strings.HasSuffix(string(attachments[1].Content), truncatedMarker))
+		require.Equal(t, truncated.Tokens, estimateTokens(string(attachments[1].Content)))
+	})
+
+	t.Run("remaining budget smaller than the marker", func(t *testing.T) {
+		a.currentFile = write("current.go", text(defaultContextBudget-marker+1))
+		a.attachedFiles = map[string]bool{write("b.txt", text(marker)): true}
+
+		pc, attachments := a.buildPromptContext()
+		require.Equal(t, ContextFile{Path: "b.txt", Kind: "skipped", Reason: "orçamento de contexto esgotado"}, pc.Files[1])
+		require.Len(t, attachments, 1)
+	})
+
+	t.Run("file that fits the remaining budget", func(t *testing.T) {
+		a.currentFile = write("current.go", text(defaultContextBudget-10))
+		a.attachedFiles = map[string]bool{write("b.txt", text(10)): true}
+
+		pc, attachments := a.buildPromptContext()
+		require.Equal(t, ContextFile{Path: "b.txt", Kind: "text", Tokens: 10}, pc.Files[1])
+		require.Equal(t, defaultContextBudget, pc.TotalTokens)
+		require.Len(t, attachments, 2)
+	})
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+	"github.com/upperxcode/jx2ai-agent/api/internal/pubsub"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Nomes dos eventos Wails emitidos para o frontend.
+const (
+	EventMessage = "message" // Payload: MessageEvent
+	EventAgent   = "agent"   // Payload: AgentEvent
+	EventSession = "session" // Payload: SessionEvent
+
+	EventPermission             = "permission"              // Payload: PermissionInfo
+	EventPermissionNotification = "permission-notification" // Payload: PermissionNotification
+)
+
+// MessageInfo é a representação de uma mensagem enviada ao frontend.
+// O conteúdo é sempre o estado acumulado da mensagem; a cada atualização
+// o frontend substitui a versão anterior pelo ID.
+type MessageInfo struct {
+	ID           string               `json:"id"`
+	SessionID    string               `json:"sessionId"`
+	Role         string               `json:"role"`
+	Content      string               `json:"content"`
+	Thinking     string               `json:"thinking"`
+	IsThinking   bool                 `json:"isThinking"`
+	ToolCalls    []message.ToolCall   `json:"toolCalls"`
+	ToolResults  []message.ToolResult `json:"toolResults"`
+	Finished     bool                 `json:"finished"`
+	FinishReason string               `json:"finishReason"`
+	FinishNotice string               `json:"finishNotice"` // Mensagem para o usuário quando o agente parou antes do fim.
+	Model        string               `json:"model"`
+	Provider     string               `json:"provider"`
+	CreatedAt    int64                `json:"createdAt"`
+	UpdatedAt    int64                `json:"updatedAt"`
+}
+
+// MessageEvent é o payload do evento EventMessage.
+type MessageEvent struct {
+	Type    string      `json:"type"` // created, updated ou deleted
+	Message MessageInfo `json:"message"`
+}
+
+// AgentEvent é o payload do evento EventAgent.
+type AgentEvent struct {
+	Type      string       `json:"type"` // error, response, summarize ou warning
+	SessionID string       `json:"sessionId"`
+	Message   *MessageInfo `json:"message,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Warning   string       `json:"warning,omitempty"`
+	Progress  string       `json:"progress,omitempty"`
+	Done      bool         `json:"done"`
+}
+
+func newMessageInfo(msg message.Message) MessageInfo {
+	info := MessageInfo{
+		ID:           msg.ID,
+		SessionID:    msg.SessionID,
+		Role:         string(msg.Role),
+		Content:      msg.Content().String(),
+		Thinking:     msg.ReasoningContent().String(),
+		IsThinking:   msg.IsThinking(),
+		ToolCalls:    msg.ToolCalls(),
+		ToolResults:  msg.ToolResults(),
+		Finished:     msg.IsFinished(),
+		FinishReason: string(msg.FinishReason()),
+		Model:        msg.Model,
+		Provider:     msg.Provider,
+		CreatedAt:    msg.CreatedAt,
+		UpdatedAt:    msg.UpdatedAt,
+	}
+	if finish := msg.FinishPart(); finish != nil {
+		info.FinishNotice = finish.Message
+	}
+	return info
+}
+
+func newAgentEvent(ev agent.AgentEvent) AgentEvent {
+	out := AgentEvent{
+		Type:      string(ev.Type),
+		SessionID: ev.SessionID,
+		Warning:   ev.Warning,
+		Progress:  ev.Progress,
+		Done:      ev.Done,
+	}
+	if ev.Message.ID != "" {
+		info := newMessageInfo(ev.Message)
+		out.Message = &info
+		if out.SessionID == "" {
+			out.SessionID = ev.Message.SessionID
+		}
+	}
+	if ev.Error != nil {
+		out.Error = ev.Error.Error()
+	}
+	return out
+}
+
+// forwardEvents assina um broker e repassa cada evento, convertido por
+// convert, para emit com o nome informado.
+func forwardEvents[T any](
+	ctx context.Context,
+	wg *sync.WaitGroup,
+	name string,
+	subscriber func(context.Context) <-chan pubsub.Event[T],
+	convert func(pubsub.Event[T]) any,
+	emit func(name string, data any),
+) {
+	wg.Go(func() {
+		subCh := subscriber(ctx)
+		for {
+			select {
+			case event, ok := <-subCh:
+				if !ok {
+					slog.Debug("subscription channel closed", "name", name)
+					return
+				}
+				emit(name, convert(event))
+			case <-ctx.Done():
+				slog.Debug("subscription cancelled", "name", name)
+				return
+			}
+		}
+	})
+}
+
+// subscribeEvents assina os streams dos serviços e repassa cada evento, com os
+// nomes e payloads do frontend, para emit até ctx ser cancelado. É o ponto de
+// fan-out compartilhado pela janela do Wails e pelos clientes do servidor.
+func (a *App) subscribeEvents(ctx context.Context, wg *sync.WaitGroup, emit func(name string, data any)) {
+	forwardEvents(ctx, wg, EventMessage, a.messages.Subscribe, func(e pubsub.Event[message.Message]) any {
+		return MessageEvent{Type: string(e.Type), Message: newMessageInfo(e.Payload)}
+	}, emit)
+	forwardEvents(ctx, wg, EventSession, a.sessions.Subscribe, func(e pubsub.Event[session.Session]) any {
+		return SessionEvent{Type: string(e.Type), Session: newSessionInfo(e.Payload)}
+	}, emit)
+	forwardEvents(ctx, wg, EventPermission, a.permissions.Subscribe, func(e pubsub.Event[permission.PermissionRequest]) any {
+		return newPermissionInfo(e.Payload)
+	}, emit)
+	forwardEvents(ctx, wg, EventPermissionNotification, a.permissions.SubscribeNotifications, func(e pubsub.Event[permission.PermissionNotification]) any {
+		return PermissionNotification{
+			ToolCallID: e.Payload.ToolCallID,
+			Granted:    e.Payload.Granted,
+			Denied:     e.Payload.Denied,
+		}
+	}, emit)
+	for _, ag := range a.allAgents() {
+		forwardEvents(ctx, wg, EventAgent, ag.Subscribe, func(e pubsub.Event[agent.AgentEvent]) any {
+			return newAgentEvent(e.Payload)
+		}, emit)
+	}
+}
+
+// setupEvents começa a encaminhar os eventos dos serviços para o frontend.
+// Deve ser chamado com o contexto recebido em Startup, que carrega o runtime do Wails.
+func (a *App) setupEvents(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	a.eventsCancel = cancel
+	a.subscribeEvents(ctx, &a.eventsWG, func(name string, data any) {
+		runtime.EventsEmit(ctx, name, data)
+	})
+}
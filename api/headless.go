@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+// Códigos de saída do modo headless.
+const (
+	ExitOK               = 0
+	ExitError            = 1   // Erro do agente, do provedor ou da configuração.
+	ExitUsage            = 2   // Argumentos inválidos.
+	ExitPermissionDenied = 3   // O agente parou porque uma permissão foi negada.
+	ExitStopped          = 4   // O agente foi interrompido pelo limite de turnos, por chamadas repetidas ou pelo orçamento.
+	ExitCanceled         = 130 // Interrompido (SIGINT) antes de terminar.
+)
+
+// Formatos de saída do modo headless.
+const (
+	FormatText = "text" // Apenas o texto da resposta, em streaming.
+	FormatJSON = "json" // Um evento JSON por linha.
+)
+
+// Políticas de permissão do modo headless, onde não há ninguém para responder aos pedidos.
+const (
+	// PermissionsDeny nega todo pedido que não esteja em permissions.allowed_tools.
+	PermissionsDeny = "deny"
+	// PermissionsAllow aprova todos os pedidos.
+	PermissionsAllow = "allow"
+)
+
+// eventResult é o último evento da saída JSON do modo headless.
+const eventResult = "result"
+
+// HeadlessOptions configura uma execução sem interface gráfica.
+type HeadlessOptions struct {
+	Prompt      string
+	Format      string // FormatText ou FormatJSON
+	Permissions string // PermissionsDeny ou PermissionsAllow
+	Agent       string // ID do agente que executa o prompt; vazio é o coder.
+	Output      io.Writer
+}
+
+// HeadlessEvent é uma linha da saída JSON. Name e Data são os mesmos nomes e
+// payloads dos eventos enviados ao frontend; a execução termina com um evento
+// "result" cujo payload é HeadlessResult.
+type HeadlessEvent struct {
+	Name string `json:"event"`
+	Data any    `json:"data"`
+}
+
+// HeadlessResult resume uma execução headless.
+type HeadlessResult struct {
+	SessionID        string  `json:"sessionId"`
+	Content          string  `json:"content"`
+	FinishReason     string  `json:"finishReason"`
+	Error            string  `json:"error,omitempty"`
+	ExitCode         int     `json:"exitCode"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// ValidateHeadlessOptions verifica o formato e a política de permissões.
+func ValidateHeadlessOptions(opts HeadlessOptions) error {
+	if strings.TrimSpace(opts.Prompt) == "" {
+		return fmt.Errorf("o prompt não pode ser vazio")
+	}
+	switch opts.Format {
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("formato de saída inválido %q: use %s ou %s", opts.Format, FormatText, FormatJSON)
+	}
+	switch opts.Permissions {
+	case PermissionsDeny, PermissionsAllow:
+	default:
+		return fmt.Errorf("política de permissões inválida %q: use %s ou %s", opts.Permissions, PermissionsDeny, PermissionsAllow)
+	}
+	return nil
+}
+
+// headlessRun guarda o estado de uma execução headless.
+type headlessRun struct {
+	opts      HeadlessOptions
+	enc       *json.Encoder
+	sessionID string
+	written   map[string]int // Bytes do conteúdo de cada mensagem já escritos na saída de texto.
+}
+
+func (r *headlessRun) emit(name string, data any) {
+	if err := r.enc.Encode(HeadlessEvent{Name: name, Data: data}); err != nil {
+		slog.Error("Failed to write headless event", "event", name, "error", err)
+	}
+}
+
+// writeText escreve a parte ainda não escrita do conteúdo de uma mensagem do assistente.
+func (r *headlessRun) writeText(msg message.Message) {
+	content := msg.Content().String()
+	if len(content) <= r.written[msg.ID] {
+		return
+	}
+	fmt.Fprint(r.opts.Output, content[r.written[msg.ID]:])
+	r.written[msg.ID] = len(content)
+}
+
+// RunHeadless executa um prompt com o agente de opts.Agent sem interface gráfica,
+// escrevendo a resposta em opts.Output, e retorna o código de saída do processo.
+// Pedidos de permissão são resolvidos pela política de opts.Permissions.
+// Cancelar ctx interrompe o agente e retorna ExitCanceled.
+func (a *App) RunHeadless(ctx context.Context, opts HeadlessOptions) (int, error) {
+	if err := ValidateHeadlessOptions(opts); err != nil {
+		return ExitUsage, err
+	}
+	ag, err := a.agentByID(opts.Agent)
+	if err != nil {
+		return ExitError, err
+	}
+	slog.Info("Running in headless mode", "format", opts.Format, "permissions", opts.Permissions, "agent", opts.Agent)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	run := &headlessRun{
+		opts:    opts,
+		enc:     json.NewEncoder(opts.Output),
+		written: make(map[string]int),
+	}
+
+	// As assinaturas são feitas antes de iniciar o agente para não perder eventos.
+	messageEvents := a.messages.Subscribe(ctx)
+	permissionEvents := a.permissions.Subscribe(ctx)
+	if opts.Permissions == PermissionsAllow {
+		// Também vale para as sessões das tarefas criadas por sub-agentes.
+		a.permissions.SetSkipRequests(true)
+	}
+
+	const maxTitleLength = 100
+	title := strings.Join(strings.Fields(opts.Prompt), " ")
+	if len([]rune(title)) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength]) + "..."
+	}
+	sess, err := a.sessions.Create(ctx, "Headless: "+title)
+	if err != nil {
+		return ExitError, fmt.Errorf("erro ao criar a sessão: %w", err)
+	}
+	if opts.Agent != "" && opts.Agent != "coder" {
+		sess.AgentID = opts.Agent
+		if sess, err = a.sessions.Save(ctx, sess); err != nil {
+			return ExitError, fmt.Errorf("erro ao salvar a sessão: %w", err)
+		}
+	}
+	run.sessionID = sess.ID
+	if opts.Format == FormatJSON {
+		run.emit(EventSession, SessionEvent{Type: "created", Session: newSessionInfo(sess)})
+	}
+
+	done, err := ag.Run(ctx, sess.ID, opts.Prompt)
+	if err != nil {
+		return ExitError, fmt.Errorf("erro ao enviar o prompt: %w", err)
+	}
+
+	for {
+		select {
+		case event, ok := <-messageEvents:
+			if !ok {
+				messageEvents = nil
+				continue
+			}
+			msg := event.Payload
+			switch {
+			case opts.Format == FormatJSON:
+				run.emit(EventMessage, MessageEvent{Type: string(event.Type), Message: newMessageInfo(msg)})
+			case msg.SessionID == sess.ID && msg.Role == message.Assistant:
+				run.writeText(msg)
+			}
+
+		case event, ok := <-permissionEvents:
+			if !ok {
+				permissionEvents = nil
+				continue
+			}
+			req := event.Payload
+			if opts.Format == FormatJSON {
+				run.emit(EventPermission, newPermissionInfo(req))
+			}
+			// Com PermissionsAllow só chegam aqui os acessos fora do diretório
+			// de trabalho, que sempre pedem permissão com a política "ask".
+			slog.Warn("Permission denied in headless mode", "tool", req.ToolName, "action", req.Action, "path", req.Path)
+			a.permissions.Deny(req)
+
+		case result := <-done:
+			return a.finishHeadless(run, result)
+
+		case <-ctx.Done():
+			ag.Cancel(sess.ID)
+			// Aguarda o agente registrar o cancelamento na sessão.
+			return a.finishHeadless(run, <-done)
+		}
+	}
+}
+
+// finishHeadless escreve o resultado final e calcula o código de saída.
+func (a *App) finishHeadless(run *headlessRun, result agent.AgentEvent) (int, error) {
+	res := HeadlessResult{
+		SessionID:    run.sessionID,
+		Content:      result.Message.Content().String(),
+		FinishReason: string(result.Message.FinishReason()),
+		ExitCode:     ExitOK,
+	}
+	var runErr error
+	switch {
+	case result.Error != nil && (errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, agent.ErrRequestCancelled)):
+		res.ExitCode = ExitCanceled
+		res.FinishReason = string(message.FinishReasonCanceled)
+		runErr = result.Error
+	case errors.Is(result.Error, agent.ErrBudgetExceeded):
+		res.ExitCode = ExitStopped
+		res.FinishReason = string(message.FinishReasonBudgetExceeded)
+		runErr = result.Error
+	case result.Error != nil:
+		res.ExitCode = ExitError
+		res.FinishReason = string(message.FinishReasonError)
+		runErr = result.Error
+	case result.Message.FinishReason() == message.FinishReasonPermissionDenied:
+		res.ExitCode = ExitPermissionDenied
+		runErr = permission.ErrorPermissionDenied
+	case result.Message.FinishReason() == message.FinishReasonMaxTurns,
+		result.Message.FinishReason() == message.FinishReasonToolLoop,
+		result.Message.FinishReason() == message.FinishReasonBudgetExceeded:
+		res.ExitCode = ExitStopped
+		runErr = errors.New(result.Message.FinishPart().Message)
+	}
+	if runErr != nil {
+		res.Error = runErr.Error()
+	}
+
+	if sess, err := a.sessions.Get(context.Background(), run.sessionID); err == nil {
+		res.PromptTokens = sess.PromptTokens
+		res.CompletionTokens = sess.CompletionTokens
+		res.Cost = sess.Cost
+	}
+
+	if run.opts.Format == FormatJSON {
+		run.emit(eventResult, res)
+	} else {
+		if result.Message.ID != "" {
+			run.writeText(result.Message)
+		}
+		fmt.Fprintln(run.opts.Output)
+	}
+	return res.ExitCode, runErr
+}
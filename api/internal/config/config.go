@@ -1,6 +1,7 @@
 package config
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/upperxcode/jx2ai-agent/api/internal/csync"
 	"github.com/upperxcode/jx2ai-agent/api/internal/env"
+	"github.com/upperxcode/jx2ai-agent/api/internal/fsext"
 
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
 	"github.com/tidwall/sjson"
@@ -21,6 +23,21 @@ import (
 const (
 	appName              = "crush"
 	defaultDataDirectory = ".crush"
+
+	// defaultAutoSummarizeThreshold is the fraction of the model's context
+	// window that triggers automatic summarization.
+	defaultAutoSummarizeThreshold = 0.8
+	// defaultMaxTurns is how many model turns a single prompt may take.
+	defaultMaxTurns = 50
+	// defaultMaxRepeatedToolCalls is how many times in a row a prompt may make
+	// the same tool call with the same input.
+	defaultMaxRepeatedToolCalls = 3
+	// defaultBudgetWarnAt is the fraction of a budget limit that publishes a
+	// warning.
+	defaultBudgetWarnAt = 0.8
+	// defaultCassetteFile is the cassette in the data directory used when no
+	// path is given.
+	defaultCassetteFile = "cassette.jsonl"
 )
 
 var defaultContextPaths = []string{
@@ -63,8 +80,12 @@ type SelectedModel struct {
 	// Overrides the default model configuration.
 	MaxTokens int64 `json:"max_tokens,omitempty" jsonschema:"description=Maximum number of tokens for model responses,minimum=1,maximum=200000,example=4096"`
 
-	// Used by anthropic models that can reason to indicate if the model should think.
-	Think bool `json:"think,omitempty" jsonschema:"description=Enable thinking mode for Anthropic models that support reasoning"`
+	// Used by anthropic and ollama models that can reason to indicate if the model should think.
+	Think bool `json:"think,omitempty" jsonschema:"description=Enable thinking mode for Anthropic and Ollama models that support reasoning"`
+
+	// Models tried in order when this one can't answer: it is rate limited,
+	// overloaded or failing. Their own fallbacks are ignored.
+	Fallbacks []SelectedModel `json:"fallbacks,omitempty" jsonschema:"description=Models tried in order when this model is rate limited, overloaded or failing"`
 }
 
 type ProviderConfig struct {
@@ -75,7 +96,11 @@ type ProviderConfig struct {
 	// The provider's API endpoint.
 	BaseURL string `json:"base_url,omitempty" jsonschema:"description=Base URL for the provider's API,format=uri,example=https://api.openai.com/v1"`
 	// The provider type, e.g. "openai", "anthropic", etc. if empty it defaults to openai.
-	Type catwalk.Type `json:"type,omitempty" jsonschema:"description=Provider type that determines the API format,enum=openai,enum=anthropic,enum=gemini,enum=azure,enum=vertexai,default=openai"`
+	Type catwalk.Type `json:"type,omitempty" jsonschema:"description=Provider type that determines the API format,enum=openai,enum=anthropic,enum=gemini,enum=azure,enum=vertexai,enum=ollama,enum=mock,default=openai"`
+	// Use the OpenAI Responses API instead of Chat Completions, only for the openai type.
+	ResponsesAPI bool `json:"responses_api,omitempty" jsonschema:"description=Use the OpenAI Responses API instead of Chat Completions (openai type only),default=false"`
+	// Script file with the responses of a mock provider, relative to the working directory.
+	Script string `json:"script,omitempty" jsonschema:"description=Script file with the scripted responses of a mock provider (mock type only),example=testdata/session.json"`
 	// The provider's API key.
 	APIKey string `json:"api_key,omitempty" jsonschema:"description=API key for authentication with the provider,example=$OPENAI_API_KEY"`
 	// Marks the provider as disabled.
@@ -94,8 +119,27 @@ type ProviderConfig struct {
 
 	// The provider models
 	Models []catwalk.Model `json:"models,omitempty" jsonschema:"description=List of models available from this provider"`
+
+	// How failed requests are retried.
+	Retry Retry `json:"retry,omitzero" jsonschema:"description=How failed requests to this provider are retried"`
 }
 
+// Retry limits how failed requests to a provider are retried and when the
+// provider is considered down. Zero values use the defaults.
+type Retry struct {
+	// -1 disables retries.
+	MaxRetries     int `json:"max_retries,omitempty" jsonschema:"description=Maximum number of retries of a failed request (-1 disables retries),default=3,minimum=-1"`
+	InitialDelayMs int `json:"initial_delay_ms,omitempty" jsonschema:"description=Delay before the first retry in milliseconds; it doubles on every retry,default=2000,minimum=0"`
+	MaxDelayMs     int `json:"max_delay_ms,omitempty" jsonschema:"description=Longest delay between two attempts in milliseconds including the delay asked by the server,default=60000,minimum=0"`
+	// -1 disables the circuit breaker.
+	BreakerThreshold int `json:"breaker_threshold,omitempty" jsonschema:"description=Consecutive failed attempts after which requests fail fast without calling the provider (-1 disables it),default=5,minimum=-1"`
+	BreakerCooldownS int `json:"breaker_cooldown_seconds,omitempty" jsonschema:"description=Seconds requests fail fast before the provider is tried again,default=30,minimum=0"`
+}
+
+// TypeMock is the provider type whose responses come from a script file, for
+// tests and demos that can't reach a real provider.
+const TypeMock catwalk.Type = "mock"
+
 type MCPType string
 
 const (
@@ -148,8 +192,9 @@ func (c Completions) Limits() (depth, items int) {
 }
 
 type Permissions struct {
-	AllowedTools []string `json:"allowed_tools,omitempty" jsonschema:"description=List of tools that don't require permission prompts,example=bash,example=view"` // Tools that don't require permission prompts
-	SkipRequests bool     `json:"-"`                                                                                                                              // Automatically accept all permissions (YOLO mode)
+	AllowedTools     []string            `json:"allowed_tools,omitempty" jsonschema:"description=List of tools that don't require permission prompts,example=bash,example=view"`                     // Tools that don't require permission prompts
+	OutsideWorkspace fsext.OutsidePolicy `json:"outside_workspace,omitempty" jsonschema:"description=How paths outside the working directory are handled,enum=ask,enum=allow,enum=deny,default=ask"` // Policy for paths outside the working directory
+	SkipRequests     bool                `json:"-"`                                                                                                                                                  // Automatically accept all permissions (YOLO mode)
 }
 
 type Attribution struct {
@@ -157,12 +202,43 @@ type Attribution struct {
 	GeneratedWith bool `json:"generated_with,omitempty" jsonschema:"description=Add Generated with Crush line to commit messages and issues and PRs,default=true"`
 }
 
+// Budget limits what sessions and prompts may spend. A zero limit means no
+// limit. Spending of sub-agent sessions counts toward the parent session.
+type Budget struct {
+	SessionCost   float64 `json:"session_cost,omitempty" jsonschema:"description=Maximum cost in USD of a session including its sub-agent sessions,minimum=0,example=5"`
+	SessionTokens int64   `json:"session_tokens,omitempty" jsonschema:"description=Maximum number of tokens recorded for a session including its sub-agent sessions,minimum=0,example=2000000"`
+	PromptCost    float64 `json:"prompt_cost,omitempty" jsonschema:"description=Maximum cost in USD of a single prompt including the sub-agents it starts,minimum=0,example=1"`
+	PromptTokens  int64   `json:"prompt_tokens,omitempty" jsonschema:"description=Maximum number of tokens used by a single prompt including the sub-agents it starts,minimum=0,example=500000"`
+	// Fraction of a limit at which a warning is published.
+	WarnAt float64 `json:"warn_at,omitempty" jsonschema:"description=Fraction of a limit at which a warning is published,default=0.8,minimum=0,maximum=1"`
+}
+
+// Cassette records every provider stream to a file, or replays the streams
+// recorded in it instead of calling the providers.
+type Cassette struct {
+	Mode CassetteMode `json:"mode,omitempty" jsonschema:"description=Whether provider streams are recorded to or replayed from the cassette,enum=record,enum=replay"`
+	// Relative to the working directory.
+	Path string `json:"path,omitempty" jsonschema:"description=Cassette file (relative to working directory),example=session.cassette.jsonl"`
+}
+
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record"
+	CassetteReplay CassetteMode = "replay"
+)
+
 type Options struct {
 	ContextPaths              []string     `json:"context_paths,omitempty" jsonschema:"description=Paths to files containing context information for the AI,example=.cursorrules,example=CRUSH.md"`
 	TUI                       *TUIOptions  `json:"tui,omitempty" jsonschema:"description=Terminal user interface options"`
 	Debug                     bool         `json:"debug,omitempty" jsonschema:"description=Enable debug logging,default=false"`
 	DebugLSP                  bool         `json:"debug_lsp,omitempty" jsonschema:"description=Enable debug logging for LSP servers,default=false"`
 	DisableAutoSummarize      bool         `json:"disable_auto_summarize,omitempty" jsonschema:"description=Disable automatic conversation summarization,default=false"`
+	AutoSummarizeThreshold    float64      `json:"auto_summarize_threshold,omitempty" jsonschema:"description=Fraction of the model context window used by a session that triggers automatic summarization,default=0.8,minimum=0.1,maximum=1"`
+	MaxTurns                  int          `json:"max_turns,omitempty" jsonschema:"description=Maximum number of model turns for a single prompt before the agent stops,default=50,minimum=1"`
+	MaxRepeatedToolCalls      int          `json:"max_repeated_tool_calls,omitempty" jsonschema:"description=Maximum number of identical tool calls (same tool and input) in a row before the agent stops,default=3,minimum=1"`
+	Budget                    Budget       `json:"budget,omitzero" jsonschema:"description=Cost and token limits for sessions and prompts"`
+	Cassette                  Cassette     `json:"cassette,omitzero" jsonschema:"description=Record provider streams to a file or replay them from it"`
 	DataDirectory             string       `json:"data_directory,omitempty" jsonschema:"description=Directory for storing application data (relative to working directory),default=.crush,example=.crush"` // Relative to the cwd
 	DisabledTools             []string     `json:"disabled_tools" jsonschema:"description=Tools to disable"`
 	DisableProviderAutoUpdate bool         `json:"disable_provider_auto_update,omitempty" jsonschema:"description=Disable providers auto-update,default=false"`
@@ -235,26 +311,29 @@ func (m MCPConfig) ResolvedHeaders() map[string]string {
 
 type Agent struct {
 	ID          string `json:"id,omitempty"`
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
-	// This is the id of the system prompt used by the agent
-	Disabled bool `json:"disabled,omitempty"`
+	Name        string `json:"name,omitempty" jsonschema:"description=Display name of the agent"`
+	Description string `json:"description,omitempty" jsonschema:"description=What the agent is for; the coder reads it to decide when to delegate to the agent"`
+	Disabled    bool   `json:"disabled,omitempty" jsonschema:"description=Whether this agent is disabled,default=false"`
 
-	Model SelectedModelType `json:"model" jsonschema:"required,description=The model type to use for this agent,enum=large,enum=small,default=large"`
+	// Path of the file with the system prompt of the agent, relative to the
+	// working directory. Empty means the built-in prompt of coder and task.
+	Prompt string `json:"prompt,omitempty" jsonschema:"description=Path of a file with the system prompt of the agent,example=.crush/agents/reviewer.md"`
+
+	Model SelectedModelType `json:"model,omitempty" jsonschema:"description=The model type to use for this agent,enum=large,enum=small,default=large"`
 
 	// The available tools for the agent
 	//  if this is nil, all tools are available
 	AllowedTools []string `json:"allowed_tools,omitempty"`
 
 	// this tells us which MCPs are available for this agent
-	//  if this is empty all mcps are available
+	//  if this is nil all mcps are available, if it is empty none is
 	//  the string array is the list of tools from the AllowedMCP the agent has available
 	//  if the string array is nil, all tools from the AllowedMCP are available
-	AllowedMCP map[string][]string `json:"allowed_mcp,omitempty"`
+	AllowedMCP map[string][]string `json:"allowed_mcp,omitempty" jsonschema:"description=MCP servers the agent can use mapped to the names of their allowed tools (null for all of them); omit for every server,example={\"github\":[\"get_issue\"],\"docs\":null}"`
 
 	// The list of LSPs that this agent can use
 	//  if this is nil, all LSPs are available
-	AllowedLSP []string `json:"allowed_lsp,omitempty"`
+	AllowedLSP []string `json:"allowed_lsp,omitempty" jsonschema:"description=LSP servers the agent can use; omit for every server"`
 
 	// Overrides the context paths for this agent
 	ContextPaths []string `json:"context_paths,omitempty"`
@@ -295,8 +374,9 @@ type Config struct {
 
 	// Internal
 	workingDir string `json:"-"`
-	// TODO: most likely remove this concept when I come back to it
-	Agents map[string]Agent `json:"-"`
+	// User defined agents keyed by ID, plus the built-in coder and task
+	// added by SetupAgents.
+	Agents map[string]Agent `json:"agents,omitempty" jsonschema:"description=Custom agents that can be selected for a session or called by the coder through the agent tool"`
 	// TODO: find a better way to do this this should probably not be part of the config
 	resolver       VariableResolver
 	dataConfigDir  string             `json:"-"`
@@ -307,6 +387,16 @@ func (c *Config) WorkingDir() string {
 	return c.workingDir
 }
 
+// Workspace returns the sandbox for file access rooted at the working
+// directory, with the configured policy for paths outside of it.
+func (c *Config) Workspace() (*fsext.Workspace, error) {
+	var policy fsext.OutsidePolicy
+	if c.Permissions != nil {
+		policy = c.Permissions.OutsideWorkspace
+	}
+	return fsext.NewWorkspace(c.workingDir, policy)
+}
+
 func (c *Config) EnabledProviders() []ProviderConfig {
 	var enabled []ProviderConfig
 	for p := range c.Providers.Seq() {
@@ -498,33 +588,127 @@ func filterSlice(data []string, mask []string, include bool) []string {
 	return filtered
 }
 
+// SetupAgents adds the built-in coder and task agents to the user defined
+// ones and fills in the defaults of every agent. An entry for coder or task in
+// the config overrides the fields it sets; the coder can not be disabled.
+// Disabled agents are dropped.
 func (c *Config) SetupAgents() {
 	allowedTools := resolveAllowedTools(allToolNames(), c.Options.DisabledTools)
 
-	agents := map[string]Agent{
+	builtin := map[string]Agent{
 		"coder": {
-			ID:           "coder",
-			Name:         "Coder",
-			Description:  "An agent that helps with executing coding tasks.",
-			Model:        SelectedModelTypeLarge,
-			ContextPaths: c.Options.ContextPaths,
-			AllowedTools: allowedTools,
+			Name:        "Coder",
+			Description: "An agent that helps with executing coding tasks.",
 		},
 		"task": {
-			ID:           "task",
 			Name:         "Task",
 			Description:  "An agent that helps with searching for context and finding implementation details.",
-			Model:        SelectedModelTypeLarge,
-			ContextPaths: c.Options.ContextPaths,
 			AllowedTools: resolveReadOnlyTools(allowedTools),
 			// NO MCPs or LSPs by default
 			AllowedMCP: map[string][]string{},
 			AllowedLSP: []string{},
 		},
 	}
+
+	agents := make(map[string]Agent, len(c.Agents)+len(builtin))
+	for id, defaults := range builtin {
+		if _, ok := c.Agents[id]; !ok {
+			agents[id] = defaults
+		}
+	}
+	for id, agent := range c.Agents {
+		if defaults, ok := builtin[id]; ok {
+			if id == "coder" && agent.Disabled {
+				slog.Warn("The coder agent can not be disabled")
+				agent.Disabled = false
+			}
+			agent = agent.withDefaults(defaults)
+		}
+		if agent.Disabled {
+			continue
+		}
+		agents[id] = agent
+	}
+
+	for id, agent := range agents {
+		agent.ID = id
+		if agent.Name == "" {
+			agent.Name = id
+		}
+		switch agent.Model {
+		case "":
+			agent.Model = SelectedModelTypeLarge
+		case SelectedModelTypeLarge, SelectedModelTypeSmall:
+		default:
+			slog.Warn("Unknown model type for agent, using the large model", "agent", id, "model", agent.Model)
+			agent.Model = SelectedModelTypeLarge
+		}
+		if agent.AllowedTools == nil {
+			agent.AllowedTools = allowedTools
+		} else {
+			// Tools disabled globally stay disabled for every agent.
+			agent.AllowedTools = filterSlice(agent.AllowedTools, allowedTools, true)
+		}
+		if agent.ContextPaths == nil {
+			agent.ContextPaths = c.Options.ContextPaths
+		}
+		agents[id] = agent
+	}
 	c.Agents = agents
 }
 
+// withDefaults fills the fields a does not set with those of defaults.
+func (a Agent) withDefaults(defaults Agent) Agent {
+	a.Name = cmp.Or(a.Name, defaults.Name)
+	a.Description = cmp.Or(a.Description, defaults.Description)
+	a.Prompt = cmp.Or(a.Prompt, defaults.Prompt)
+	a.Model = cmp.Or(a.Model, defaults.Model)
+	if a.AllowedTools == nil {
+		a.AllowedTools = defaults.AllowedTools
+	}
+	if a.AllowedMCP == nil {
+		a.AllowedMCP = defaults.AllowedMCP
+	}
+	if a.AllowedLSP == nil {
+		a.AllowedLSP = defaults.AllowedLSP
+	}
+	if a.ContextPaths == nil {
+		a.ContextPaths = defaults.ContextPaths
+	}
+	return a
+}
+
+// MCPToolAllowed reports whether the agent may use the tool of the MCP server.
+func (a Agent) MCPToolAllowed(server, tool string) bool {
+	if a.AllowedMCP == nil {
+		return true
+	}
+	tools, ok := a.AllowedMCP[server]
+	return ok && (tools == nil || slices.Contains(tools, tool))
+}
+
+// LSPAllowed reports whether the agent may use the LSP server.
+func (a Agent) LSPAllowed(name string) bool {
+	return a.AllowedLSP == nil || slices.Contains(a.AllowedLSP, name)
+}
+
+// IsBuiltinAgent reports whether id is one of the agents built into the app.
+func IsBuiltinAgent(id string) bool {
+	return id == "coder" || id == "task"
+}
+
+// CustomAgents returns the user defined agents sorted by ID.
+func (c *Config) CustomAgents() []Agent {
+	var agents []Agent
+	for id, agent := range c.Agents {
+		if !IsBuiltinAgent(id) {
+			agents = append(agents, agent)
+		}
+	}
+	slices.SortFunc(agents, func(a, b Agent) int { return strings.Compare(a.ID, b.ID) })
+	return agents
+}
+
 func (c *Config) Resolver() VariableResolver {
 	return c.resolver
 }
@@ -559,6 +743,12 @@ func (c *ProviderConfig) TestConnection(resolver VariableResolver) error {
 			baseURL = "https://generativelanguage.googleapis.com"
 		}
 		testURL = baseURL + "/v1beta/models?key=" + url.QueryEscape(apiKey)
+	case TypeOllama:
+		baseURL, _ := resolver.ResolveValue(c.BaseURL)
+		if baseURL == "" {
+			baseURL = DefaultOllamaURL
+		}
+		testURL = strings.TrimSuffix(baseURL, "/") + "/api/tags"
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
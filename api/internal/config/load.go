@@ -187,6 +187,8 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 			BaseURL:            p.APIEndpoint,
 			APIKey:             p.APIKey,
 			Type:               p.Type,
+			ResponsesAPI:       config.ResponsesAPI,
+			Retry:              config.Retry,
 			Disable:            config.Disable,
 			SystemPromptPrefix: config.SystemPromptPrefix,
 			ExtraHeaders:       headers,
@@ -270,7 +272,22 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 			c.Providers.Del(id)
 			continue
 		}
-		if providerConfig.APIKey == "" {
+		if providerConfig.Type == TypeOllama {
+			configureOllamaProvider(&providerConfig, resolver)
+		}
+		if providerConfig.Type == TypeMock {
+			if providerConfig.Script == "" {
+				slog.Warn("Skipping mock provider due to missing script", "provider", id)
+				c.Providers.Del(id)
+				continue
+			}
+			if len(providerConfig.Models) == 0 {
+				providerConfig.Models = []catwalk.Model{defaultMockModel}
+			}
+			c.Providers.Set(id, providerConfig)
+			continue
+		}
+		if providerConfig.APIKey == "" && providerConfig.Type != TypeOllama {
 			slog.Warn("Provider is missing API key, this might be OK for local providers", "provider", id)
 		}
 		if providerConfig.BaseURL == "" {
@@ -283,14 +300,14 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 			c.Providers.Del(id)
 			continue
 		}
-		if providerConfig.Type != catwalk.TypeOpenAI && providerConfig.Type != catwalk.TypeAnthropic && providerConfig.Type != catwalk.TypeGemini {
+		if !slices.Contains([]catwalk.Type{catwalk.TypeOpenAI, catwalk.TypeAnthropic, catwalk.TypeGemini, TypeOllama}, providerConfig.Type) {
 			slog.Warn("Skipping custom provider because the provider type is not supported", "provider", id, "type", providerConfig.Type)
 			c.Providers.Del(id)
 			continue
 		}
 
 		apiKey, err := resolver.ResolveValue(providerConfig.APIKey)
-		if apiKey == "" || err != nil {
+		if (apiKey == "" || err != nil) && providerConfig.Type != TypeOllama {
 			slog.Warn("Provider is missing API key, this might be OK for local providers", "provider", id)
 		}
 		baseURL, err := resolver.ResolveValue(providerConfig.BaseURL)
@@ -305,6 +322,36 @@ func (c *Config) configureProviders(env env.Env, resolver VariableResolver, know
 	return nil
 }
 
+// defaultMockModel is the model of a mock provider that doesn't list any.
+var defaultMockModel = catwalk.Model{
+	ID:               "mock",
+	Name:             "Mock",
+	ContextWindow:    200_000,
+	DefaultMaxTokens: 4096,
+	CanReason:        true,
+	SupportsImages:   true,
+}
+
+// configureOllamaProvider defaults the base URL of an Ollama provider to the
+// local server and adds the models pulled into it to the configured ones. If
+// the server can't be reached only the configured models are used.
+func configureOllamaProvider(providerConfig *ProviderConfig, resolver VariableResolver) {
+	if providerConfig.BaseURL == "" {
+		providerConfig.BaseURL = DefaultOllamaURL
+	}
+	baseURL, err := resolver.ResolveValue(providerConfig.BaseURL)
+	if err != nil {
+		slog.Warn("Failed to resolve Ollama base URL", "provider", providerConfig.ID, "error", err)
+		return
+	}
+	discovered, err := DiscoverOllamaModels(context.Background(), baseURL)
+	if err != nil {
+		slog.Warn("Failed to discover Ollama models", "provider", providerConfig.ID, "error", err)
+		return
+	}
+	providerConfig.Models = mergeOllamaModels(providerConfig.Models, discovered)
+}
+
 func (c *Config) setDefaults(workingDir, dataDir string) {
 	c.workingDir = workingDir
 	if c.Options == nil {
@@ -316,6 +363,18 @@ func (c *Config) setDefaults(workingDir, dataDir string) {
 	if c.Options.ContextPaths == nil {
 		c.Options.ContextPaths = []string{}
 	}
+	if c.Options.AutoSummarizeThreshold <= 0 || c.Options.AutoSummarizeThreshold > 1 {
+		c.Options.AutoSummarizeThreshold = defaultAutoSummarizeThreshold
+	}
+	if c.Options.MaxTurns <= 0 {
+		c.Options.MaxTurns = defaultMaxTurns
+	}
+	if c.Options.MaxRepeatedToolCalls <= 0 {
+		c.Options.MaxRepeatedToolCalls = defaultMaxRepeatedToolCalls
+	}
+	if c.Options.Budget.WarnAt <= 0 || c.Options.Budget.WarnAt > 1 {
+		c.Options.Budget.WarnAt = defaultBudgetWarnAt
+	}
 	if dataDir != "" {
 		c.Options.DataDirectory = dataDir
 	} else if c.Options.DataDirectory == "" {
@@ -325,6 +384,18 @@ func (c *Config) setDefaults(workingDir, dataDir string) {
 			c.Options.DataDirectory = filepath.Join(workingDir, defaultDataDirectory)
 		}
 	}
+	switch c.Options.Cassette.Mode {
+	case "":
+	case CassetteRecord, CassetteReplay:
+		if c.Options.Cassette.Path == "" {
+			c.Options.Cassette.Path = filepath.Join(c.Options.DataDirectory, defaultCassetteFile)
+		} else if !filepath.IsAbs(c.Options.Cassette.Path) {
+			c.Options.Cassette.Path = filepath.Join(workingDir, c.Options.Cassette.Path)
+		}
+	default:
+		slog.Warn("Ignoring unknown cassette mode", "mode", c.Options.Cassette.Mode)
+		c.Options.Cassette = Cassette{}
+	}
 	if c.Providers == nil {
 		c.Providers = csync.NewMap[string, ProviderConfig]()
 	}
@@ -495,6 +566,7 @@ func (c *Config) configureSelectedModels(knownProviders []catwalk.Provider) erro
 				large.ReasoningEffort = largeModelSelected.ReasoningEffort
 			}
 			large.Think = largeModelSelected.Think
+			large.Fallbacks = largeModelSelected.Fallbacks
 		}
 	}
 	smallModelSelected, smallModelConfigured := c.Models[SelectedModelTypeSmall]
@@ -522,6 +594,7 @@ func (c *Config) configureSelectedModels(knownProviders []catwalk.Provider) erro
 			}
 			small.ReasoningEffort = smallModelSelected.ReasoningEffort
 			small.Think = smallModelSelected.Think
+			small.Fallbacks = smallModelSelected.Fallbacks
 		}
 	}
 	c.Models[SelectedModelTypeLarge] = large
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -51,6 +55,10 @@ func TestConfig_setDefaults(t *testing.T) {
 	require.NotNil(t, cfg.LSP)
 	require.NotNil(t, cfg.MCP)
 	require.Equal(t, filepath.Join("/tmp", ".crush"), cfg.Options.DataDirectory)
+	require.Equal(t, defaultAutoSummarizeThreshold, cfg.Options.AutoSummarizeThreshold)
+	require.Equal(t, defaultMaxTurns, cfg.Options.MaxTurns)
+	require.Equal(t, defaultMaxRepeatedToolCalls, cfg.Options.MaxRepeatedToolCalls)
+	require.Equal(t, defaultBudgetWarnAt, cfg.Options.Budget.WarnAt)
 	for _, path := range defaultContextPaths {
 		require.Contains(t, cfg.Options.ContextPaths, path)
 	}
@@ -516,6 +524,107 @@ func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
 	assert.Equal(t, []string{}, taskAgent.AllowedTools)
 }
 
+func TestConfig_setupAgentsWithCustomAgents(t *testing.T) {
+	cfg := &Config{
+		Options: &Options{
+			DisabledTools: []string{"bash"},
+			ContextPaths:  []string{"AGENTS.md"},
+		},
+		Agents: map[string]Agent{
+			"reviewer": {
+				Description:  "Reviews changes",
+				Prompt:       "reviewer.md",
+				Model:        SelectedModelTypeSmall,
+				AllowedTools: []string{"view", "bash", "grep"},
+			},
+			"writer":   {ContextPaths: []string{"STYLE.md"}},
+			"disabled": {Disabled: true},
+		},
+	}
+
+	cfg.SetupAgents()
+	require.Len(t, cfg.Agents, 4)
+
+	reviewer := cfg.Agents["reviewer"]
+	assert.Equal(t, "reviewer", reviewer.ID)
+	assert.Equal(t, "reviewer", reviewer.Name)
+	assert.Equal(t, SelectedModelTypeSmall, reviewer.Model)
+	assert.Equal(t, []string{"view", "grep"}, reviewer.AllowedTools)
+	assert.Equal(t, []string{"AGENTS.md"}, reviewer.ContextPaths)
+
+	writer := cfg.Agents["writer"]
+	assert.Equal(t, SelectedModelTypeLarge, writer.Model)
+	assert.NotContains(t, writer.AllowedTools, "bash")
+	assert.Contains(t, writer.AllowedTools, "agent")
+	assert.Equal(t, []string{"STYLE.md"}, writer.ContextPaths)
+
+	custom := cfg.CustomAgents()
+	require.Len(t, custom, 2)
+	assert.Equal(t, "reviewer", custom[0].ID)
+	assert.Equal(t, "writer", custom[1].ID)
+}
+
+func TestConfig_setupAgentsWithBuiltinOverrides(t *testing.T) {
+	cfg := &Config{
+		Options: &Options{},
+		Agents: map[string]Agent{
+			"coder": {Disabled: true, AllowedLSP: []string{"gopls"}},
+			"task": {
+				Model:        SelectedModelTypeSmall,
+				AllowedTools: []string{"view", "fetch"},
+				AllowedMCP:   map[string][]string{"docs": nil},
+			},
+		},
+	}
+
+	cfg.SetupAgents()
+	coder := cfg.Agents["coder"]
+	assert.False(t, coder.Disabled)
+	assert.Equal(t, "Coder", coder.Name)
+	assert.Equal(t, allToolNames(), coder.AllowedTools)
+	assert.Nil(t, coder.AllowedMCP)
+	assert.Equal(t, []string{"gopls"}, coder.AllowedLSP)
+
+	task := cfg.Agents["task"]
+	assert.Equal(t, "task", task.ID)
+	assert.Equal(t, "Task", task.Name)
+	assert.Equal(t, SelectedModelTypeSmall, task.Model)
+	assert.Equal(t, []string{"view", "fetch"}, task.AllowedTools)
+	assert.Equal(t, map[string][]string{"docs": nil}, task.AllowedMCP)
+	assert.Equal(t, []string{}, task.AllowedLSP)
+
+	cfg = &Config{
+		Options: &Options{},
+		Agents:  map[string]Agent{"task": {Disabled: true}},
+	}
+	cfg.SetupAgents()
+	assert.NotContains(t, cfg.Agents, "task")
+	assert.Contains(t, cfg.Agents, "coder")
+}
+
+func TestAgent_allowlists(t *testing.T) {
+	t.Parallel()
+
+	all := Agent{}
+	assert.True(t, all.MCPToolAllowed("github", "get_issue"))
+	assert.True(t, all.LSPAllowed("gopls"))
+
+	none := Agent{AllowedMCP: map[string][]string{}, AllowedLSP: []string{}}
+	assert.False(t, none.MCPToolAllowed("github", "get_issue"))
+	assert.False(t, none.LSPAllowed("gopls"))
+
+	some := Agent{
+		AllowedMCP: map[string][]string{"github": {"get_issue"}, "docs": nil},
+		AllowedLSP: []string{"gopls"},
+	}
+	assert.True(t, some.MCPToolAllowed("github", "get_issue"))
+	assert.False(t, some.MCPToolAllowed("github", "create_issue"))
+	assert.True(t, some.MCPToolAllowed("docs", "search"))
+	assert.False(t, some.MCPToolAllowed("slack", "post"))
+	assert.True(t, some.LSPAllowed("gopls"))
+	assert.False(t, some.LSPAllowed("tsserver"))
+}
+
 func TestConfig_configureProvidersWithDisabledProvider(t *testing.T) {
 	knownProviders := []catwalk.Provider{
 		{
@@ -731,6 +840,78 @@ func TestConfig_configureProvidersCustomProviderValidation(t *testing.T) {
 	})
 }
 
+func TestConfig_configureProvidersOllamaDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"qwen3:8b","model":"qwen3:8b"},{"name":"broken:1b","model":"broken:1b"},{"name":"llava:7b","model":"llava:7b"}]}`)
+		case "/api/show":
+			var req struct{ Model string }
+			json.NewDecoder(r.Body).Decode(&req)
+			switch req.Model {
+			case "qwen3:8b":
+				fmt.Fprint(w, `{"capabilities":["completion","tools","thinking"],"model_info":{"general.architecture":"qwen3","qwen3.context_length":262144}}`)
+			case "llava:7b":
+				fmt.Fprint(w, `{"capabilities":["completion","vision"],"model_info":{"llama.context_length":4096}}`)
+			default:
+				http.Error(w, "model is corrupted", http.StatusInternalServerError)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Providers: csync.NewMapFrom(map[string]ProviderConfig{
+			"ollama": {
+				Type:    TypeOllama,
+				BaseURL: server.URL,
+				Models:  []catwalk.Model{{ID: "qwen3:8b", Name: "Qwen 3", DefaultMaxTokens: 2048}},
+			},
+		}),
+	}
+	cfg.setDefaults("/tmp", "")
+	env := env.NewFromMap(map[string]string{})
+	resolver := NewEnvironmentVariableResolver(env)
+	err := cfg.configureProviders(env, resolver, []catwalk.Provider{})
+	require.NoError(t, err)
+
+	pc, exists := cfg.Providers.Get("ollama")
+	require.True(t, exists)
+	// The model whose details fail is skipped.
+	require.Len(t, pc.Models, 2)
+	// The configured model keeps its settings but gets the context window,
+	// capped.
+	require.Equal(t, catwalk.Model{ID: "qwen3:8b", Name: "Qwen 3", ContextWindow: ollamaMaxContextWindow, DefaultMaxTokens: 2048}, pc.Models[0])
+	require.Equal(t, catwalk.Model{ID: "llava:7b", Name: "llava:7b", ContextWindow: 4096, DefaultMaxTokens: 409, SupportsImages: true}, pc.Models[1])
+
+	t.Run("unreachable server keeps the configured models", func(t *testing.T) {
+		cfg := &Config{
+			Providers: csync.NewMapFrom(map[string]ProviderConfig{
+				"ollama": {
+					Type:    TypeOllama,
+					BaseURL: "http://127.0.0.1:1",
+					Models:  []catwalk.Model{{ID: "qwen3:8b"}},
+				},
+				"empty": {
+					Type:    TypeOllama,
+					BaseURL: "http://127.0.0.1:1",
+				},
+			}),
+		}
+		cfg.setDefaults("/tmp", "")
+		err := cfg.configureProviders(env, resolver, []catwalk.Provider{})
+		require.NoError(t, err)
+
+		pc, exists := cfg.Providers.Get("ollama")
+		require.True(t, exists)
+		require.Equal(t, []catwalk.Model{{ID: "qwen3:8b"}}, pc.Models)
+		_, exists = cfg.Providers.Get("empty")
+		require.False(t, exists)
+	})
+}
+
 func TestConfig_configureProvidersEnhancedCredentialValidation(t *testing.T) {
 	t.Run("VertexAI provider removed when credentials missing with existing config", func(t *testing.T) {
 		knownProviders := []catwalk.Provider{
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+)
+
+// TypeOllama is the provider type of a local Ollama server, talked to through
+// its native API instead of the OpenAI compatible one.
+const TypeOllama catwalk.Type = "ollama"
+
+// DefaultOllamaURL is the address Ollama listens on by default.
+const DefaultOllamaURL = "http://localhost:11434"
+
+// ollamaDiscoveryTimeout bounds the whole model discovery so a missing server
+// doesn't hold up the start of the app.
+const ollamaDiscoveryTimeout = 5 * time.Second
+
+// ollamaMaxContextWindow caps the context window of a discovered model. Ollama
+// allocates memory for the whole window when it loads a model, and the longest
+// ones wouldn't fit on most machines; a model configured with its own
+// context_window can use more.
+const ollamaMaxContextWindow = 32768
+
+type ollamaTagsResponse struct {
+	Models []struct {
+		Name  string `json:"name"`
+		Model string `json:"model"`
+	} `json:"models"`
+}
+
+type ollamaShowResponse struct {
+	Capabilities []string       `json:"capabilities"`
+	ModelInfo    map[string]any `json:"model_info"`
+}
+
+// DiscoverOllamaModels lists the models pulled into the Ollama server at
+// baseURL, with their context window and capabilities. A model whose details
+// can't be read is left out.
+func DiscoverOllamaModels(ctx context.Context, baseURL string) ([]catwalk.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, ollamaDiscoveryTimeout)
+	defer cancel()
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var tags ollamaTagsResponse
+	if err := ollamaRequest(ctx, http.MethodGet, baseURL+"/api/tags", nil, &tags); err != nil {
+		return nil, fmt.Errorf("failed to list ollama models: %w", err)
+	}
+
+	models := make([]catwalk.Model, 0, len(tags.Models))
+	for _, tag := range tags.Models {
+		id := tag.Model
+		if id == "" {
+			id = tag.Name
+		}
+		var show ollamaShowResponse
+		if err := ollamaRequest(ctx, http.MethodPost, baseURL+"/api/show", map[string]string{"model": id}, &show); err != nil {
+			slog.Warn("Skipping Ollama model whose details can't be read", "model", id, "error", err)
+			continue
+		}
+		models = append(models, newOllamaModel(id, show))
+	}
+	return models, nil
+}
+
+func newOllamaModel(id string, show ollamaShowResponse) catwalk.Model {
+	var contextWindow int64
+	for key, value := range show.ModelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			contextWindow = min(int64(n), ollamaMaxContextWindow)
+			break
+		}
+	}
+	return catwalk.Model{
+		ID:               id,
+		Name:             id,
+		ContextWindow:    contextWindow,
+		DefaultMaxTokens: contextWindow / 10,
+		CanReason:        slices.Contains(show.Capabilities, "thinking"),
+		SupportsImages:   slices.Contains(show.Capabilities, "vision"),
+	}
+}
+
+func ollamaRequest(ctx context.Context, method, url string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// mergeOllamaModels adds the discovered models to the configured ones. A
+// configured model wins over the discovered one with the same ID, but gets the
+// discovered context window and max tokens when it doesn't set them.
+func mergeOllamaModels(configured, discovered []catwalk.Model) []catwalk.Model {
+	merged := slices.Clone(configured)
+	for _, model := range discovered {
+		i := slices.IndexFunc(merged, func(m catwalk.Model) bool { return m.ID == model.ID })
+		if i < 0 {
+			merged = append(merged, model)
+			continue
+		}
+		if merged[i].ContextWindow == 0 {
+			merged[i].ContextWindow = model.ContextWindow
+		}
+		if merged[i].DefaultMaxTokens == 0 {
+			merged[i].DefaultMaxTokens = model.DefaultMaxTokens
+		}
+	}
+	return merged
+}
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Link every file version to the assistant message whose tool call wrote it
+ALTER TABLE files ADD COLUMN message_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_files_message_id ON files (message_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_files_message_id;
+ALTER TABLE files DROP COLUMN message_id;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The agent that answers the prompts of the session; empty means the coder
+ALTER TABLE sessions ADD COLUMN agent_id TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN agent_id;
+-- +goose StatementEnd
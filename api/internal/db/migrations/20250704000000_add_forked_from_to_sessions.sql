@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The session a fork was copied from. Forks are top-level sessions, not
+-- children of the original.
+ALTER TABLE sessions ADD COLUMN forked_from_session_id TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sessions DROP COLUMN forked_from_session_id;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Marks a version that stands for the file not existing, as opposed to an
+-- empty file
+ALTER TABLE files ADD COLUMN missing BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN missing;
+-- +goose StatementEnd
@@ -24,10 +24,28 @@ INSERT INTO messages (
 )
 RETURNING *;
 
+-- name: CopyMessage :one
+INSERT INTO messages (
+    id,
+    session_id,
+    role,
+    parts,
+    model,
+    provider,
+    created_at,
+    updated_at,
+    finished_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+RETURNING *;
+
 -- name: UpdateMessage :exec
 UPDATE messages
 SET
     parts = ?,
+    model = ?,
+    provider = ?,
     finished_at = ?,
     updated_at = strftime('%s', 'now')
 WHERE id = ?;
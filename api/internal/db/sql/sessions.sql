@@ -8,6 +8,8 @@ INSERT INTO sessions (
     completion_tokens,
     cost,
     summary_message_id,
+    agent_id,
+    forked_from_session_id,
     updated_at,
     created_at
 ) VALUES (
@@ -19,6 +21,8 @@ INSERT INTO sessions (
     ?,
     ?,
     null,
+    ?,
+    ?,
     strftime('%s', 'now'),
     strftime('%s', 'now')
 ) RETURNING *;
@@ -34,6 +38,12 @@ FROM sessions
 WHERE parent_session_id is NULL
 ORDER BY created_at DESC;
 
+-- name: ListChildSessions :many
+SELECT *
+FROM sessions
+WHERE parent_session_id = ?
+ORDER BY created_at ASC;
+
 -- name: UpdateSession :one
 UPDATE sessions
 SET
@@ -41,6 +51,7 @@ SET
     prompt_tokens = ?,
     completion_tokens = ?,
     summary_message_id = ?,
+    agent_id = ?,
     cost = ?
 WHERE id = ?
 RETURNING *;
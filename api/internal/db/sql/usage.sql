@@ -0,0 +1,60 @@
+-- name: CreateUsage :one
+INSERT INTO usage (
+    id,
+    session_id,
+    message_id,
+    provider,
+    model,
+    input_tokens,
+    output_tokens,
+    cache_creation_tokens,
+    cache_read_tokens,
+    cost,
+    created_at
+) VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, strftime('%s', 'now')
+)
+RETURNING *;
+
+-- name: GetLastUsage :one
+SELECT *
+FROM usage
+WHERE session_id = ?
+  AND message_id IN (SELECT id FROM messages)
+ORDER BY created_at DESC, rowid DESC
+LIMIT 1;
+
+-- name: ListUsageBySession :many
+SELECT *
+FROM usage
+WHERE session_id = ?1
+   OR session_id IN (SELECT id FROM sessions WHERE parent_session_id = ?1)
+ORDER BY created_at ASC, rowid ASC;
+
+-- name: GetSessionUsage :one
+SELECT
+    COUNT(*) AS turns,
+    CAST(COALESCE(SUM(input_tokens), 0) AS INTEGER) AS input_tokens,
+    CAST(COALESCE(SUM(output_tokens), 0) AS INTEGER) AS output_tokens,
+    CAST(COALESCE(SUM(cache_creation_tokens), 0) AS INTEGER) AS cache_creation_tokens,
+    CAST(COALESCE(SUM(cache_read_tokens), 0) AS INTEGER) AS cache_read_tokens,
+    CAST(COALESCE(SUM(cost), 0) AS REAL) AS cost
+FROM usage
+WHERE session_id = ?1
+   OR session_id IN (SELECT id FROM sessions WHERE parent_session_id = ?1);
+
+-- name: ListUsageByModel :many
+SELECT
+    provider,
+    model,
+    COUNT(*) AS turns,
+    CAST(COALESCE(SUM(input_tokens), 0) AS INTEGER) AS input_tokens,
+    CAST(COALESCE(SUM(output_tokens), 0) AS INTEGER) AS output_tokens,
+    CAST(COALESCE(SUM(cache_creation_tokens), 0) AS INTEGER) AS cache_creation_tokens,
+    CAST(COALESCE(SUM(cache_read_tokens), 0) AS INTEGER) AS cache_read_tokens,
+    CAST(COALESCE(SUM(cost), 0) AS REAL) AS cost
+FROM usage
+WHERE session_id = ?1
+   OR session_id IN (SELECT id FROM sessions WHERE parent_session_id = ?1)
+GROUP BY provider, model
+ORDER BY cost DESC, provider ASC, model ASC;
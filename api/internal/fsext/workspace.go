@@ -0,0 +1,143 @@
+package fsext
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutsidePolicy controls what happens to paths that resolve outside the
+// workspace root.
+type OutsidePolicy string
+
+const (
+	// OutsideAsk allows outside paths once the user grants permission.
+	OutsideAsk OutsidePolicy = "ask"
+	// OutsideAllow allows outside paths without asking.
+	OutsideAllow OutsidePolicy = "allow"
+	// OutsideDeny rejects outside paths.
+	OutsideDeny OutsidePolicy = "deny"
+)
+
+// maxSymlinks bounds symlink resolution, like the kernel's ELOOP limit.
+const maxSymlinks = 40
+
+// ErrOutsideWorkspace is returned for paths outside the workspace root when
+// the policy denies them.
+var ErrOutsideWorkspace = errors.New("path is outside the workspace")
+
+// Workspace is a sandbox rooted at a directory. Paths are resolved against
+// the root with all symlinks followed, so neither "../" components nor links
+// pointing elsewhere can escape it unnoticed.
+type Workspace struct {
+	root   string
+	policy OutsidePolicy
+}
+
+// NewWorkspace returns a workspace rooted at root. An empty or unknown policy
+// falls back to OutsideAsk.
+func NewWorkspace(root string, policy OutsidePolicy) (*Workspace, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving workspace root: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving workspace root: %w", err)
+	}
+	switch policy {
+	case OutsideAllow, OutsideDeny:
+	default:
+		policy = OutsideAsk
+	}
+	return &Workspace{root: resolved, policy: policy}, nil
+}
+
+// Root returns the resolved workspace root.
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Policy returns the policy for paths outside the root.
+func (w *Workspace) Policy() OutsidePolicy {
+	return w.policy
+}
+
+// Resolve returns the absolute path of path, relative paths being taken from
+// the root, with every symlink resolved. Paths that do not exist yet are
+// resolved through their deepest existing ancestor, so files about to be
+// created are checked as well.
+func (w *Workspace) Resolve(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.root, path)
+	}
+	path = filepath.Clean(path)
+
+	for range maxSymlinks {
+		existing := path
+		var rest []string
+		for {
+			resolved, err := filepath.EvalSymlinks(existing)
+			if err == nil {
+				return filepath.Join(append([]string{resolved}, rest...)...), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+			// A dangling symlink still decides where a new file would be
+			// created, so follow its target instead of skipping it.
+			if info, lerr := os.Lstat(existing); lerr == nil && info.Mode()&fs.ModeSymlink != 0 {
+				target, err := os.Readlink(existing)
+				if err != nil {
+					return "", err
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(filepath.Dir(existing), target)
+				}
+				path = filepath.Clean(filepath.Join(append([]string{target}, rest...)...))
+				break
+			}
+			parent := filepath.Dir(existing)
+			if parent == existing {
+				return path, nil
+			}
+			rest = append([]string{filepath.Base(existing)}, rest...)
+			existing = parent
+		}
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+}
+
+// Contains reports whether the resolved path is the root or below it.
+func (w *Workspace) Contains(resolved string) bool {
+	rel, err := filepath.Rel(w.root, resolved)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Check resolves path and applies the outside policy. It returns the
+// resolved path and whether the caller must ask the user before using it,
+// which only happens for outside paths under OutsideAsk. Outside paths under
+// OutsideDeny return ErrOutsideWorkspace.
+func (w *Workspace) Check(path string) (resolved string, ask bool, err error) {
+	resolved, err = w.Resolve(path)
+	if err != nil {
+		return "", false, err
+	}
+	if w.Contains(resolved) {
+		return resolved, false, nil
+	}
+	switch w.policy {
+	case OutsideAllow:
+		return resolved, false, nil
+	case OutsideDeny:
+		return "", false, fmt.Errorf("%w: %s", ErrOutsideWorkspace, path)
+	default:
+		return resolved, true, nil
+	}
+}
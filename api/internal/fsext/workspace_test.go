@@ -0,0 +1,82 @@
+package fsext
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspace(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0o755))
+	require.NoError(t, os.MkdirAll(outside, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "file.txt"), []byte("x"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("x"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(root, "dangling")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inner")))
+
+	ws, err := NewWorkspace(root, OutsideDeny)
+	require.NoError(t, err)
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+	resolvedOutside, err := filepath.EvalSymlinks(outside)
+	require.NoError(t, err)
+
+	t.Run("inside paths", func(t *testing.T) {
+		for _, p := range []string{"sub/file.txt", "./sub/../sub/file.txt", filepath.Join(root, "sub", "file.txt"), "inner/file.txt"} {
+			resolved, ask, err := ws.Check(p)
+			require.NoError(t, err, p)
+			require.False(t, ask)
+			require.Equal(t, filepath.Join(resolvedRoot, "sub", "file.txt"), resolved)
+		}
+	})
+
+	t.Run("new files inside", func(t *testing.T) {
+		resolved, _, err := ws.Check("sub/new/dir/file.txt")
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(resolvedRoot, "sub", "new", "dir", "file.txt"), resolved)
+	})
+
+	t.Run("escapes are rejected", func(t *testing.T) {
+		for _, p := range []string{"../outside/secret.txt", filepath.Join(outside, "secret.txt"), "escape/secret.txt", "escape/missing.txt", "dangling"} {
+			_, _, err := ws.Check(p)
+			require.ErrorIs(t, err, ErrOutsideWorkspace, p)
+		}
+	})
+
+	t.Run("dangling symlinks resolve to their target", func(t *testing.T) {
+		resolved, err := ws.Resolve("dangling")
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(resolvedOutside, "new.txt"), resolved)
+	})
+
+	t.Run("ask policy", func(t *testing.T) {
+		ws, err := NewWorkspace(root, "")
+		require.NoError(t, err)
+		require.Equal(t, OutsideAsk, ws.Policy())
+		resolved, ask, err := ws.Check("escape/secret.txt")
+		require.NoError(t, err)
+		require.True(t, ask)
+		require.Equal(t, filepath.Join(resolvedOutside, "secret.txt"), resolved)
+	})
+
+	t.Run("allow policy", func(t *testing.T) {
+		ws, err := NewWorkspace(root, OutsideAllow)
+		require.NoError(t, err)
+		_, ask, err := ws.Check("../outside/secret.txt")
+		require.NoError(t, err)
+		require.False(t, ask)
+	})
+
+	t.Run("symlink loops", func(t *testing.T) {
+		require.NoError(t, os.Symlink("loop2", filepath.Join(root, "loop1")))
+		require.NoError(t, os.Symlink("loop1", filepath.Join(root, "loop2")))
+		_, err := ws.Resolve("loop1")
+		require.Error(t, err)
+	})
+}
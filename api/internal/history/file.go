@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
@@ -18,23 +19,80 @@ const (
 type File struct {
 	ID        string
 	SessionID string
+	// MessageID is the assistant message whose tool call recorded the
+	// version. It is empty for versions recorded before it was tracked.
+	MessageID string
 	Path      string
 	Content   string
+	// Missing reports that the version stands for the file not existing,
+	// rather than for an empty file.
+	Missing   bool
 	Version   int64
 	CreatedAt int64
 	UpdatedAt int64
 }
 
+type messageIDContextKey struct{}
+
+// WithMessageID returns a context whose file versions are attributed to the
+// assistant message messageID.
+func WithMessageID(ctx context.Context, messageID string) context.Context {
+	return context.WithValue(ctx, messageIDContextKey{}, messageID)
+}
+
+func messageIDFromContext(ctx context.Context) string {
+	messageID, _ := ctx.Value(messageIDContextKey{}).(string)
+	return messageID
+}
+
+type parentTurnContextKey struct{}
+
+type parentTurn struct {
+	sessionID, messageID string
+}
+
+// WithParentTurn returns a context whose file versions are recorded in the
+// session sessionID and attributed to its assistant message messageID, no
+// matter which session records them. Sub-agents run under it, so their edits
+// belong to the turn that called them and are undone along with it. An outer
+// parent turn is kept.
+func WithParentTurn(ctx context.Context, sessionID, messageID string) context.Context {
+	if _, ok := ctx.Value(parentTurnContextKey{}).(parentTurn); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, parentTurnContextKey{}, parentTurn{sessionID: sessionID, messageID: messageID})
+}
+
+// owner returns the session and message a version recorded in sessionID
+// under ctx belongs to.
+func owner(ctx context.Context, sessionID string) (string, string) {
+	if turn, ok := ctx.Value(parentTurnContextKey{}).(parentTurn); ok {
+		return turn.sessionID, turn.messageID
+	}
+	return sessionID, messageIDFromContext(ctx)
+}
+
 type Service interface {
 	pubsub.Suscriber[File]
 	Create(ctx context.Context, sessionID, path, content string) (File, error)
 	CreateVersion(ctx context.Context, sessionID, path, content string) (File, error)
+	// CreateMissing records, as a new version, that path does not exist:
+	// before a tool creates it, or after a restore removes it.
+	CreateMissing(ctx context.Context, sessionID, path string) (File, error)
 	Get(ctx context.Context, id string) (File, error)
 	GetByPathAndSession(ctx context.Context, path, sessionID string) (File, error)
 	ListBySession(ctx context.Context, sessionID string) ([]File, error)
 	ListLatestSessionFiles(ctx context.Context, sessionID string) ([]File, error)
 	Delete(ctx context.Context, id string) error
 	DeleteSessionFiles(ctx context.Context, sessionID string) error
+	// DeleteMessageFiles removes the versions recorded by the given messages
+	// of the session.
+	DeleteMessageFiles(ctx context.Context, sessionID string, messageIDs []string) error
+	// Fork copies the file versions of sessionID into newSessionID. Only the
+	// versions recorded by the messages in messageIDs are copied, attributed
+	// to the message they map to, along with the versions that predate
+	// message tracking.
+	Fork(ctx context.Context, sessionID, newSessionID string, messageIDs map[string]string) error
 }
 
 type service struct {
@@ -52,33 +110,45 @@ func NewService(q *db.Queries, db *sql.DB) Service {
 }
 
 func (s *service) Create(ctx context.Context, sessionID, path, content string) (File, error) {
-	return s.createWithVersion(ctx, sessionID, path, content, InitialVersion)
+	return s.createWithVersion(ctx, sessionID, path, content, InitialVersion, false)
 }
 
 func (s *service) CreateVersion(ctx context.Context, sessionID, path, content string) (File, error) {
-	// Get the latest version for this path
-	files, err := s.q.ListFilesByPath(ctx, path)
+	version, err := s.nextVersion(ctx, path)
 	if err != nil {
 		return File{}, err
 	}
+	return s.createWithVersion(ctx, sessionID, path, content, version, false)
+}
 
-	if len(files) == 0 {
-		// No previous versions, create initial
-		return s.Create(ctx, sessionID, path, content)
+func (s *service) CreateMissing(ctx context.Context, sessionID, path string) (File, error) {
+	version, err := s.nextVersion(ctx, path)
+	if err != nil {
+		return File{}, err
 	}
+	return s.createWithVersion(ctx, sessionID, path, "", version, true)
+}
 
-	// Get the latest version
-	latestFile := files[0] // Files are ordered by version DESC, created_at DESC
-	nextVersion := latestFile.Version + 1
-
-	return s.createWithVersion(ctx, sessionID, path, content, nextVersion)
+// nextVersion returns the version that follows the latest one of path, or the
+// initial version when there is none.
+func (s *service) nextVersion(ctx context.Context, path string) (int64, error) {
+	files, err := s.q.ListFilesByPath(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return InitialVersion, nil
+	}
+	// Files are ordered by version DESC, created_at DESC
+	return files[0].Version + 1, nil
 }
 
-func (s *service) createWithVersion(ctx context.Context, sessionID, path, content string, version int64) (File, error) {
+func (s *service) createWithVersion(ctx context.Context, sessionID, path, content string, version int64, missing bool) (File, error) {
 	// Maximum number of retries for transaction conflicts
 	const maxRetries = 3
 	var file File
 	var err error
+	sessionID, messageID := owner(ctx, sessionID)
 
 	// Retry loop for transaction conflicts
 	for attempt := range maxRetries {
@@ -98,6 +168,8 @@ func (s *service) createWithVersion(ctx context.Context, sessionID, path, conten
 			Path:      path,
 			Content:   content,
 			Version:   version,
+			MessageID: sql.NullString{String: messageID, Valid: messageID != ""},
+			Missing:   missing,
 		})
 		if txErr != nil {
 			// Rollback the transaction
@@ -136,6 +208,7 @@ func (s *service) Get(ctx context.Context, id string) (File, error) {
 }
 
 func (s *service) GetByPathAndSession(ctx context.Context, path, sessionID string) (File, error) {
+	sessionID, _ = owner(ctx, sessionID)
 	dbFile, err := s.q.GetFileByPathAndSession(ctx, db.GetFileByPathAndSessionParams{
 		Path:      path,
 		SessionID: sessionID,
@@ -197,12 +270,73 @@ func (s *service) DeleteSessionFiles(ctx context.Context, sessionID string) erro
 	return nil
 }
 
+func (s *service) DeleteMessageFiles(ctx context.Context, sessionID string, messageIDs []string) error {
+	files, err := s.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.MessageID == "" || !slices.Contains(messageIDs, file.MessageID) {
+			continue
+		}
+		if err := s.Delete(ctx, file.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *service) Fork(ctx context.Context, sessionID, newSessionID string, messageIDs map[string]string) error {
+	files, err := s.ListBySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.q.WithTx(tx)
+
+	var copied []File
+	for _, file := range files {
+		newMessageID, ok := messageIDs[file.MessageID]
+		if file.MessageID != "" && !ok {
+			continue
+		}
+		dbFile, err := qtx.CopyFile(ctx, db.CopyFileParams{
+			ID:        uuid.New().String(),
+			SessionID: newSessionID,
+			Path:      file.Path,
+			Content:   file.Content,
+			Version:   file.Version,
+			MessageID: sql.NullString{String: newMessageID, Valid: newMessageID != ""},
+			Missing:   file.Missing,
+			CreatedAt: file.CreatedAt,
+			UpdatedAt: file.UpdatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", file.Path, err)
+		}
+		copied = append(copied, s.fromDBItem(dbFile))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for _, file := range copied {
+		s.Publish(pubsub.CreatedEvent, file)
+	}
+	return nil
+}
+
 func (s *service) fromDBItem(item db.File) File {
 	return File{
 		ID:        item.ID,
 		SessionID: item.SessionID,
+		MessageID: item.MessageID.String,
 		Path:      item.Path,
 		Content:   item.Content,
+		Missing:   item.Missing,
 		Version:   item.Version,
 		CreatedAt: item.CreatedAt,
 		UpdatedAt: item.UpdatedAt,
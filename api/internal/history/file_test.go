@@ -0,0 +1,121 @@
+package history
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+func TestFork(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	s := NewService(q, conn)
+
+	sess, err := sessions.Create(ctx, "original")
+	require.NoError(t, err)
+	fork, err := sessions.Create(ctx, "fork")
+	require.NoError(t, err)
+
+	record := func(ctx context.Context, path, content string) {
+		_, err := s.CreateVersion(ctx, sess.ID, path, content)
+		require.NoError(t, err)
+	}
+	record(ctx, "/a.go", "untracked")
+	record(WithMessageID(ctx, "m1"), "/a.go", "one")
+	record(WithMessageID(ctx, "m1"), "/b.go", "one")
+	record(WithMessageID(ctx, "m2"), "/a.go", "two")
+
+	require.NoError(t, s.Fork(ctx, sess.ID, fork.ID, map[string]string{"m1": "c1"}))
+
+	files, err := s.ListBySession(ctx, fork.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	got := make(map[string]string)
+	for _, f := range files {
+		got[f.Path+"@"+f.MessageID] = f.Content
+	}
+	require.Equal(t, map[string]string{
+		"/a.go@":   "untracked",
+		"/a.go@c1": "one",
+		"/b.go@c1": "one",
+	}, got)
+
+	original, err := s.ListBySession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, original, 4)
+}
+
+func TestWithParentTurn(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	s := NewService(q, conn)
+
+	parent, err := sessions.Create(ctx, "parent")
+	require.NoError(t, err)
+	task, err := sessions.CreateTaskSession(ctx, "call", parent.ID, "task")
+	require.NoError(t, err)
+
+	// The sub-agent records under its task session and its own message.
+	subCtx := WithMessageID(WithParentTurn(ctx, parent.ID, "m1"), "task-message")
+	_, err = s.Create(subCtx, task.ID, "/a.go", "before")
+	require.NoError(t, err)
+	_, err = s.CreateVersion(subCtx, task.ID, "/a.go", "after")
+	require.NoError(t, err)
+
+	latest, err := s.GetByPathAndSession(subCtx, "/a.go", task.ID)
+	require.NoError(t, err)
+	require.Equal(t, "after", latest.Content)
+
+	files, err := s.ListBySession(ctx, parent.ID)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, f := range files {
+		require.Equal(t, "m1", f.MessageID)
+	}
+	files, err = s.ListBySession(ctx, task.ID)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestCreateMissing(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	s := NewService(q, conn)
+
+	sess, err := sessions.Create(ctx, "session")
+	require.NoError(t, err)
+	ctx = WithMessageID(ctx, "m1")
+	_, err = s.CreateMissing(ctx, sess.ID, "/new.py")
+	require.NoError(t, err)
+	_, err = s.Create(ctx, sess.ID, "/__init__.py", "")
+	require.NoError(t, err)
+	_, err = s.CreateVersion(ctx, sess.ID, "/new.py", "new")
+	require.NoError(t, err)
+	_, err = s.CreateVersion(ctx, sess.ID, "/__init__.py", "init")
+	require.NoError(t, err)
+
+	files, err := s.ListBySession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Revert{
+		{Path: "/new.py", Before: "", After: "new", Created: true},
+		{Path: "/__init__.py", Before: "", After: "init"},
+	}, PlanRevert(files, map[string]bool{"m1": true}))
+}
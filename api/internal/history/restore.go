@@ -0,0 +1,87 @@
+package history
+
+import "strings"
+
+const restorePrefix = "restore:"
+
+// RestoreMessageID is the message ID recorded for the versions written when
+// the files are restored to the checkpoint of messageID. They tell later
+// restores what the files were left with without counting as changes of the
+// message.
+func RestoreMessageID(messageID string) string {
+	return restorePrefix + messageID
+}
+
+// IsRestore reports whether a version was written by a restore rather than by
+// a tool.
+func (f File) IsRestore() bool {
+	return strings.HasPrefix(f.MessageID, restorePrefix)
+}
+
+// PlanRestore works out how to bring the files back to how they were right
+// after the message messageID. order lists the IDs of the messages of the
+// session in conversation order and files are its versions as returned by
+// Service.ListBySession.
+//
+// A file goes back to the latest version recorded up to the checkpoint, in
+// conversation order; files first changed after it go back to the content
+// they had before that change. Versions recorded before message tracking
+// count as older than any message. Revert.After is the latest version, which
+// the file should still have.
+func PlanRestore(files []File, order []string, messageID string) []Revert {
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	checkpoint, ok := rank[messageID]
+	if !ok {
+		return nil
+	}
+	rankOf := func(f File) (int, bool) {
+		if f.MessageID == "" {
+			return -1, true
+		}
+		r, ok := rank[strings.TrimPrefix(f.MessageID, restorePrefix)]
+		return r, ok
+	}
+
+	type pathState struct {
+		first, target, last *File
+		targetRank          int
+	}
+	var paths []string
+	states := make(map[string]*pathState)
+	for i := range files {
+		file := &files[i]
+		state, ok := states[file.Path]
+		if !ok {
+			state = &pathState{first: file}
+			states[file.Path] = state
+			paths = append(paths, file.Path)
+		}
+		state.last = file
+		// Versions of a path are ordered, so among the versions of one
+		// message the later one wins.
+		if r, ok := rankOf(*file); ok && r <= checkpoint && (state.target == nil || r >= state.targetRank) {
+			state.target = file
+			state.targetRank = r
+		}
+	}
+
+	var reverts []Revert
+	for _, path := range paths {
+		state := states[path]
+		revert := Revert{Path: path, After: state.last.Content}
+		target := state.first
+		if state.target != nil {
+			target = state.target
+		}
+		revert.Before = target.Content
+		revert.Created = target.Missing
+		if revert.Before == revert.After && revert.Created == state.last.Missing {
+			continue
+		}
+		reverts = append(reverts, revert)
+	}
+	return reverts
+}
@@ -0,0 +1,57 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRestore(t *testing.T) {
+	t.Parallel()
+	order := []string{"u1", "m1", "u2", "m2", "u3", "m3"}
+	files := []File{
+		{Path: "/a.go", MessageID: "", Version: 0, Content: "a-old"},
+		{Path: "/a.go", MessageID: "m1", Version: 1, Content: "a1"},
+		{Path: "/a.go", MessageID: "m2", Version: 2, Content: "a2"},
+		{Path: "/b.go", MessageID: "m2", Version: 0, Content: "b0"},
+		{Path: "/b.go", MessageID: "m2", Version: 1, Content: "b2"},
+		{Path: "/c.go", MessageID: "m3", Version: 0, Missing: true},
+		{Path: "/c.go", MessageID: "m3", Version: 1, Content: "c3"},
+		// An empty file that existed, like an __init__.py, is not removed.
+		{Path: "/d.py", MessageID: "m2", Version: 0, Content: ""},
+		{Path: "/d.py", MessageID: "m2", Version: 1, Content: "d2"},
+	}
+
+	require.Equal(t, []Revert{
+		{Path: "/a.go", Before: "a1", After: "a2"},
+		{Path: "/b.go", Before: "b0", After: "b2"},
+		{Path: "/c.go", Before: "", After: "c3", Created: true},
+		{Path: "/d.py", Before: "", After: "d2"},
+	}, PlanRestore(files, order, "m1"))
+	require.Equal(t, []Revert{
+		{Path: "/c.go", Before: "", After: "c3", Created: true},
+	}, PlanRestore(files, order, "m2"))
+	require.Empty(t, PlanRestore(files, order, "m3"))
+	require.Nil(t, PlanRestore(files, order, "missing"))
+
+	// After restoring to m1, going forward to m2 uses the restored content as
+	// the expected current state.
+	restored := append(files,
+		File{Path: "/a.go", MessageID: RestoreMessageID("m1"), Version: 3, Content: "a1"},
+		File{Path: "/b.go", MessageID: RestoreMessageID("m1"), Version: 2, Content: "b0"},
+		File{Path: "/c.go", MessageID: RestoreMessageID("m1"), Version: 2, Missing: true},
+		File{Path: "/d.py", MessageID: RestoreMessageID("m1"), Version: 2, Content: ""},
+	)
+	require.True(t, restored[len(restored)-1].IsRestore())
+	require.Equal(t, []Revert{
+		{Path: "/a.go", Before: "a2", After: "a1"},
+		{Path: "/b.go", Before: "b2", After: "b0"},
+		{Path: "/d.py", Before: "d2", After: ""},
+	}, PlanRestore(restored, order, "m2"))
+	require.Equal(t, []Revert{
+		{Path: "/a.go", Before: "a2", After: "a1"},
+		{Path: "/b.go", Before: "b2", After: "b0"},
+		{Path: "/c.go", Before: "c3", After: ""},
+		{Path: "/d.py", Before: "d2", After: ""},
+	}, PlanRestore(restored, order, "m3"))
+}
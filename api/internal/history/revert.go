@@ -0,0 +1,69 @@
+package history
+
+// Revert says how to undo the changes that some messages made to a file.
+type Revert struct {
+	Path string
+	// Before is the content the file had before the messages changed it.
+	Before string
+	// After is the content the messages left in the file. A file that no
+	// longer has it was changed since, by the user or by something the
+	// history does not track.
+	After string
+	// Created reports that the file did not exist before the messages, so
+	// undoing them removes it. An empty file is not created.
+	Created bool
+}
+
+// PlanRevert works out how to undo the versions recorded by the messages in
+// messageIDs, which should be the latest messages of the session. files are
+// the versions of the session as returned by Service.ListBySession.
+//
+// The tools record the content of a file before changing it the first time
+// in a session, so the state before the messages is the latest version
+// recorded by an earlier message or, when there is none, that first version.
+func PlanRevert(files []File, messageIDs map[string]bool) []Revert {
+	type pathState struct {
+		before, first, last *File
+	}
+	var paths []string
+	states := make(map[string]*pathState)
+	for i := range files {
+		file := &files[i]
+		state, ok := states[file.Path]
+		if !ok {
+			state = &pathState{}
+			states[file.Path] = state
+			paths = append(paths, file.Path)
+		}
+		state.last = file
+		if !messageIDs[file.MessageID] {
+			if state.first == nil {
+				state.before = file
+			}
+			continue
+		}
+		if state.first == nil {
+			state.first = file
+		}
+	}
+
+	var reverts []Revert
+	for _, path := range paths {
+		state := states[path]
+		if state.first == nil {
+			continue
+		}
+		revert := Revert{Path: path, After: state.last.Content}
+		before := state.first
+		if state.before != nil {
+			before = state.before
+		}
+		revert.Before = before.Content
+		revert.Created = before.Missing
+		if revert.Before == revert.After && revert.Created == state.last.Missing {
+			continue
+		}
+		reverts = append(reverts, revert)
+	}
+	return reverts
+}
@@ -0,0 +1,40 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRevert(t *testing.T) {
+	t.Parallel()
+	files := []File{
+		// Changed by a kept message, then by a discarded one.
+		{Path: "/a.go", MessageID: "m1", Version: 0, Content: "a0"},
+		{Path: "/a.go", MessageID: "m1", Version: 1, Content: "a1"},
+		{Path: "/a.go", MessageID: "m2", Version: 2, Content: "a2"},
+		{Path: "/a.go", MessageID: "m3", Version: 3, Content: "a3"},
+		// First changed by a discarded message.
+		{Path: "/b.go", MessageID: "m2", Version: 0, Content: "b0"},
+		{Path: "/b.go", MessageID: "m2", Version: 1, Content: "b1"},
+		// Created by a discarded message.
+		{Path: "/c.go", MessageID: "m3", Version: 0, Missing: true},
+		{Path: "/c.go", MessageID: "m3", Version: 1, Content: "c1"},
+		// Empty before a discarded message changed it, like an __init__.py.
+		{Path: "/e.py", MessageID: "m3", Version: 0, Content: ""},
+		{Path: "/e.py", MessageID: "m3", Version: 1, Content: "e1"},
+		// Only changed by a kept message.
+		{Path: "/d.go", MessageID: "m1", Version: 0, Content: "d0"},
+		{Path: "/d.go", MessageID: "m1", Version: 1, Content: "d1"},
+	}
+
+	reverts := PlanRevert(files, map[string]bool{"m2": true, "m3": true})
+	require.Equal(t, []Revert{
+		{Path: "/a.go", Before: "a1", After: "a3"},
+		{Path: "/b.go", Before: "b0", After: "b1"},
+		{Path: "/c.go", Before: "", After: "c1", Created: true},
+		{Path: "/e.py", Before: "", After: "e1"},
+	}, reverts)
+
+	require.Empty(t, PlanRevert(files, map[string]bool{"m4": true}))
+}
@@ -4,16 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
 	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
 	"github.com/upperxcode/jx2ai-agent/api/internal/message"
 	"github.com/upperxcode/jx2ai-agent/api/internal/session"
 )
 
 type agentTool struct {
-	agent    Service
+	agents   []config.Agent
+	newAgent func(config.Agent) (Service, error)
 	sessions session.Service
 	messages message.Service
+
+	// Sub-agents are built on their first call and reused after, so each
+	// one keeps a single set of providers and event subscriptions.
+	built   map[string]Service
+	builtMu sync.Mutex
 }
 
 const (
@@ -22,6 +33,7 @@ const (
 
 type AgentParams struct {
 	Prompt string `json:"prompt"`
+	Agent  string `json:"agent,omitempty"`
 }
 
 func (b *agentTool) Name() string {
@@ -29,19 +41,70 @@ func (b *agentTool) Name() string {
 }
 
 func (b *agentTool) Info() tools.ToolInfo {
+	description := fmt.Sprintf("Launch a new agent that has access to %s. When you are searching for a keyword or file and are not confident that you will find the right match on the first try, use the agent tool to perform the search for you. For example:\n\n- If you are searching for a keyword like \"config\" or \"logger\", or for questions like \"which file does X?\", the agent tool is strongly recommended\n- If you want to read a specific file path, use the view or glob tool instead of the agent tool, to find the match more quickly\n- If you are searching for a specific class definition like \"class Foo\", use the glob tool instead, to find the match more quickly\n\nUsage notes:\n1. Launch multiple agents concurrently whenever possible, to maximize performance; to do that, use a single message with multiple tool uses\n2. When the agent is done, it will return a single message back to you. The result returned by the agent is not visible to the user. To show the user the result, you should send a text message back to the user with a concise summary of the result.\n3. Each agent invocation is stateless. You will not be able to send additional messages to the agent, nor will the agent be able to communicate with you outside of its final report. Therefore, your prompt should contain a highly detailed task description for the agent to perform autonomously and you should specify exactly what information the agent should return back to you in its final and only message to you.\n4. The agent's outputs should generally be trusted", agentToolsDescription(b.agents[0]))
+	if denied := deniedFileTools(b.agents[0]); len(denied) > 0 {
+		description += fmt.Sprintf("\n5. IMPORTANT: The %s agent can not use %s", b.agents[0].ID, strings.Join(denied, ", "))
+		if len(denied) == len(fileTools) {
+			description += ", so can not modify files"
+		}
+		description += ". If you want to use these tools, use them directly instead of going through the agent."
+	}
+
+	ids := make([]string, len(b.agents))
+	var others strings.Builder
+	for i, agent := range b.agents {
+		ids[i] = agent.ID
+		if i > 0 {
+			fmt.Fprintf(&others, "\n- %s: %s (has access to %s)", agent.ID, agent.Description, agentToolsDescription(agent))
+		}
+	}
+	if others.Len() > 0 {
+		description += fmt.Sprintf("\n\nBesides the default %s agent, the following specialized agents are available. Choose one with the agent parameter when the task matches its description:", ids[0]) + others.String()
+	}
+
 	return tools.ToolInfo{
 		Name:        AgentToolName,
-		Description: "Launch a new agent that has access to the following tools: GlobTool, GrepTool, LS, View. When you are searching for a keyword or file and are not confident that you will find the right match on the first try, use the Agent tool to perform the search for you. For example:\n\n- If you are searching for a keyword like \"config\" or \"logger\", or for questions like \"which file does X?\", the Agent tool is strongly recommended\n- If you want to read a specific file path, use the View or GlobTool tool instead of the Agent tool, to find the match more quickly\n- If you are searching for a specific class definition like \"class Foo\", use the GlobTool tool instead, to find the match more quickly\n\nUsage notes:\n1. Launch multiple agents concurrently whenever possible, to maximize performance; to do that, use a single message with multiple tool uses\n2. When the agent is done, it will return a single message back to you. The result returned by the agent is not visible to the user. To show the user the result, you should send a text message back to the user with a concise summary of the result.\n3. Each agent invocation is stateless. You will not be able to send additional messages to the agent, nor will the agent be able to communicate with you outside of its final report. Therefore, your prompt should contain a highly detailed task description for the agent to perform autonomously and you should specify exactly what information the agent should return back to you in its final and only message to you.\n4. The agent's outputs should generally be trusted\n5. IMPORTANT: The agent can not use Bash, Replace, Edit, so can not modify files. If you want to use these tools, use them directly instead of going through the agent.",
+		Description: description,
 		Parameters: map[string]any{
 			"prompt": map[string]any{
 				"type":        "string",
 				"description": "The task for the agent to perform",
 			},
+			"agent": map[string]any{
+				"type":        "string",
+				"description": fmt.Sprintf("The agent to launch (default: %s)", ids[0]),
+				"enum":        ids,
+			},
 		},
 		Required: []string{"prompt"},
 	}
 }
 
+// fileTools are the tools an agent needs to modify files.
+var fileTools = []string{tools.BashToolName, tools.EditToolName, tools.MultiEditToolName, tools.WriteToolName}
+
+// agentToolsDescription lists the tools the agent can use, as shown in the
+// agent tool description.
+func agentToolsDescription(agent config.Agent) string {
+	switch {
+	case agent.AllowedTools == nil:
+		return "all tools"
+	case len(agent.AllowedTools) == 0:
+		return "no tools"
+	}
+	return "the following tools: " + strings.Join(agent.AllowedTools, ", ")
+}
+
+// deniedFileTools returns the file modifying tools the agent can not use.
+func deniedFileTools(agent config.Agent) []string {
+	if agent.AllowedTools == nil {
+		return nil
+	}
+	return slices.DeleteFunc(slices.Clone(fileTools), func(name string) bool {
+		return slices.Contains(agent.AllowedTools, name)
+	})
+}
+
 func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
 	var params AgentParams
 	if err := json.Unmarshal([]byte(call.Input), &params); err != nil {
@@ -51,6 +114,14 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 		return tools.NewTextErrorResponse("prompt is required"), nil
 	}
 
+	if params.Agent == "" {
+		params.Agent = b.agents[0].ID
+	}
+	i := slices.IndexFunc(b.agents, func(agent config.Agent) bool { return agent.ID == params.Agent })
+	if i < 0 {
+		return tools.NewTextErrorResponse(fmt.Sprintf("unknown agent %q", params.Agent)), nil
+	}
+
 	sessionID, messageID := tools.GetContextValues(ctx)
 	if sessionID == "" || messageID == "" {
 		return tools.ToolResponse{}, fmt.Errorf("session_id and message_id are required")
@@ -61,7 +132,14 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 		return tools.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
 	}
 
-	done, err := b.agent.Run(ctx, session.ID, params.Prompt)
+	agent, err := b.subAgent(b.agents[i])
+	if err != nil {
+		return tools.ToolResponse{}, err
+	}
+	// Files edited by the sub-agent are part of the calling turn, so that
+	// rewinding or restoring the parent session undoes them too.
+	ctx = history.WithParentTurn(ctx, sessionID, messageID)
+	done, err := agent.Run(ctx, session.ID, params.Prompt)
 	if err != nil {
 		return tools.ToolResponse{}, fmt.Errorf("error generating agent: %s", err)
 	}
@@ -85,6 +163,8 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 	}
 
 	parentSession.Cost += updatedSession.Cost
+	parentSession.PromptTokens += updatedSession.PromptTokens
+	parentSession.CompletionTokens += updatedSession.CompletionTokens
 
 	_, err = b.sessions.Save(ctx, parentSession)
 	if err != nil {
@@ -93,14 +173,47 @@ func (b *agentTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolRes
 	return tools.NewTextResponse(response.Content().String()), nil
 }
 
-func NewAgentTool(
-	agent Service,
+// subAgent returns the sub-agent of cfg, building it on its first call.
+func (b *agentTool) subAgent(cfg config.Agent) (Service, error) {
+	b.builtMu.Lock()
+	defer b.builtMu.Unlock()
+	if agent, ok := b.built[cfg.ID]; ok {
+		return agent, nil
+	}
+	agent, err := b.newAgent(cfg)
+	if err != nil {
+		return nil, err
+	}
+	b.built[cfg.ID] = agent
+	return agent, nil
+}
+
+// updateModel makes the sub-agents built so far use the models now selected.
+func (b *agentTool) updateModel() error {
+	b.builtMu.Lock()
+	defer b.builtMu.Unlock()
+	for _, agent := range b.built {
+		if err := agent.UpdateModel(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newAgentTool returns the tool that runs a prompt in a sub-agent, one of
+// agents, in a new task session; newAgent creates the sub-agent on its first
+// call. The first agent is the default one.
+func newAgentTool(
+	agents []config.Agent,
+	newAgent func(config.Agent) (Service, error),
 	sessions session.Service,
 	messages message.Service,
-) tools.BaseTool {
+) *agentTool {
 	return &agentTool{
+		agents:   agents,
+		newAgent: newAgent,
 		sessions: sessions,
 		messages: messages,
-		agent:    agent,
+		built:    make(map[string]Service),
 	}
 }
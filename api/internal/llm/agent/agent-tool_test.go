@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+)
+
+func TestAgentToolInfo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("read-only default agent", func(t *testing.T) {
+		t.Parallel()
+		tool := newAgentTool([]config.Agent{
+			{ID: "task", AllowedTools: []string{"glob", "view"}},
+			{ID: "fixer", Description: "Fixes lint errors.", AllowedTools: []string{"view", "edit"}},
+		}, nil, nil, nil)
+		description := tool.Info().Description
+		require.Contains(t, description, "has access to the following tools: glob, view.")
+		require.Contains(t, description, "The task agent can not use bash, edit, multiedit, write, so can not modify files.")
+		require.Contains(t, description, "- fixer: Fixes lint errors. (has access to the following tools: view, edit)")
+	})
+
+	t.Run("default agent that can edit", func(t *testing.T) {
+		t.Parallel()
+		tool := newAgentTool([]config.Agent{{ID: "task", AllowedTools: []string{"view", "edit", "multiedit", "write"}}}, nil, nil, nil)
+		description := tool.Info().Description
+		require.Contains(t, description, "The task agent can not use bash. ")
+		require.NotContains(t, description, "can not modify files")
+	})
+
+	t.Run("every tool", func(t *testing.T) {
+		t.Parallel()
+		tool := newAgentTool([]config.Agent{{ID: "task"}}, nil, nil, nil)
+		description := tool.Info().Description
+		require.Contains(t, description, "has access to all tools.")
+		require.NotContains(t, description, "can not use")
+	})
+}
@@ -34,6 +34,7 @@ const (
 	AgentEventTypeError     AgentEventType = "error"
 	AgentEventTypeResponse  AgentEventType = "response"
 	AgentEventTypeSummarize AgentEventType = "summarize"
+	AgentEventTypeWarning   AgentEventType = "warning"
 )
 
 type AgentEvent struct {
@@ -45,12 +46,21 @@ type AgentEvent struct {
 	SessionID string
 	Progress  string
 	Done      bool
+
+	// When warning
+	Warning string
 }
 
 type Service interface {
 	pubsub.Suscriber[AgentEvent]
 	Model() catwalk.Model
 	Run(ctx context.Context, sessionID string, content string, attachments ...message.Attachment) (<-chan AgentEvent, error)
+	// Edit replaces the user message messageID with content, keeping its
+	// attachments, discards the later messages and runs the prompt again.
+	// The caller undoes what the discarded messages did in undo, which is
+	// called once they are discarded and before the prompt runs; an error from
+	// it stops the edit.
+	Edit(ctx context.Context, sessionID, messageID, content string, undo func(discarded []message.Message) error) (<-chan AgentEvent, error)
 	Cancel(sessionID string)
 	CancelAll()
 	IsSessionBusy(sessionID string) bool
@@ -71,12 +81,15 @@ type agent struct {
 	mcpTools    *csync.Map[string, tools.BaseTool]
 	lspClients  *csync.Map[string, *lsp.Client]
 
-	// We need this to be able to update it when model changes
-	agentToolFn  func() (tools.BaseTool, error)
+	// Runs the sub-agents, nil when the agent can't delegate. Kept to update
+	// their models along with this agent's.
+	agentTool    *agentTool
 	cleanupFuncs []func()
 
 	provider   provider.Provider
 	providerID string
+	// Tried in order when a turn fails on provider, see config.SelectedModel.
+	fallbacks []modelProvider
 
 	titleProvider       provider.Provider
 	summarizeProvider   provider.Provider
@@ -86,11 +99,110 @@ type agent struct {
 	promptQueue    *csync.Map[string, []string]
 }
 
+// modelProvider is a provider along with the ID of its config.
+type modelProvider struct {
+	provider   provider.Provider
+	providerID string
+}
+
+// providerError is an error reported by the provider while streaming a
+// response, as opposed to one of the agent itself.
+type providerError struct {
+	err error
+}
+
+func (e *providerError) Error() string { return e.err.Error() }
+func (e *providerError) Unwrap() error { return e.err }
+
 var agentPromptMap = map[string]prompt.PromptID{
 	"coder": prompt.PromptCoder,
 	"task":  prompt.PromptTask,
 }
 
+// agentSystemPrompt returns the system prompt of the agent: the prompt file of
+// a user defined agent or the built-in prompt of coder and task, followed by
+// the context files of the agent.
+func agentSystemPrompt(agentCfg config.Agent, providerID string) (string, error) {
+	if agentCfg.Prompt != "" {
+		systemPrompt, err := prompt.CustomPrompt(agentCfg.Prompt, agentCfg.ContextPaths...)
+		if err != nil {
+			return "", fmt.Errorf("prompt of agent %s: %w", agentCfg.ID, err)
+		}
+		return systemPrompt, nil
+	}
+	promptID := agentPromptMap[agentCfg.ID]
+	if promptID == "" {
+		promptID = prompt.PromptDefault
+	}
+	return prompt.GetPrompt(promptID, providerID, agentCfg.ContextPaths...), nil
+}
+
+// fallbackProviders creates the providers of the fallback models of the model
+// used by the agent. Fallbacks whose provider or model is not configured are
+// skipped.
+func fallbackProviders(agentCfg config.Agent) ([]modelProvider, error) {
+	cfg := config.Get()
+	var fallbacks []modelProvider
+	for _, fallback := range cfg.Models[agentCfg.Model].Fallbacks {
+		providerCfg, ok := cfg.Providers.Get(fallback.Provider)
+		if !ok || cfg.GetModel(fallback.Provider, fallback.Model) == nil {
+			slog.Warn("Skipping fallback model not found in config", "agent", agentCfg.ID, "provider", fallback.Provider, "model", fallback.Model)
+			continue
+		}
+		systemPrompt, err := agentSystemPrompt(agentCfg, providerCfg.ID)
+		if err != nil {
+			return nil, err
+		}
+		fallbackProvider, err := provider.NewProvider(providerCfg,
+			provider.WithModel(agentCfg.Model),
+			provider.WithSelectedModel(fallback),
+			provider.WithSystemMessage(systemPrompt),
+		)
+		if err != nil {
+			slog.Warn("Skipping fallback model", "agent", agentCfg.ID, "provider", fallback.Provider, "model", fallback.Model, "error", err)
+			continue
+		}
+		fallbacks = append(fallbacks, modelProvider{provider: fallbackProvider, providerID: providerCfg.ID})
+	}
+	return fallbacks, nil
+}
+
+// allowedLSPClients returns the LSP clients the agent may use. The clients are
+// all started before the agents are created, so a copy is enough.
+func allowedLSPClients(lspClients *csync.Map[string, *lsp.Client], agentCfg config.Agent) *csync.Map[string, *lsp.Client] {
+	if agentCfg.AllowedLSP == nil {
+		return lspClients
+	}
+	allowed := csync.NewMap[string, *lsp.Client]()
+	for name, client := range lspClients.Seq2() {
+		if agentCfg.LSPAllowed(name) {
+			allowed.Set(name, client)
+		}
+	}
+	return allowed
+}
+
+// subAgentConfigs returns the agents that the agent tool of the agent parentID
+// can start: task first, then the user defined agents other than the parent.
+// Sub-agents can not start agents of their own.
+func subAgentConfigs(cfg *config.Config, parentID string) []config.Agent {
+	var agents []config.Agent
+	if task, ok := cfg.Agents["task"]; ok {
+		agents = append(agents, task)
+	}
+	for _, agent := range cfg.CustomAgents() {
+		if agent.ID != parentID {
+			agents = append(agents, agent)
+		}
+	}
+	for i, agent := range agents {
+		agents[i].AllowedTools = slices.DeleteFunc(slices.Clone(agent.AllowedTools), func(name string) bool {
+			return name == AgentToolName
+		})
+	}
+	return agents
+}
+
 func NewAgent(
 	ctx context.Context,
 	agentCfg config.Agent,
@@ -103,20 +215,19 @@ func NewAgent(
 ) (Service, error) {
 	cfg := config.Get()
 
-	var agentToolFn func() (tools.BaseTool, error)
-	if agentCfg.ID == "coder" && slices.Contains(agentCfg.AllowedTools, AgentToolName) {
-		agentToolFn = func() (tools.BaseTool, error) {
-			taskAgentCfg := config.Get().Agents["task"]
-			if taskAgentCfg.ID == "" {
-				return nil, fmt.Errorf("task agent not found in config")
-			}
-			taskAgent, err := NewAgent(ctx, taskAgentCfg, permissions, sessions, messages, history, lspClients)
+	var subAgentTool *agentTool
+	if subAgents := subAgentConfigs(cfg, agentCfg.ID); len(subAgents) > 0 && slices.Contains(agentCfg.AllowedTools, AgentToolName) {
+		newAgent := func(subAgentCfg config.Agent) (Service, error) {
+			subAgent, err := NewAgent(ctx, subAgentCfg, permissions, sessions, messages, history, lspClients)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create task agent: %w", err)
+				return nil, fmt.Errorf("failed to create %s agent: %w", subAgentCfg.ID, err)
 			}
-			return NewAgentTool(taskAgent, sessions, messages), nil
+			return subAgent, nil
 		}
+		subAgentTool = newAgentTool(subAgents, newAgent, sessions, messages)
 	}
+	// Sub-agents get the LSP clients allowed by their own config.
+	agentLSPClients := allowedLSPClients(lspClients, agentCfg)
 
 	providerCfg := config.Get().GetProviderForModel(agentCfg.Model)
 	if providerCfg == nil {
@@ -128,18 +239,22 @@ func NewAgent(
 		return nil, fmt.Errorf("model not found for agent %s", agentCfg.Name)
 	}
 
-	promptID := agentPromptMap[agentCfg.ID]
-	if promptID == "" {
-		promptID = prompt.PromptDefault
+	systemPrompt, err := agentSystemPrompt(agentCfg, providerCfg.ID)
+	if err != nil {
+		return nil, err
 	}
 	opts := []provider.ProviderClientOption{
 		provider.WithModel(agentCfg.Model),
-		provider.WithSystemMessage(prompt.GetPrompt(promptID, providerCfg.ID, config.Get().Options.ContextPaths...)),
+		provider.WithSystemMessage(systemPrompt),
 	}
 	agentProvider, err := provider.NewProvider(*providerCfg, opts...)
 	if err != nil {
 		return nil, err
 	}
+	fallbacks, err := fallbackProviders(agentCfg)
+	if err != nil {
+		return nil, err
+	}
 
 	smallModelCfg := cfg.Models[config.SelectedModelTypeSmall]
 	var smallModelProviderCfg *config.ProviderConfig
@@ -187,15 +302,15 @@ func NewAgent(
 		for _, tool := range []tools.BaseTool{
 			tools.NewBashTool(permissions, cwd, cfg.Options.Attribution),
 			tools.NewDownloadTool(permissions, cwd),
-			tools.NewEditTool(lspClients, permissions, history, cwd),
-			tools.NewMultiEditTool(lspClients, permissions, history, cwd),
+			tools.NewEditTool(agentLSPClients, permissions, history, cwd),
+			tools.NewMultiEditTool(agentLSPClients, permissions, history, cwd),
 			tools.NewFetchTool(permissions, cwd),
-			tools.NewGlobTool(cwd),
-			tools.NewGrepTool(cwd),
+			tools.NewGlobTool(permissions, cwd),
+			tools.NewGrepTool(permissions, cwd),
 			tools.NewLsTool(permissions, cwd),
 			tools.NewSourcegraphTool(),
-			tools.NewViewTool(lspClients, permissions, cwd),
-			tools.NewWriteTool(lspClients, permissions, history, cwd),
+			tools.NewViewTool(agentLSPClients, permissions, cwd),
+			tools.NewWriteTool(agentLSPClients, permissions, history, cwd),
 		} {
 			result[tool.Name()] = tool
 		}
@@ -207,10 +322,10 @@ func NewAgent(
 			slog.Info("Initialized agent mcp tools", "agent", agentCfg.ID)
 		}()
 
-		mcpToolsOnce.Do(func() {
-			doGetMCPTools(ctx, permissions, cfg)
-		})
-
+		if agentCfg.AllowedMCP != nil && len(agentCfg.AllowedMCP) == 0 {
+			return map[string]tools.BaseTool{}
+		}
+		GetMCPTools(ctx, permissions, cfg)
 		return maps.Collect(mcpTools.Seq2())
 	}
 
@@ -219,18 +334,19 @@ func NewAgent(
 		agentCfg:            agentCfg,
 		provider:            agentProvider,
 		providerID:          string(providerCfg.ID),
+		fallbacks:           fallbacks,
 		messages:            messages,
 		sessions:            sessions,
 		titleProvider:       titleProvider,
 		summarizeProvider:   summarizeProvider,
 		summarizeProviderID: string(providerCfg.ID),
-		agentToolFn:         agentToolFn,
+		agentTool:           subAgentTool,
 		activeRequests:      csync.NewMap[string, context.CancelFunc](),
 		mcpTools:            csync.NewLazyMap(mcpToolsFn),
 		baseTools:           csync.NewLazyMap(baseToolsFn),
 		promptQueue:         csync.NewMap[string, []string](),
 		permissions:         permissions,
-		lspClients:          lspClients,
+		lspClients:          agentLSPClients,
 	}
 	a.setupEvents(ctx)
 	return a, nil
@@ -346,10 +462,11 @@ func (a *agent) err(err error) AgentEvent {
 }
 
 func (a *agent) Run(ctx context.Context, sessionID string, content string, attachments ...message.Attachment) (<-chan AgentEvent, error) {
-	if !a.Model().SupportsImages && attachments != nil {
-		attachments = nil
+	if !a.Model().SupportsImages {
+		attachments = slices.DeleteFunc(attachments, func(a message.Attachment) bool {
+			return !a.IsText()
+		})
 	}
-	events := make(chan AgentEvent, 1)
 	if a.IsSessionBusy(sessionID) {
 		existing, ok := a.promptQueue.Get(sessionID)
 		if !ok {
@@ -360,6 +477,23 @@ func (a *agent) Run(ctx context.Context, sessionID string, content string, attac
 		return nil, nil
 	}
 
+	var attachmentParts []message.ContentPart
+	for _, attachment := range attachments {
+		if attachment.IsText() {
+			attachmentParts = append(attachmentParts, message.TextContent{
+				Text: fmt.Sprintf("<file path=%q>\n%s\n</file>", attachment.FilePath, attachment.Content),
+			})
+			continue
+		}
+		attachmentParts = append(attachmentParts, message.BinaryContent{Path: attachment.FilePath, MIMEType: attachment.MimeType, Data: attachment.Content})
+	}
+	return a.start(ctx, sessionID, content, attachmentParts), nil
+}
+
+// start runs the prompt in the background and returns the channel that
+// receives its result.
+func (a *agent) start(ctx context.Context, sessionID, content string, attachmentParts []message.ContentPart) <-chan AgentEvent {
+	events := make(chan AgentEvent, 1)
 	genCtx, cancel := context.WithCancel(ctx)
 	a.activeRequests.Set(sessionID, cancel)
 	startTime := time.Now()
@@ -369,10 +503,6 @@ func (a *agent) Run(ctx context.Context, sessionID string, content string, attac
 		defer log.RecoverPanic("agent.Run", func() {
 			events <- a.err(fmt.Errorf("panic while running the agent"))
 		})
-		var attachmentParts []message.ContentPart
-		for _, attachment := range attachments {
-			attachmentParts = append(attachmentParts, message.BinaryContent{Path: attachment.FilePath, MIMEType: attachment.MimeType, Data: attachment.Content})
-		}
 		result := a.processGeneration(genCtx, sessionID, content, attachmentParts)
 		if result.Error != nil {
 			if isCancelledErr(result.Error) {
@@ -392,18 +522,70 @@ func (a *agent) Run(ctx context.Context, sessionID string, content string, attac
 		close(events)
 	}()
 	a.eventPromptSent(sessionID)
-	return events, nil
+	return events
+}
+
+func (a *agent) Edit(ctx context.Context, sessionID, messageID, content string, undo func(discarded []message.Message) error) (<-chan AgentEvent, error) {
+	if a.IsSessionBusy(sessionID) {
+		return nil, ErrSessionBusy
+	}
+	msg, err := a.messages.Get(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if msg.SessionID != sessionID || msg.Role != message.User {
+		return nil, fmt.Errorf("message %s is not a user message of session %s", messageID, sessionID)
+	}
+	// Everything but the prompt text: the attachments and, for text files,
+	// their inlined content.
+	var attachmentParts []message.ContentPart
+	for i, part := range msg.Parts {
+		switch part.(type) {
+		case message.TextContent:
+			if i == 0 {
+				continue
+			}
+		case message.BinaryContent:
+			if !a.Model().SupportsImages {
+				continue
+			}
+		default:
+			continue
+		}
+		attachmentParts = append(attachmentParts, part)
+	}
+
+	deleted, err := a.messages.DeleteFrom(ctx, sessionID, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discard messages: %w", err)
+	}
+	sess, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if slices.ContainsFunc(deleted, func(m message.Message) bool { return m.ID == sess.SummaryMessageID }) {
+		sess.SummaryMessageID = ""
+		if _, err := a.sessions.Save(ctx, sess); err != nil {
+			return nil, fmt.Errorf("failed to save session: %w", err)
+		}
+	}
+	if undo != nil {
+		if err := undo(deleted); err != nil {
+			return nil, err
+		}
+	}
+	return a.start(ctx, sessionID, content, attachmentParts), nil
 }
 
 func (a *agent) processGeneration(ctx context.Context, sessionID, content string, attachmentParts []message.ContentPart) AgentEvent {
 	cfg := config.Get()
 	// List existing messages; if none, start title generation asynchronously.
-	msgs, err := a.messages.List(ctx, sessionID)
+	msgs, err := a.historyMessages(ctx, sessionID)
 	if err != nil {
-		return a.err(fmt.Errorf("failed to list messages: %w", err))
+		return a.err(err)
 	}
 	if len(msgs) == 0 {
-		go func() {
+		go func(ctx context.Context) {
 			defer log.RecoverPanic("agent.Run", func() {
 				slog.Error("panic while generating title")
 			})
@@ -411,24 +593,29 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			if titleErr != nil && !errors.Is(titleErr, context.Canceled) && !errors.Is(titleErr, context.DeadlineExceeded) {
 				slog.Error("failed to generate title", "error", titleErr)
 			}
-		}()
-	}
-	session, err := a.sessions.Get(ctx, sessionID)
-	if err != nil {
-		return a.err(fmt.Errorf("failed to get session: %w", err))
+		}(ctx)
 	}
-	if session.SummaryMessageID != "" {
-		summaryMsgInex := -1
-		for i, msg := range msgs {
-			if msg.ID == session.SummaryMessageID {
-				summaryMsgInex = i
-				break
-			}
-		}
-		if summaryMsgInex != -1 {
-			msgs = msgs[summaryMsgInex:]
-			msgs[0].Role = message.User
+
+	// Sub-agents share the budget of the prompt that started them.
+	budget, ok := budgetFromContext(ctx)
+	if !ok {
+		session, err := a.sessions.Get(ctx, sessionID)
+		if err != nil {
+			return a.err(fmt.Errorf("failed to get session: %w", err))
 		}
+		budget = newBudgetTracker(cfg.Options.Budget, session)
+		ctx = budget.withContext(ctx)
+	}
+	if exceeded, desc := budget.exceeded(); exceeded {
+		return a.err(fmt.Errorf("%w: %s", ErrBudgetExceeded, desc))
+	}
+
+	// Summarize a session left close to the context window by earlier prompts
+	// before adding the new one.
+	if summarized, ok, err := a.autoSummarize(ctx, sessionID); err != nil {
+		return a.summarizeErr(ctx, err)
+	} else if ok {
+		msgs = summarized
 	}
 
 	userMsg, err := a.createUserMessage(ctx, sessionID, content, attachmentParts)
@@ -437,6 +624,7 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 	}
 	// Append the new user message to the conversation history.
 	msgHistory := append(msgs, userMsg)
+	guard := newLoopGuard(cfg.Options.MaxTurns, cfg.Options.MaxRepeatedToolCalls)
 
 	for {
 		// Check for cancellation before each iteration
@@ -458,12 +646,52 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 		if cfg.Options.Debug {
 			slog.Info("Result", "message", agentMessage.FinishReason(), "toolResults", toolResults)
 		}
+		if warn, desc := budget.warn(); warn {
+			a.Publish(pubsub.CreatedEvent, AgentEvent{
+				Type:      AgentEventTypeWarning,
+				SessionID: budget.sessionID,
+				Warning:   "Budget almost exhausted: " + desc,
+			})
+		}
+		budgetExceeded, budgetDesc := budget.exceeded()
 		if (agentMessage.FinishReason() == message.FinishReasonToolUse) && toolResults != nil {
 			// We are not done, we need to respond with the tool response
 			msgHistory = append(msgHistory, agentMessage, *toolResults)
+			if budgetExceeded {
+				slog.Warn("Stopping agent loop over budget", "session_id", sessionID, "budget", budgetDesc)
+				a.finishMessage(context.Background(), &agentMessage, message.FinishReasonBudgetExceeded, "Stopped: budget exceeded ("+budgetDesc+")", "")
+				return AgentEvent{
+					Type:    AgentEventTypeResponse,
+					Message: agentMessage,
+					Done:    true,
+				}
+			}
+			if reason, notice := guard.check(agentMessage.ToolCalls()); reason != "" {
+				slog.Warn("Stopping runaway agent loop", "session_id", sessionID, "reason", reason, "notice", notice)
+				a.finishMessage(context.Background(), &agentMessage, reason, notice, "")
+				return AgentEvent{
+					Type:    AgentEventTypeResponse,
+					Message: agentMessage,
+					Done:    true,
+				}
+			}
+			summarized, ok, err := a.autoSummarize(ctx, sessionID)
+			if err != nil {
+				return a.summarizeErr(ctx, err)
+			}
+			if ok {
+				// The summary replaces the history, so ask again for the
+				// request that was in flight to finish the turn.
+				userMsg, err := a.createUserMessage(ctx, sessionID, fmt.Sprintf(autoSummarizeContinuePrompt, content), nil)
+				if err != nil {
+					return a.err(fmt.Errorf("failed to create user message: %w", err))
+				}
+				msgHistory = append(summarized, userMsg)
+			}
 			// If there are queued prompts, process the next one
 			nextPrompt, ok := a.promptQueue.Take(sessionID)
 			if ok {
+				guard.reset()
 				for _, prompt := range nextPrompt {
 					// Create a new user message for the queued prompt
 					userMsg, err := a.createUserMessage(ctx, sessionID, prompt, nil)
@@ -476,9 +704,18 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 			}
 
 			continue
-		} else if agentMessage.FinishReason() == message.FinishReasonEndTurn {
+		} else if agentMessage.FinishReason() == message.FinishReasonEndTurn && !budgetExceeded {
+			// Queued prompts wait for the next request when over budget.
 			queuePrompts, ok := a.promptQueue.Take(sessionID)
 			if ok {
+				guard.reset()
+				summarized, ok, err := a.autoSummarize(ctx, sessionID)
+				if err != nil {
+					return a.summarizeErr(ctx, err)
+				}
+				if ok {
+					msgHistory = summarized
+				}
 				for _, prompt := range queuePrompts {
 					if prompt == "" {
 						continue
@@ -506,6 +743,30 @@ func (a *agent) processGeneration(ctx context.Context, sessionID, content string
 	}
 }
 
+// historyMessages returns the session messages sent to the provider: all of
+// them, or only those from the summary onwards once the session has been
+// summarized, with the summary acting as the first user message.
+func (a *agent) historyMessages(ctx context.Context, sessionID string) ([]message.Message, error) {
+	msgs, err := a.messages.List(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	session, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.SummaryMessageID != "" {
+		summaryMsgIndex := slices.IndexFunc(msgs, func(msg message.Message) bool {
+			return msg.ID == session.SummaryMessageID
+		})
+		if summaryMsgIndex != -1 {
+			msgs = msgs[summaryMsgIndex:]
+			msgs[0].Role = message.User
+		}
+	}
+	return msgs, nil
+}
+
 func (a *agent) createUserMessage(ctx context.Context, sessionID, content string, attachmentParts []message.ContentPart) (message.Message, error) {
 	parts := []message.ContentPart{message.TextContent{Text: content}}
 	parts = append(parts, attachmentParts...)
@@ -522,18 +783,16 @@ func (a *agent) getAllTools() ([]tools.BaseTool, error) {
 			allTools = append(allTools, tool)
 		}
 	}
-	if a.agentCfg.ID == "coder" {
-		allTools = slices.AppendSeq(allTools, a.mcpTools.Seq())
-		if a.lspClients.Len() > 0 {
-			allTools = append(allTools, tools.NewDiagnosticsTool(a.lspClients))
+	for tool := range a.mcpTools.Seq() {
+		if mcpTool, ok := tool.(*McpTool); !ok || a.agentCfg.MCPToolAllowed(mcpTool.mcpName, mcpTool.tool.Name) {
+			allTools = append(allTools, tool)
 		}
 	}
-	if a.agentToolFn != nil {
-		agentTool, agentToolErr := a.agentToolFn()
-		if agentToolErr != nil {
-			return nil, agentToolErr
-		}
-		allTools = append(allTools, agentTool)
+	if a.lspClients.Len() > 0 {
+		allTools = append(allTools, tools.NewDiagnosticsTool(a.lspClients))
+	}
+	if a.agentTool != nil {
+		allTools = append(allTools, a.agentTool)
 	}
 	return allTools, nil
 }
@@ -556,133 +815,54 @@ func (a *agent) streamAndHandleEvents(ctx context.Context, sessionID string, msg
 	if toolsErr != nil {
 		return assistantMsg, nil, toolsErr
 	}
-	// Now collect tools (which may block on MCP initialization)
-	eventChan := a.provider.StreamResponse(ctx, msgHistory, allTools)
 
 	// Add the session and message ID into the context if needed by tools.
 	ctx = context.WithValue(ctx, tools.MessageIDContextKey, assistantMsg.ID)
+	ctx = history.WithMessageID(ctx, assistantMsg.ID)
 
-loop:
-	for {
-		select {
-		case event, ok := <-eventChan:
-			if !ok {
-				break loop
-			}
-			if processErr := a.processEvent(ctx, sessionID, &assistantMsg, event); processErr != nil {
-				if errors.Is(processErr, context.Canceled) {
-					a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled, "Request cancelled", "")
-				} else {
-					a.finishMessage(ctx, &assistantMsg, message.FinishReasonError, "API Error", processErr.Error())
-				}
-				return assistantMsg, nil, processErr
-			}
-		case <-ctx.Done():
-			a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled, "Request cancelled", "")
-			return assistantMsg, nil, ctx.Err()
+	candidates := append([]modelProvider{{provider: a.provider, providerID: a.providerID}}, a.fallbacks...)
+	for i, candidate := range candidates {
+		err := a.streamResponse(ctx, sessionID, &assistantMsg, candidate.provider, msgHistory, allTools)
+		if err == nil {
+			break
 		}
-	}
-
-	toolResults := make([]message.ToolResult, len(assistantMsg.ToolCalls()))
-	toolCalls := assistantMsg.ToolCalls()
-	for i, toolCall := range toolCalls {
-		select {
-		case <-ctx.Done():
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
 			a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled, "Request cancelled", "")
-			// Make all future tool calls cancelled
-			for j := i; j < len(toolCalls); j++ {
-				toolResults[j] = message.ToolResult{
-					ToolCallID: toolCalls[j].ID,
-					Content:    "Tool execution canceled by user",
-					IsError:    true,
-				}
-			}
-			goto out
-		default:
-			// Continue processing
-			var tool tools.BaseTool
-			allTools, _ = a.getAllTools()
-			for _, availableTool := range allTools {
-				if availableTool.Info().Name == toolCall.Name {
-					tool = availableTool
-					break
-				}
-			}
-
-			// Tool not found
-			if tool == nil {
-				toolResults[i] = message.ToolResult{
-					ToolCallID: toolCall.ID,
-					Content:    fmt.Sprintf("Tool not found: %s", toolCall.Name),
-					IsError:    true,
-				}
-				continue
-			}
-
-			// Run tool in goroutine to allow cancellation
-			type toolExecResult struct {
-				response tools.ToolResponse
-				err      error
-			}
-			resultChan := make(chan toolExecResult, 1)
-
-			go func() {
-				response, err := tool.Run(ctx, tools.ToolCall{
-					ID:    toolCall.ID,
-					Name:  toolCall.Name,
-					Input: toolCall.Input,
-				})
-				resultChan <- toolExecResult{response: response, err: err}
-			}()
-
-			var toolResponse tools.ToolResponse
-			var toolErr error
-
-			select {
-			case <-ctx.Done():
-				a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled, "Request cancelled", "")
-				// Mark remaining tool calls as cancelled
-				for j := i; j < len(toolCalls); j++ {
-					toolResults[j] = message.ToolResult{
-						ToolCallID: toolCalls[j].ID,
-						Content:    "Tool execution canceled by user",
-						IsError:    true,
-					}
-				}
-				goto out
-			case result := <-resultChan:
-				toolResponse = result.response
-				toolErr = result.err
-			}
+			return assistantMsg, nil, err
+		}
+		// Only a provider that can't answer for now falls back; a request it
+		// rejects would fail on the fallbacks as well.
+		var providerErr *providerError
+		if i+1 == len(candidates) || !errors.As(err, &providerErr) || !provider.IsUnavailable(err) {
+			a.finishMessage(ctx, &assistantMsg, message.FinishReasonError, "API Error", err.Error())
+			return assistantMsg, nil, err
+		}
 
-			if toolErr != nil {
-				slog.Error("Tool execution error", "toolCall", toolCall.ID, "error", toolErr)
-				if errors.Is(toolErr, permission.ErrorPermissionDenied) {
-					toolResults[i] = message.ToolResult{
-						ToolCallID: toolCall.ID,
-						Content:    "Permission denied",
-						IsError:    true,
-					}
-					for j := i + 1; j < len(toolCalls); j++ {
-						toolResults[j] = message.ToolResult{
-							ToolCallID: toolCalls[j].ID,
-							Content:    "Tool execution canceled by user",
-							IsError:    true,
-						}
-					}
-					a.finishMessage(ctx, &assistantMsg, message.FinishReasonPermissionDenied, "Permission denied", "")
-					break
-				}
-			}
-			toolResults[i] = message.ToolResult{
-				ToolCallID: toolCall.ID,
-				Content:    toolResponse.Content,
-				Metadata:   toolResponse.Metadata,
-				IsError:    toolResponse.IsError,
-			}
+		// Start the turn over on the next provider. Nothing ran yet: tools
+		// only run once the response is complete.
+		next := candidates[i+1]
+		nextModel := next.provider.Model()
+		slog.Warn("Provider failed, falling back", "session_id", sessionID, "provider", candidate.providerID, "model", assistantMsg.Model, "fallback_provider", next.providerID, "fallback_model", nextModel.ID, "error", err)
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:      AgentEventTypeWarning,
+			SessionID: sessionID,
+			Warning:   fmt.Sprintf("%s/%s failed, retrying with %s/%s: %v", candidate.providerID, assistantMsg.Model, next.providerID, nextModel.ID, err),
+		})
+		assistantMsg.Parts = []message.ContentPart{}
+		assistantMsg.Model = nextModel.ID
+		assistantMsg.Provider = next.providerID
+		if err := a.messages.Update(ctx, assistantMsg); err != nil {
+			return assistantMsg, nil, fmt.Errorf("failed to update message: %w", err)
 		}
 	}
-out:
+
+	toolResults, finishReason := runToolCalls(ctx, assistantMsg.ToolCalls(), allTools)
+	switch finishReason {
+	case message.FinishReasonCanceled:
+		a.finishMessage(context.Background(), &assistantMsg, message.FinishReasonCanceled, "Request cancelled", "")
+	case message.FinishReasonPermissionDenied:
+		a.finishMessage(ctx, &assistantMsg, message.FinishReasonPermissionDenied, "Permission denied", "")
+	}
 	if len(toolResults) == 0 {
 		return assistantMsg, nil, nil
 	}
@@ -693,7 +873,7 @@ out:
 	msg, err := a.messages.Create(context.Background(), assistantMsg.SessionID, message.CreateMessageParams{
 		Role:     message.Tool,
 		Parts:    parts,
-		Provider: a.providerID,
+		Provider: assistantMsg.Provider,
 	})
 	if err != nil {
 		return assistantMsg, nil, fmt.Errorf("failed to create cancelled tool message: %w", err)
@@ -702,12 +882,34 @@ out:
 	return assistantMsg, &msg, err
 }
 
+// streamResponse streams the response of p into assistantMsg. Errors reported
+// by the provider are returned as *providerError.
+func (a *agent) streamResponse(ctx context.Context, sessionID string, assistantMsg *message.Message, p provider.Provider, msgHistory []message.Message, allTools []tools.BaseTool) error {
+	eventChan := p.StreamResponse(ctx, msgHistory, allTools)
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				return nil
+			}
+			if event.Type == provider.EventError {
+				return &providerError{err: event.Error}
+			}
+			if err := a.processEvent(ctx, sessionID, assistantMsg, p.Model(), event); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 func (a *agent) finishMessage(ctx context.Context, msg *message.Message, finishReason message.FinishReason, message, details string) {
 	msg.AddFinish(finishReason, message, details)
 	_ = a.messages.Update(ctx, *msg)
 }
 
-func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg *message.Message, event provider.ProviderEvent) error {
+func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg *message.Message, model catwalk.Model, event provider.ProviderEvent) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -738,8 +940,13 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 		slog.Info("Finished tool call", "toolCall", event.ToolCall)
 		assistantMsg.FinishToolCall(event.ToolCall.ID)
 		return a.messages.Update(ctx, *assistantMsg)
-	case provider.EventError:
-		return event.Error
+	case provider.EventWarning:
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:      AgentEventTypeWarning,
+			SessionID: sessionID,
+			Warning:   event.Content,
+		})
+		return nil
 	case provider.EventComplete:
 		assistantMsg.FinishThinking()
 		assistantMsg.SetToolCalls(event.Response.ToolCalls)
@@ -747,36 +954,64 @@ func (a *agent) processEvent(ctx context.Context, sessionID string, assistantMsg
 		if err := a.messages.Update(ctx, *assistantMsg); err != nil {
 			return fmt.Errorf("failed to update message: %w", err)
 		}
-		return a.trackUsage(ctx, sessionID, a.Model(), event.Response.Usage)
+		return a.trackUsage(ctx, sessionID, *assistantMsg, model, event.Response.Usage)
 	}
 
 	return nil
 }
 
-func (a *agent) trackUsage(ctx context.Context, sessionID string, model catwalk.Model, usage provider.TokenUsage) error {
+// trackUsage records the usage of the response in assistantMsg and adds it to
+// the session totals.
+func (a *agent) trackUsage(ctx context.Context, sessionID string, assistantMsg message.Message, model catwalk.Model, usage provider.TokenUsage) error {
+	cost := usageCost(model, usage)
+	a.eventTokensUsed(sessionID, usage, cost)
+	if budget, ok := budgetFromContext(ctx); ok {
+		budget.add(cost, usage.InputTokens+usage.OutputTokens+usage.CacheReadTokens+usage.CacheCreationTokens)
+	}
+	return a.recordUsage(ctx, sessionID, assistantMsg, usage, cost)
+}
+
+// recordUsage stores the usage of the response in msg and accumulates it in
+// the session.
+func (a *agent) recordUsage(ctx context.Context, sessionID string, msg message.Message, usage provider.TokenUsage, cost float64) error {
+	if _, err := a.sessions.RecordUsage(ctx, session.Usage{
+		SessionID:           sessionID,
+		MessageID:           msg.ID,
+		Provider:            msg.Provider,
+		Model:               msg.Model,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheCreationTokens: usage.CacheCreationTokens,
+		CacheReadTokens:     usage.CacheReadTokens,
+		Cost:                cost,
+	}); err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+
 	sess, err := a.sessions.Get(ctx, sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to get session: %w", err)
 	}
-
-	cost := model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-		model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-		model.CostPer1MIn/1e6*float64(usage.InputTokens) +
-		model.CostPer1MOut/1e6*float64(usage.OutputTokens)
-
-	a.eventTokensUsed(sessionID, usage, cost)
-
 	sess.Cost += cost
-	sess.CompletionTokens = usage.OutputTokens + usage.CacheReadTokens
-	sess.PromptTokens = usage.InputTokens + usage.CacheCreationTokens
-
-	_, err = a.sessions.Save(ctx, sess)
-	if err != nil {
+	sess.PromptTokens += usage.InputTokens + usage.CacheCreationTokens + usage.CacheReadTokens
+	sess.CompletionTokens += usage.OutputTokens
+	if _, err := a.sessions.Save(ctx, sess); err != nil {
 		return fmt.Errorf("failed to save session: %w", err)
 	}
 	return nil
 }
 
+func usageCost(model catwalk.Model, usage provider.TokenUsage) float64 {
+	return model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
+		model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
+		model.CostPer1MIn/1e6*float64(usage.InputTokens) +
+		model.CostPer1MOut/1e6*float64(usage.OutputTokens)
+}
+
+// autoSummarizeContinuePrompt is sent after an automatic summary interrupts a
+// turn, with the user's request, so the model picks the work up again.
+const autoSummarizeContinuePrompt = "The conversation was summarized because it was close to the context window limit. Continue working on my last request from where you left off, without asking for confirmation. The request was:\n\n%s"
+
 func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 	if a.summarizeProvider == nil {
 		return fmt.Errorf("summarize provider not available")
@@ -796,163 +1031,191 @@ func (a *agent) Summarize(ctx context.Context, sessionID string) error {
 	go func() {
 		defer a.activeRequests.Del(sessionID + "-summarize")
 		defer cancel()
-		event := AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Starting summarization...",
+		if err := a.summarize(summarizeCtx, sessionID); err != nil {
+			a.Publish(pubsub.CreatedEvent, AgentEvent{
+				Type:      AgentEventTypeError,
+				SessionID: sessionID,
+				Error:     err,
+				Done:      true,
+			})
 		}
+	}()
 
-		a.Publish(pubsub.CreatedEvent, event)
-		// Get all messages from the session
-		msgs, err := a.messages.List(summarizeCtx, sessionID)
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to list messages: %w", err),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
-		summarizeCtx = context.WithValue(summarizeCtx, tools.SessionIDContextKey, sessionID)
+	return nil
+}
 
-		if len(msgs) == 0 {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("no messages to summarize"),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
+// summarize replaces the session history with a summary generated by the
+// summarize provider, publishing progress events along the way. Later
+// requests only send the messages from the summary onwards.
+func (a *agent) summarize(ctx context.Context, sessionID string) error {
+	progress := func(msg string) {
+		a.Publish(pubsub.CreatedEvent, AgentEvent{
+			Type:      AgentEventTypeSummarize,
+			SessionID: sessionID,
+			Progress:  msg,
+		})
+	}
 
-		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Analyzing conversation...",
-		}
-		a.Publish(pubsub.CreatedEvent, event)
+	progress("Starting summarization...")
+	msgs, err := a.historyMessages(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
 
-		// Add a system message to guide the summarization
-		summarizePrompt := "Provide a detailed but concise summary of our conversation above. Focus on information that would be helpful for continuing the conversation, including what we did, what we're doing, which files we're working on, and what we're going to do next."
+	if len(msgs) == 0 {
+		return fmt.Errorf("no messages to summarize")
+	}
 
-		// Create a new message with the summarize prompt
-		promptMsg := message.Message{
-			Role:  message.User,
-			Parts: []message.ContentPart{message.TextContent{Text: summarizePrompt}},
-		}
+	progress("Analyzing conversation...")
 
-		// Append the prompt to the messages
-		msgsWithPrompt := append(msgs, promptMsg)
+	// Add a system message to guide the summarization
+	summarizePrompt := "Provide a detailed but concise summary of our conversation above. Focus on information that would be helpful for continuing the conversation, including what we did, what we're doing, which files we're working on, and what we're going to do next."
 
-		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Generating summary...",
-		}
+	// Create a new message with the summarize prompt
+	promptMsg := message.Message{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: summarizePrompt}},
+	}
 
-		a.Publish(pubsub.CreatedEvent, event)
+	// Append the prompt to the messages
+	msgsWithPrompt := append(msgs, promptMsg)
 
-		// Send the messages to the summarize provider
-		response := a.summarizeProvider.StreamResponse(
-			summarizeCtx,
-			msgsWithPrompt,
-			nil,
-		)
-		var finalResponse *provider.ProviderResponse
-		for r := range response {
-			if r.Error != nil {
-				event = AgentEvent{
-					Type:  AgentEventTypeError,
-					Error: fmt.Errorf("failed to summarize: %w", r.Error),
-					Done:  true,
-				}
-				a.Publish(pubsub.CreatedEvent, event)
-				return
-			}
-			finalResponse = r.Response
-		}
+	progress("Generating summary...")
 
-		summary := strings.TrimSpace(finalResponse.Content)
-		if summary == "" {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("empty summary returned"),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-			return
+	// Send the messages to the summarize provider
+	response := a.summarizeProvider.StreamResponse(
+		ctx,
+		msgsWithPrompt,
+		nil,
+	)
+	var finalResponse *provider.ProviderResponse
+	for r := range response {
+		if r.Error != nil {
+			return fmt.Errorf("failed to summarize: %w", r.Error)
 		}
-		shell := shell.GetPersistentShell(config.Get().WorkingDir())
-		summary += "\n\n**Current working directory of the persistent shell**\n\n" + shell.GetWorkingDir()
-		event = AgentEvent{
-			Type:     AgentEventTypeSummarize,
-			Progress: "Creating new session...",
+		finalResponse = r.Response
+	}
+	if finalResponse == nil {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		return fmt.Errorf("empty summary returned")
+	}
 
-		a.Publish(pubsub.CreatedEvent, event)
-		oldSession, err := a.sessions.Get(summarizeCtx, sessionID)
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to get session: %w", err),
-				Done:  true,
-			}
+	summary := strings.TrimSpace(finalResponse.Content)
+	if summary == "" {
+		return fmt.Errorf("empty summary returned")
+	}
+	shell := shell.GetPersistentShell(config.Get().WorkingDir())
+	summary += "\n\n**Current working directory of the persistent shell**\n\n" + shell.GetWorkingDir()
 
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
-		// Create a message in the new session with the summary
-		msg, err := a.messages.Create(summarizeCtx, oldSession.ID, message.CreateMessageParams{
-			Role: message.Assistant,
-			Parts: []message.ContentPart{
-				message.TextContent{Text: summary},
-				message.Finish{
-					Reason: message.FinishReasonEndTurn,
-					Time:   time.Now().Unix(),
-				},
+	progress("Creating new session...")
+	oldSession, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+	// Create a message in the new session with the summary
+	msg, err := a.messages.Create(ctx, oldSession.ID, message.CreateMessageParams{
+		Role: message.Assistant,
+		Parts: []message.ContentPart{
+			message.TextContent{Text: summary},
+			message.Finish{
+				Reason: message.FinishReasonEndTurn,
+				Time:   time.Now().Unix(),
 			},
-			Model:    a.summarizeProvider.Model().ID,
-			Provider: a.summarizeProviderID,
-		})
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to create summary message: %w", err),
-				Done:  true,
-			}
+		},
+		Model:    a.summarizeProvider.Model().ID,
+		Provider: a.summarizeProviderID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create summary message: %w", err)
+	}
+	oldSession.SummaryMessageID = msg.ID
+	if _, err := a.sessions.Save(ctx, oldSession); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	usage := finalResponse.Usage
+	cost := usageCost(a.summarizeProvider.Model(), usage)
+	if budget, ok := budgetFromContext(ctx); ok {
+		budget.add(cost, usage.InputTokens+usage.OutputTokens+usage.CacheReadTokens+usage.CacheCreationTokens)
+	}
+	if err := a.recordUsage(ctx, oldSession.ID, msg, usage, cost); err != nil {
+		return err
+	}
 
-			a.Publish(pubsub.CreatedEvent, event)
-			return
-		}
-		oldSession.SummaryMessageID = msg.ID
-		oldSession.CompletionTokens = finalResponse.Usage.OutputTokens
-		oldSession.PromptTokens = 0
-		model := a.summarizeProvider.Model()
-		usage := finalResponse.Usage
-		cost := model.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-			model.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-			model.CostPer1MIn/1e6*float64(usage.InputTokens) +
-			model.CostPer1MOut/1e6*float64(usage.OutputTokens)
-		oldSession.Cost += cost
-		_, err = a.sessions.Save(summarizeCtx, oldSession)
-		if err != nil {
-			event = AgentEvent{
-				Type:  AgentEventTypeError,
-				Error: fmt.Errorf("failed to save session: %w", err),
-				Done:  true,
-			}
-			a.Publish(pubsub.CreatedEvent, event)
-		}
+	// Send final success event with the session ID
+	a.Publish(pubsub.CreatedEvent, AgentEvent{
+		Type:      AgentEventTypeSummarize,
+		SessionID: oldSession.ID,
+		Progress:  "Summary complete",
+		Done:      true,
+	})
+	return nil
+}
 
-		event = AgentEvent{
-			Type:      AgentEventTypeSummarize,
-			SessionID: oldSession.ID,
-			Progress:  "Summary complete",
-			Done:      true,
-		}
-		a.Publish(pubsub.CreatedEvent, event)
-		// Send final success event with the new session ID
-	}()
+// autoSummarize summarizes the session when shouldAutoSummarize says so and
+// returns the history that replaces it. ok is false when nothing was
+// summarized.
+func (a *agent) autoSummarize(ctx context.Context, sessionID string) (msgs []message.Message, ok bool, err error) {
+	if !a.shouldAutoSummarize(ctx, sessionID) {
+		return nil, false, nil
+	}
+	slog.Info("Context window almost full, summarizing session", "session_id", sessionID)
+	if err := a.summarize(ctx, sessionID); err != nil {
+		return nil, false, err
+	}
+	msgs, err = a.historyMessages(ctx, sessionID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load summarized history: %w", err)
+	}
+	return msgs, true, nil
+}
 
-	return nil
+// summarizeErr returns the event for a failed automatic summary: a canceled
+// request, or the error that made the summary fail.
+func (a *agent) summarizeErr(ctx context.Context, err error) AgentEvent {
+	if ctx.Err() != nil {
+		return a.err(ErrRequestCancelled)
+	}
+	return a.err(fmt.Errorf("failed to summarize session: %w", err))
+}
+
+// shouldAutoSummarize reports whether the session fills the configured
+// fraction of the model's context window.
+func (a *agent) shouldAutoSummarize(ctx context.Context, sessionID string) bool {
+	cfg := config.Get()
+	if cfg.Options.DisableAutoSummarize || a.summarizeProvider == nil {
+		return false
+	}
+	contextWindow := a.Model().ContextWindow
+	if contextWindow <= 0 {
+		return false
+	}
+	used, err := a.contextTokens(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to get usage for auto summarize", "session_id", sessionID, "error", err)
+		return false
+	}
+	return float64(used) >= cfg.Options.AutoSummarizeThreshold*float64(contextWindow)
+}
+
+// contextTokens estimates how much of the context window the session fills:
+// the prompt and output of its latest response, or only the summary when the
+// latest response is the summary that replaced the history.
+func (a *agent) contextTokens(ctx context.Context, sessionID string) (int64, error) {
+	usage, ok, err := a.sessions.LastUsage(ctx, sessionID)
+	if err != nil || !ok {
+		return 0, err
+	}
+	sess, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if usage.MessageID == sess.SummaryMessageID {
+		return usage.OutputTokens, nil
+	}
+	return usage.Tokens(), nil
 }
 
 func (a *agent) ClearQueue(sessionID string) {
@@ -1004,14 +1267,13 @@ func (a *agent) UpdateModel() error {
 			return fmt.Errorf("model not found for agent %s", a.agentCfg.Name)
 		}
 
-		promptID := agentPromptMap[a.agentCfg.ID]
-		if promptID == "" {
-			promptID = prompt.PromptDefault
+		systemPrompt, err := agentSystemPrompt(a.agentCfg, currentProviderCfg.ID)
+		if err != nil {
+			return err
 		}
-
 		opts := []provider.ProviderClientOption{
 			provider.WithModel(a.agentCfg.Model),
-			provider.WithSystemMessage(prompt.GetPrompt(promptID, currentProviderCfg.ID, cfg.Options.ContextPaths...)),
+			provider.WithSystemMessage(systemPrompt),
 		}
 
 		newProvider, err := provider.NewProvider(*currentProviderCfg, opts...)
@@ -1024,6 +1286,12 @@ func (a *agent) UpdateModel() error {
 		a.providerID = string(currentProviderCfg.ID)
 	}
 
+	fallbacks, err := fallbackProviders(a.agentCfg)
+	if err != nil {
+		return err
+	}
+	a.fallbacks = fallbacks
+
 	// Check if providers have changed for title (small) and summarize (large)
 	smallModelCfg := cfg.Models[config.SelectedModelTypeSmall]
 	var smallModelProviderCfg config.ProviderConfig
@@ -1085,6 +1353,9 @@ func (a *agent) UpdateModel() error {
 		a.summarizeProviderID = string(largeModelProviderCfg.ID)
 	}
 
+	if a.agentTool != nil {
+		return a.agentTool.updateModel()
+	}
 	return nil
 }
 
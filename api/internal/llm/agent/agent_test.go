@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/csync"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/lsp"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+func TestAllowedLSPClients(t *testing.T) {
+	t.Parallel()
+
+	clients := csync.NewMapFrom(map[string]*lsp.Client{"gopls": nil, "tsserver": nil})
+
+	require.Same(t, clients, allowedLSPClients(clients, config.Agent{}))
+
+	allowed := allowedLSPClients(clients, config.Agent{AllowedLSP: []string{"gopls", "rust-analyzer"}})
+	require.Equal(t, []string{"gopls"}, slices.Collect(maps.Keys(maps.Collect(allowed.Seq2()))))
+
+	require.Zero(t, allowedLSPClients(clients, config.Agent{AllowedLSP: []string{}}).Len())
+}
+
+func TestSubAgentConfigs(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Agents: map[string]config.Agent{
+		"coder":    {ID: "coder", AllowedTools: []string{"agent", "bash"}},
+		"task":     {ID: "task", AllowedTools: []string{"view"}},
+		"reviewer": {ID: "reviewer", AllowedTools: []string{"agent", "view"}},
+		"writer":   {ID: "writer", AllowedTools: []string{"agent", "write"}},
+	}}
+
+	agents := subAgentConfigs(cfg, "coder")
+	require.Len(t, agents, 3)
+	require.Equal(t, "task", agents[0].ID)
+	require.Equal(t, "reviewer", agents[1].ID)
+	require.Equal(t, []string{"view"}, agents[1].AllowedTools)
+	require.Equal(t, "writer", agents[2].ID)
+	require.Equal(t, []string{"write"}, agents[2].AllowedTools)
+	// The config itself keeps the agent tool.
+	require.Equal(t, []string{"agent", "view"}, cfg.Agents["reviewer"].AllowedTools)
+
+	agents = subAgentConfigs(cfg, "reviewer")
+	require.Equal(t, []string{"task", "writer"}, []string{agents[0].ID, agents[1].ID})
+
+	delete(cfg.Agents, "task")
+	agents = subAgentConfigs(cfg, "coder")
+	require.Equal(t, "reviewer", agents[0].ID)
+}
+
+// mockAgent is the coder agent of a crush.json using mock providers, with its
+// services on a new database.
+type mockAgent struct {
+	Service
+	workingDir string
+	sessions   session.Service
+	messages   message.Service
+}
+
+func newMockAgent(t *testing.T, crushJSON string) *mockAgent {
+	t.Helper()
+	m := &mockAgent{workingDir: t.TempDir()}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CRUSH_DISABLE_PROVIDER_AUTO_UPDATE", "1")
+	m.writeFile(t, "crush.json", crushJSON)
+	cfg, err := config.Init(m.workingDir, t.TempDir(), false)
+	require.NoError(t, err)
+
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, cfg.Options.DataDirectory)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	m.sessions = session.NewService(q)
+	m.messages = message.NewService(q, conn)
+	m.Service, err = NewAgent(ctx, cfg.Agents["coder"], permission.NewPermissionService(m.workingDir, true, nil), m.sessions, m.messages, history.NewService(q, conn), csync.NewMap[string, *lsp.Client]())
+	require.NoError(t, err)
+	return m
+}
+
+// writeFile writes a file of the working directory. Mock scripts are read on
+// every request, so they can change between prompts.
+func (m *mockAgent) writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(m.workingDir, name), []byte(content), 0o644))
+}
+
+func TestAgentRunWithMockProvider(t *testing.T) {
+	coder := newMockAgent(t, `{
+		"providers": {"mock": {"type": "mock", "script": "script.json"}},
+		"models": {"large": {"provider": "mock", "model": "mock"}, "small": {"provider": "mock", "model": "mock"}}
+	}`)
+	coder.writeFile(t, "notes.txt", "remember the milk")
+	coder.writeFile(t, "script.json", `{"turns": [
+		{"thinking": ["Reading the notes"], "tool_calls": [{"id": "call_1", "name": "view", "input": {"file_path": "notes.txt"}}], "usage": {"input_tokens": 10, "output_tokens": 5}},
+		{"content": ["The notes say: ", "remember the milk"], "usage": {"input_tokens": 30, "output_tokens": 8}}
+	]}`)
+
+	ctx := t.Context()
+	sess, err := coder.sessions.Create(ctx, "mock")
+	require.NoError(t, err)
+	done, err := coder.Run(ctx, sess.ID, "What do the notes say?")
+	require.NoError(t, err)
+	result := <-done
+	require.NoError(t, result.Error)
+	require.Equal(t, "The notes say: remember the milk", result.Message.Content().Text)
+
+	msgs, err := coder.messages.List(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 4)
+	require.Equal(t, "Reading the notes", msgs[1].ReasoningContent().Thinking)
+	require.Equal(t, "call_1", msgs[1].ToolCalls()[0].ID)
+	require.Contains(t, msgs[2].ToolResults()[0].Content, "remember the milk")
+
+	sess, err = coder.sessions.Get(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), sess.CompletionTokens)
+}
+
+func TestAgentFallback(t *testing.T) {
+	coder := newMockAgent(t, `{
+		"providers": {
+			"main": {"type": "mock", "script": "main.json"},
+			"fallback": {"type": "mock", "script": "fallback.json"}
+		},
+		"models": {
+			"large": {"provider": "main", "model": "mock", "fallbacks": [{"provider": "fallback", "model": "mock"}]},
+			"small": {"provider": "fallback", "model": "mock"}
+		}
+	}`)
+	coder.writeFile(t, "fallback.json", `{"turns": [{"content": ["Answered by the fallback"]}]}`)
+
+	ctx := t.Context()
+	// run returns the result of a prompt and the assistant message it left.
+	run := func() (AgentEvent, message.Message) {
+		sess, err := coder.sessions.Create(ctx, "fallback")
+		require.NoError(t, err)
+		done, err := coder.Run(ctx, sess.ID, "Hi")
+		require.NoError(t, err)
+		result := <-done
+		msgs, err := coder.messages.List(ctx, sess.ID)
+		require.NoError(t, err)
+		require.Len(t, msgs, 2)
+		return result, msgs[1]
+	}
+
+	// An overloaded provider falls back.
+	coder.writeFile(t, "main.json", `{"turns": [{"error": "overloaded", "status": 529}]}`)
+	result, answer := run()
+	require.NoError(t, result.Error)
+	require.Equal(t, "Answered by the fallback", answer.Content().Text)
+	require.Equal(t, "fallback", answer.Provider)
+
+	// A bad request would fail on the fallback too.
+	coder.writeFile(t, "main.json", `{"turns": [{"error": "invalid request", "status": 400}]}`)
+	result, answer = run()
+	require.ErrorContains(t, result.Error, "invalid request")
+	require.Equal(t, "main", answer.Provider)
+	require.Equal(t, message.FinishReasonError, answer.FinishReason())
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+type budgetContextKey struct{}
+
+// budgetTracker adds up what a prompt spends and compares it against the
+// configured budget. Sub-agents started by the prompt find the tracker in
+// their context and add to it, so their spending counts toward the parent
+// session and prompt.
+type budgetTracker struct {
+	limits config.Budget
+	// The session whose budget applies, the parent of any sub-agent session.
+	sessionID string
+
+	mu sync.Mutex
+	// Spending recorded for the session before the prompt started.
+	sessionCost   float64
+	sessionTokens int64
+	// Spending of the prompt, sub-agents included.
+	promptCost   float64
+	promptTokens int64
+	warned       bool
+}
+
+// budgetFromContext returns the tracker of the prompt that started a
+// sub-agent, if any.
+func budgetFromContext(ctx context.Context) (*budgetTracker, bool) {
+	b, ok := ctx.Value(budgetContextKey{}).(*budgetTracker)
+	return b, ok
+}
+
+// newBudgetTracker starts tracking a prompt of sess.
+func newBudgetTracker(limits config.Budget, sess session.Session) *budgetTracker {
+	return &budgetTracker{
+		limits:        limits,
+		sessionID:     sess.ID,
+		sessionCost:   sess.Cost,
+		sessionTokens: sessionTokens(sess),
+	}
+}
+
+// sessionTokens is the number of tokens recorded for the session.
+func sessionTokens(sess session.Session) int64 {
+	return sess.PromptTokens + sess.CompletionTokens
+}
+
+func (b *budgetTracker) withContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, budgetContextKey{}, b)
+}
+
+func (b *budgetTracker) add(cost float64, tokens int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.promptCost += cost
+	b.promptTokens += tokens
+}
+
+// usage returns the highest fraction of any limit spent so far and a
+// description of that limit. A fraction of 1 or more means the budget is
+// exhausted; zero limits are ignored.
+func (b *budgetTracker) usage() (float64, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var worst float64
+	var desc string
+	check := func(spent, limit float64, format string) {
+		if limit <= 0 {
+			return
+		}
+		if f := spent / limit; f > worst {
+			worst = f
+			desc = fmt.Sprintf(format, spent, limit)
+		}
+	}
+	check(b.sessionCost+b.promptCost, b.limits.SessionCost, "session cost $%.2f of $%.2f")
+	check(float64(b.sessionTokens+b.promptTokens), float64(b.limits.SessionTokens), "session tokens %.0f of %.0f")
+	check(b.promptCost, b.limits.PromptCost, "prompt cost $%.2f of $%.2f")
+	check(float64(b.promptTokens), float64(b.limits.PromptTokens), "prompt tokens %.0f of %.0f")
+	return worst, desc
+}
+
+// exceeded reports whether any limit has been reached.
+func (b *budgetTracker) exceeded() (bool, string) {
+	f, desc := b.usage()
+	return f >= 1, desc
+}
+
+// warn reports, only once, that spending crossed the warning fraction of a
+// limit without exhausting it.
+func (b *budgetTracker) warn() (bool, string) {
+	f, desc := b.usage()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.warned || b.limits.WarnAt <= 0 || f < b.limits.WarnAt || f >= 1 {
+		return false, ""
+	}
+	b.warned = true
+	return true, desc
+}
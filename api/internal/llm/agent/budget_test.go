@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+func TestBudgetTracker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no limits", func(t *testing.T) {
+		t.Parallel()
+		b := newBudgetTracker(config.Budget{WarnAt: 0.8}, session.Session{ID: "s", Cost: 100})
+		b.add(50, 1_000_000)
+		warn, _ := b.warn()
+		require.False(t, warn)
+		exceeded, _ := b.exceeded()
+		require.False(t, exceeded)
+	})
+
+	t.Run("session cost includes earlier spending", func(t *testing.T) {
+		t.Parallel()
+		b := newBudgetTracker(config.Budget{SessionCost: 10, WarnAt: 0.8}, session.Session{ID: "s", Cost: 7})
+		warn, _ := b.warn()
+		require.False(t, warn)
+
+		b.add(1.5, 100)
+		warn, desc := b.warn()
+		require.True(t, warn)
+		require.Equal(t, "session cost $8.50 of $10.00", desc)
+		warn, _ = b.warn()
+		require.False(t, warn, "warns only once")
+
+		b.add(1.5, 100)
+		exceeded, desc := b.exceeded()
+		require.True(t, exceeded)
+		require.Equal(t, "session cost $10.00 of $10.00", desc)
+	})
+
+	t.Run("prompt tokens", func(t *testing.T) {
+		t.Parallel()
+		b := newBudgetTracker(config.Budget{PromptTokens: 1000, WarnAt: 0.5}, session.Session{ID: "s", PromptTokens: 5000})
+		b.add(0, 999)
+		exceeded, _ := b.exceeded()
+		require.False(t, exceeded)
+		b.add(0, 1)
+		exceeded, desc := b.exceeded()
+		require.True(t, exceeded)
+		require.Equal(t, "prompt tokens 1000 of 1000", desc)
+	})
+}
@@ -8,6 +8,7 @@ import (
 var (
 	ErrRequestCancelled = errors.New("request canceled by user")
 	ErrSessionBusy      = errors.New("session is currently processing another request")
+	ErrBudgetExceeded   = errors.New("budget exceeded")
 )
 
 func isCancelledErr(err error) bool {
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// loopGuard stops a prompt whose tool loop runs away: too many model turns or
+// the model making the same tool call over and over. Only consecutive calls
+// count as repeats, so an edit-and-test cycle that runs the same test command
+// between edits is not a loop.
+type loopGuard struct {
+	maxTurns    int
+	maxRepeated int
+
+	turns    int
+	lastCall string
+	repeated int
+}
+
+func newLoopGuard(maxTurns, maxRepeated int) *loopGuard {
+	return &loopGuard{
+		maxTurns:    maxTurns,
+		maxRepeated: maxRepeated,
+	}
+}
+
+// reset starts counting again for a new prompt.
+func (g *loopGuard) reset() {
+	g.turns = 0
+	g.lastCall = ""
+	g.repeated = 0
+}
+
+// check records a finished turn with its tool calls. When the loop has to
+// stop it returns the finish reason and a message for the user; otherwise the
+// reason is empty.
+func (g *loopGuard) check(toolCalls []message.ToolCall) (message.FinishReason, string) {
+	g.turns++
+	for _, call := range toolCalls {
+		if key := toolCallKey(call); key == g.lastCall {
+			g.repeated++
+		} else {
+			g.lastCall = key
+			g.repeated = 1
+		}
+		if g.maxRepeated > 0 && g.repeated > g.maxRepeated {
+			return message.FinishReasonToolLoop, fmt.Sprintf(
+				"Stopped: the %s tool was called %d times in a row with the same input", call.Name, g.repeated)
+		}
+	}
+	if g.maxTurns > 0 && g.turns >= g.maxTurns {
+		return message.FinishReasonMaxTurns, fmt.Sprintf("Stopped: the prompt reached the limit of %d turns", g.maxTurns)
+	}
+	return "", ""
+}
+
+// toolCallKey identifies a call by tool and input, ignoring the formatting of
+// the JSON input.
+func toolCallKey(call message.ToolCall) string {
+	input := []byte(call.Input)
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, input); err == nil {
+		input = compact.Bytes()
+	}
+	return call.Name + "\x00" + string(input)
+}
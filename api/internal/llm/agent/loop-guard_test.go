@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+func TestLoopGuard(t *testing.T) {
+	t.Parallel()
+
+	t.Run("max turns", func(t *testing.T) {
+		t.Parallel()
+		g := newLoopGuard(3, 0)
+		for i := range 2 {
+			reason, _ := g.check([]message.ToolCall{{Name: "view", Input: string(rune('a' + i))}})
+			require.Empty(t, reason)
+		}
+		reason, notice := g.check(nil)
+		require.Equal(t, message.FinishReasonMaxTurns, reason)
+		require.Contains(t, notice, "3 turns")
+
+		g.reset()
+		reason, _ = g.check(nil)
+		require.Empty(t, reason)
+	})
+
+	t.Run("repeated identical calls", func(t *testing.T) {
+		t.Parallel()
+		g := newLoopGuard(0, 2)
+		reason, _ := g.check([]message.ToolCall{{Name: "bash", Input: `{"command": "make"}`}})
+		require.Empty(t, reason)
+		// Same input with different formatting.
+		reason, _ = g.check([]message.ToolCall{{Name: "bash", Input: `{"command":"make"}`}})
+		require.Empty(t, reason)
+		reason, notice := g.check([]message.ToolCall{{Name: "bash", Input: "{\n  \"command\": \"make\"\n}"}})
+		require.Equal(t, message.FinishReasonToolLoop, reason)
+		require.Contains(t, notice, "bash tool was called 3 times in a row")
+	})
+
+	t.Run("interleaved calls", func(t *testing.T) {
+		t.Parallel()
+		g := newLoopGuard(0, 2)
+		edit := message.ToolCall{Name: "edit", Input: `{"file_path":"a.go"}`}
+		test := message.ToolCall{Name: "bash", Input: `{"command":"go test"}`}
+		// Edit and test over and over, in separate turns and in one.
+		for range 5 {
+			reason, _ := g.check([]message.ToolCall{edit})
+			require.Empty(t, reason)
+			reason, _ = g.check([]message.ToolCall{test})
+			require.Empty(t, reason)
+		}
+		reason, _ := g.check([]message.ToolCall{edit, test, edit, test})
+		require.Empty(t, reason)
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -288,6 +289,15 @@ var mcpInitRequest = mcp.InitializeRequest{
 	},
 }
 
+// GetMCPTools returns the tools exposed by the configured MCP servers,
+// connecting to them on first use.
+func GetMCPTools(ctx context.Context, permissions permission.Service, cfg *config.Config) []tools.BaseTool {
+	mcpToolsOnce.Do(func() {
+		doGetMCPTools(ctx, permissions, cfg)
+	})
+	return slices.Collect(mcpTools.Seq())
+}
+
 func doGetMCPTools(ctx context.Context, permissions permission.Service, cfg *config.Config) {
 	var wg sync.WaitGroup
 	// Initialize states for all configured MCPs
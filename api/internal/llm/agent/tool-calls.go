@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+// maxParallelToolCalls bounds how many read-only tool calls of a turn run at
+// the same time.
+const maxParallelToolCalls = 4
+
+type toolExecResult struct {
+	response tools.ToolResponse
+	err      error
+}
+
+// runToolCalls executes the tool calls of a turn and returns their results in
+// the order of the calls. Consecutive read-only calls (see tools.IsReadOnly)
+// run concurrently, at most maxParallelToolCalls at a time; any other call
+// waits for the previous ones and runs alone. When the turn has to stop early
+// the returned finish reason says why and the calls that did not run are
+// marked as canceled.
+func runToolCalls(ctx context.Context, toolCalls []message.ToolCall, availableTools []tools.BaseTool) ([]message.ToolResult, message.FinishReason) {
+	toolsByName := make(map[string]tools.BaseTool, len(availableTools))
+	for _, tool := range availableTools {
+		toolsByName[tool.Info().Name] = tool
+	}
+	readOnly := func(call message.ToolCall) bool {
+		tool, ok := toolsByName[call.Name]
+		// Unknown tools do not run at all, so they never need to wait.
+		return !ok || tools.IsReadOnly(tool)
+	}
+
+	results := make([]message.ToolResult, len(toolCalls))
+	cancelFrom := func(i int) {
+		for j := i; j < len(toolCalls); j++ {
+			results[j] = message.ToolResult{
+				ToolCallID: toolCalls[j].ID,
+				Content:    "Tool execution canceled by user",
+				IsError:    true,
+			}
+		}
+	}
+
+	for start := 0; start < len(toolCalls); {
+		end := start + 1
+		if readOnly(toolCalls[start]) {
+			for end < len(toolCalls) && readOnly(toolCalls[end]) {
+				end++
+			}
+		}
+
+		execResults, ok := runToolBatch(ctx, toolCalls[start:end], toolsByName)
+		if !ok {
+			cancelFrom(start)
+			return results, message.FinishReasonCanceled
+		}
+		denied := false
+		for k, result := range execResults {
+			i := start + k
+			toolCall := toolCalls[i]
+			if result.err != nil {
+				slog.Error("Tool execution error", "toolCall", toolCall.ID, "error", result.err)
+				if errors.Is(result.err, permission.ErrorPermissionDenied) {
+					results[i] = message.ToolResult{
+						ToolCallID: toolCall.ID,
+						Content:    "Permission denied",
+						IsError:    true,
+					}
+					denied = true
+					continue
+				}
+			}
+			results[i] = message.ToolResult{
+				ToolCallID: toolCall.ID,
+				Content:    result.response.Content,
+				Metadata:   result.response.Metadata,
+				IsError:    result.response.IsError,
+			}
+		}
+		// The other calls of the batch already ran, so they keep their
+		// results; only the calls after it are canceled.
+		if denied {
+			cancelFrom(end)
+			return results, message.FinishReasonPermissionDenied
+		}
+		start = end
+	}
+	return results, ""
+}
+
+// runToolBatch runs the calls concurrently with a bounded pool and waits for
+// all of them. It returns false as soon as ctx is canceled, without waiting
+// for the calls still running.
+func runToolBatch(ctx context.Context, calls []message.ToolCall, toolsByName map[string]tools.BaseTool) ([]toolExecResult, bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	results := make([]toolExecResult, len(calls))
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		sem := make(chan struct{}, maxParallelToolCalls)
+		for i, toolCall := range calls {
+			tool, ok := toolsByName[toolCall.Name]
+			if !ok {
+				results[i] = toolExecResult{
+					response: tools.NewTextErrorResponse(fmt.Sprintf("Tool not found: %s", toolCall.Name)),
+				}
+				continue
+			}
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				response, err := tool.Run(ctx, tools.ToolCall{
+					ID:    toolCall.ID,
+					Name:  toolCall.Name,
+					Input: toolCall.Input,
+				})
+				results[i] = toolExecResult{response: response, err: err}
+			})
+		}
+	}()
+
+	select {
+	case <-done:
+		return results, ctx.Err() == nil
+	case <-ctx.Done():
+		return nil, false
+	}
+}
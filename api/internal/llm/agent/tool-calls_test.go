@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+type fakeTool struct {
+	name     string
+	readOnly bool
+	run      func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error)
+}
+
+func (f *fakeTool) Info() tools.ToolInfo { return tools.ToolInfo{Name: f.name} }
+func (f *fakeTool) Name() string         { return f.name }
+func (f *fakeTool) ReadOnly() bool       { return f.readOnly }
+func (f *fakeTool) Run(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+	return f.run(ctx, call)
+}
+
+func calls(names ...string) []message.ToolCall {
+	out := make([]message.ToolCall, len(names))
+	for i, name := range names {
+		out[i] = message.ToolCall{ID: fmt.Sprintf("call-%d", i), Name: name, Input: fmt.Sprint(i)}
+	}
+	return out
+}
+
+func TestRunToolCalls(t *testing.T) {
+	t.Parallel()
+
+	t.Run("read-only calls run concurrently in order", func(t *testing.T) {
+		t.Parallel()
+		var running, peak atomic.Int32
+		var writes []string
+		var readsDuringWrite int32
+		var mu sync.Mutex
+		read := &fakeTool{name: "read", readOnly: true, run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return tools.NewTextResponse("read " + call.Input), nil
+		}}
+		write := &fakeTool{name: "write", run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			readsDuringWrite += running.Load()
+			writes = append(writes, call.Input)
+			return tools.NewTextResponse("write " + call.Input), nil
+		}}
+
+		toolCalls := calls("read", "read", "read", "read", "read", "read", "write", "read", "missing")
+		results, reason := runToolCalls(t.Context(), toolCalls, []tools.BaseTool{read, write})
+		require.Empty(t, reason)
+		require.Len(t, results, len(toolCalls))
+		for i, r := range results {
+			require.Equal(t, toolCalls[i].ID, r.ToolCallID)
+		}
+		require.Equal(t, "read 0", results[0].Content)
+		require.Equal(t, "read 5", results[5].Content)
+		require.Equal(t, "write 6", results[6].Content)
+		require.Equal(t, "read 7", results[7].Content)
+		require.True(t, results[8].IsError)
+		require.Equal(t, "Tool not found: missing", results[8].Content)
+		require.Equal(t, []string{"6"}, writes)
+		// Read-only calls before a write must have finished.
+		require.Zero(t, readsDuringWrite)
+		require.Greater(t, peak.Load(), int32(1))
+		require.LessOrEqual(t, peak.Load(), int32(maxParallelToolCalls))
+	})
+
+	t.Run("permission denied cancels the remaining calls", func(t *testing.T) {
+		t.Parallel()
+		var ran atomic.Int32
+		ok := &fakeTool{name: "ok", run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			ran.Add(1)
+			return tools.NewTextResponse("ok"), nil
+		}}
+		denied := &fakeTool{name: "denied", run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			return tools.ToolResponse{}, permission.ErrorPermissionDenied
+		}}
+
+		results, reason := runToolCalls(t.Context(), calls("ok", "denied", "ok"), []tools.BaseTool{ok, denied})
+		require.Equal(t, message.FinishReasonPermissionDenied, reason)
+		require.Equal(t, "ok", results[0].Content)
+		require.Equal(t, "Permission denied", results[1].Content)
+		require.Equal(t, "Tool execution canceled by user", results[2].Content)
+		require.Equal(t, int32(1), ran.Load())
+	})
+
+	t.Run("permission denied inside a read-only batch keeps the other results", func(t *testing.T) {
+		t.Parallel()
+		read := &fakeTool{name: "read", readOnly: true, run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			return tools.NewTextResponse("read " + call.Input), nil
+		}}
+		denied := &fakeTool{name: "denied", readOnly: true, run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			return tools.ToolResponse{}, permission.ErrorPermissionDenied
+		}}
+		var wrote atomic.Bool
+		write := &fakeTool{name: "write", run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			wrote.Store(true)
+			return tools.NewTextResponse("write"), nil
+		}}
+
+		results, reason := runToolCalls(t.Context(), calls("read", "denied", "read", "write"), []tools.BaseTool{read, denied, write})
+		require.Equal(t, message.FinishReasonPermissionDenied, reason)
+		require.Equal(t, "read 0", results[0].Content)
+		require.Equal(t, "Permission denied", results[1].Content)
+		require.Equal(t, "read 2", results[2].Content)
+		require.False(t, results[2].IsError)
+		require.Equal(t, "Tool execution canceled by user", results[3].Content)
+		require.False(t, wrote.Load())
+	})
+
+	t.Run("cancellation stops waiting for running calls", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(t.Context())
+		started := make(chan struct{}, 2)
+		block := &fakeTool{name: "block", readOnly: true, run: func(ctx context.Context, call tools.ToolCall) (tools.ToolResponse, error) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return tools.ToolResponse{}, ctx.Err()
+		}}
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		results, reason := runToolCalls(ctx, calls("block", "block"), []tools.BaseTool{block})
+		require.Equal(t, message.FinishReasonCanceled, reason)
+		for _, r := range results {
+			require.True(t, r.IsError)
+			require.Equal(t, "Tool execution canceled by user", r.Content)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package prompt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+)
+
+// CustomPrompt builds the system prompt of a user defined agent from the file
+// at path, relative to the working directory, followed by the environment
+// information and the content of the context paths.
+func CustomPrompt(path string, contextPaths ...string) (string, error) {
+	workingDir := config.Get().WorkingDir()
+	path = expandPath(path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workingDir, path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read agent prompt: %w", err)
+	}
+
+	basePrompt := fmt.Sprintf("%s\n\n%s", strings.TrimSpace(string(content)), getEnvironmentInfo())
+	contextContent := getContextFromPaths(workingDir, contextPaths)
+	if contextContent != "" {
+		return fmt.Sprintf("%s\n\n# Project-Specific Context\n Make sure to follow the instructions in the context below\n%s", basePrompt, contextContent), nil
+	}
+	return basePrompt, nil
+}
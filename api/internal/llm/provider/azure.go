@@ -30,7 +30,7 @@ func newAzureClient(opts providerClientOptions) AzureClient {
 		reqOpts = append(reqOpts, option.WithHTTPClient(httpClient))
 	}
 
-	reqOpts = append(reqOpts, azure.WithAPIKey(opts.apiKey))
+	reqOpts = append(reqOpts, azure.WithAPIKey(opts.apiKey), option.WithMaxRetries(0))
 	base := &openaiClient{
 		providerOptions: opts,
 		client:          openai.NewClient(reqOpts...),
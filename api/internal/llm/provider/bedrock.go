@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/upperxcode/jx2ai-agent/api/internal/config"
 	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
@@ -33,14 +34,15 @@ func newBedrockClient(opts providerClientOptions) BedrockClient {
 		}
 	}
 
+	baseModel := opts.model
 	opts.model = func(modelType config.SelectedModelType) catwalk.Model {
-		model := config.Get().GetModelByType(modelType)
+		model := baseModel(modelType)
 
 		// Prefix the model name with region
 		regionPrefix := region[:2]
 		modelName := model.ID
 		model.ID = fmt.Sprintf("%s.%s", regionPrefix, modelName)
-		return *model
+		return model
 	}
 
 	model := opts.model(opts.modelType)
@@ -89,6 +91,13 @@ func (b *bedrockClient) stream(ctx context.Context, messages []message.Message,
 	return b.childProvider.stream(ctx, messages, tools)
 }
 
+func (b *bedrockClient) shouldRetry(err error) (bool, time.Duration, error) {
+	if b.childProvider == nil {
+		return false, 0, err
+	}
+	return b.childProvider.shouldRetry(err)
+}
+
 func (b *bedrockClient) Model() catwalk.Model {
 	return b.providerOptions.model(b.providerOptions.modelType)
 }
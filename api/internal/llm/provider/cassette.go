@@ -0,0 +1,317 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// cassetteProvider records the streams of a provider to a cassette file, one
+// JSON entry per line, or replays them from it without calling the provider.
+//
+// Entries are keyed by a hash of the normalized request: the provider, the
+// model, the tools and the conversation. The system prompt is left out, since
+// it holds the date and the project tree; tool call IDs are replaced by their
+// order in the conversation and the working directory by a placeholder, so a
+// session replays the same in another checkout.
+type cassetteProvider struct {
+	Provider
+	options providerClientOptions
+	mode    config.CassetteMode
+	path    string
+}
+
+type cassetteEntry struct {
+	Key     string          `json:"key"`
+	Request cassetteRequest `json:"request"`
+	Events  []cassetteEvent `json:"events"`
+}
+
+type cassetteRequest struct {
+	Provider  string            `json:"provider"`
+	Model     string            `json:"model"`
+	ModelType string            `json:"model_type"`
+	Tools     []string          `json:"tools,omitempty"`
+	Messages  []cassetteMessage `json:"messages"`
+}
+
+type cassetteMessage struct {
+	Role        message.MessageRole  `json:"role"`
+	Text        string               `json:"text,omitempty"`
+	Thinking    string               `json:"thinking,omitempty"`
+	Attachments []string             `json:"attachments,omitempty"`
+	ToolCalls   []message.ToolCall   `json:"tool_calls,omitempty"`
+	ToolResults []message.ToolResult `json:"tool_results,omitempty"`
+}
+
+type cassetteEvent struct {
+	Type      EventType         `json:"type"`
+	Content   string            `json:"content,omitempty"`
+	Thinking  string            `json:"thinking,omitempty"`
+	Signature string            `json:"signature,omitempty"`
+	Response  *ProviderResponse `json:"response,omitempty"`
+	ToolCall  *message.ToolCall `json:"tool_call,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// cassettes guards the cassette files and counts how many times each entry
+// was replayed, so a request made twice gets the second recording the second
+// time.
+var cassettes struct {
+	sync.Mutex
+	replayed map[string]int
+}
+
+func withCassette(p Provider, opts providerClientOptions) Provider {
+	cassette := config.Get().Options.Cassette
+	if cassette.Mode == "" {
+		return p
+	}
+	return &cassetteProvider{
+		Provider: p,
+		options:  opts,
+		mode:     cassette.Mode,
+		path:     cassette.Path,
+	}
+}
+
+func (c *cassetteProvider) SendMessages(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	request := c.request(messages, tools)
+	if c.mode == config.CassetteReplay {
+		events, err := c.replay(request)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if event.Type == EventError {
+				return nil, event.Error
+			}
+			if event.Type == EventComplete {
+				return event.Response, nil
+			}
+		}
+		return nil, errors.New("the recorded response did not complete")
+	}
+
+	resp, err := c.Provider.SendMessages(ctx, messages, tools)
+	event := ProviderEvent{Type: EventComplete, Response: resp}
+	if err != nil {
+		event = ProviderEvent{Type: EventError, Error: err}
+	}
+	c.record(request, []ProviderEvent{event})
+	return resp, err
+}
+
+func (c *cassetteProvider) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	request := c.request(messages, tools)
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		if c.mode == config.CassetteReplay {
+			events, err := c.replay(request)
+			if err != nil {
+				events = []ProviderEvent{{Type: EventError, Error: err}}
+			}
+			for _, event := range events {
+				select {
+				case eventChan <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			return
+		}
+
+		var events []ProviderEvent
+		for event := range c.Provider.StreamResponse(ctx, messages, tools) {
+			events = append(events, event)
+			eventChan <- event
+		}
+		c.record(request, events)
+	}()
+
+	return eventChan
+}
+
+// request normalizes a request so that it hashes the same every time the
+// conversation is played.
+func (c *cassetteProvider) request(messages []message.Message, tools []tools.BaseTool) cassetteRequest {
+	workingDir := config.Get().WorkingDir()
+	normalize := func(s string) string {
+		if workingDir == "" {
+			return s
+		}
+		return strings.ReplaceAll(s, workingDir, "$WORKING_DIR")
+	}
+	callIDs := make(map[string]string)
+	callID := func(id string) string {
+		if _, ok := callIDs[id]; !ok {
+			callIDs[id] = fmt.Sprintf("call_%d", len(callIDs)+1)
+		}
+		return callIDs[id]
+	}
+
+	request := cassetteRequest{
+		Provider:  c.options.config.ID,
+		Model:     c.Model().ID,
+		ModelType: string(c.options.modelType),
+	}
+	for _, tool := range tools {
+		request.Tools = append(request.Tools, tool.Info().Name)
+	}
+	slices.Sort(request.Tools)
+
+	for _, msg := range messages {
+		normalized := cassetteMessage{Role: msg.Role}
+		for _, part := range msg.Parts {
+			switch part := part.(type) {
+			case message.TextContent:
+				normalized.Text += normalize(part.Text)
+			case message.ReasoningContent:
+				normalized.Thinking += normalize(part.Thinking)
+			case message.BinaryContent:
+				sum := sha256.Sum256(part.Data)
+				normalized.Attachments = append(normalized.Attachments, part.MIMEType+":"+hex.EncodeToString(sum[:]))
+			case message.ImageURLContent:
+				normalized.Attachments = append(normalized.Attachments, part.URL)
+			case message.ToolCall:
+				// Interrupted tool calls are not sent to the providers.
+				if part.Finished {
+					normalized.ToolCalls = append(normalized.ToolCalls, message.ToolCall{
+						ID:    callID(part.ID),
+						Name:  part.Name,
+						Input: normalize(part.Input),
+					})
+				}
+			case message.ToolResult:
+				normalized.ToolResults = append(normalized.ToolResults, message.ToolResult{
+					ToolCallID: callID(part.ToolCallID),
+					Name:       part.Name,
+					Content:    normalize(part.Content),
+					IsError:    part.IsError,
+				})
+			}
+		}
+		request.Messages = append(request.Messages, normalized)
+	}
+	return request
+}
+
+func (r cassetteRequest) key() string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *cassetteProvider) record(request cassetteRequest, events []ProviderEvent) {
+	entry := cassetteEntry{Key: request.key(), Request: request}
+	for _, event := range events {
+		recorded := cassetteEvent{
+			Type:      event.Type,
+			Content:   event.Content,
+			Thinking:  event.Thinking,
+			Signature: event.Signature,
+			Response:  event.Response,
+			ToolCall:  event.ToolCall,
+		}
+		if event.Error != nil {
+			recorded.Error = event.Error.Error()
+		}
+		entry.Events = append(entry.Events, recorded)
+	}
+	if err := c.appendEntry(entry); err != nil {
+		slog.Error("Failed to record provider stream", "provider", c.options.config.ID, "path", c.path, "error", err)
+	}
+}
+
+func (c *cassetteProvider) appendEntry(entry cassetteEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	cassettes.Lock()
+	defer cassettes.Unlock()
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// replay returns the events recorded for request. A request recorded several
+// times gets its recordings in order, and the last one after that.
+func (c *cassetteProvider) replay(request cassetteRequest) ([]ProviderEvent, error) {
+	key := request.key()
+	cassettes.Lock()
+	defer cassettes.Unlock()
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer f.Close()
+
+	var recorded []cassetteEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", c.path, err)
+		}
+		if entry.Key == key {
+			recorded = append(recorded, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", c.path, err)
+	}
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recording in cassette %s for request %s", c.path, key)
+	}
+
+	if cassettes.replayed == nil {
+		cassettes.replayed = make(map[string]int)
+	}
+	replayKey := c.path + "\x00" + key
+	entry := recorded[min(cassettes.replayed[replayKey], len(recorded)-1)]
+	cassettes.replayed[replayKey]++
+
+	events := make([]ProviderEvent, 0, len(entry.Events))
+	for _, recorded := range entry.Events {
+		event := ProviderEvent{
+			Type:      recorded.Type,
+			Content:   recorded.Content,
+			Thinking:  recorded.Thinking,
+			Signature: recorded.Signature,
+			Response:  recorded.Response,
+			ToolCall:  recorded.ToolCall,
+		}
+		if recorded.Error != "" {
+			event.Error = errors.New(recorded.Error)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
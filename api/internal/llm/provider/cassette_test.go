@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "script.json")
+	cassettePath := filepath.Join(dir, "cassette.jsonl")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(`{"turns": [
+		{"thinking": ["hmm"], "content": ["Hi"], "tool_calls": [{"name": "ls"}], "usage": {"input_tokens": 3}}
+	]}`), 0o644))
+
+	opts := providerClientOptions{
+		config:    config.ProviderConfig{ID: "mock", Script: scriptPath},
+		modelType: config.SelectedModelTypeLarge,
+		model: func(config.SelectedModelType) catwalk.Model {
+			return catwalk.Model{ID: "mock"}
+		},
+	}
+	newCassette := func(mode config.CassetteMode) *cassetteProvider {
+		return &cassetteProvider{
+			Provider: &baseProvider[MockClient]{options: opts, client: newMockClient(opts)},
+			options:  opts,
+			mode:     mode,
+			path:     cassettePath,
+		}
+	}
+	collect := func(p Provider, messages []message.Message) []ProviderEvent {
+		var events []ProviderEvent
+		for event := range p.StreamResponse(t.Context(), messages, nil) {
+			events = append(events, event)
+		}
+		return events
+	}
+
+	user := message.Message{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Hello"}}}
+	recorded := collect(newCassette(config.CassetteRecord), []message.Message{user})
+	require.Equal(t, EventComplete, recorded[len(recorded)-1].Type)
+
+	// The replay doesn't need the provider anymore.
+	require.NoError(t, os.Remove(scriptPath))
+	replayed := collect(newCassette(config.CassetteReplay), []message.Message{user})
+	require.Equal(t, recorded, replayed)
+
+	other := message.Message{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Bye"}}}
+	replayed = collect(newCassette(config.CassetteReplay), []message.Message{other})
+	require.Len(t, replayed, 1)
+	require.Equal(t, EventError, replayed[0].Type)
+	require.ErrorContains(t, replayed[0].Error, "no recording in cassette")
+}
+
+func TestCassetteRequestKey(t *testing.T) {
+	c := &cassetteProvider{
+		Provider: &baseProvider[MockClient]{client: &mockClient{providerOptions: providerClientOptions{
+			model: func(config.SelectedModelType) catwalk.Model { return catwalk.Model{ID: "mock"} },
+		}}},
+	}
+	history := func(callID string) []message.Message {
+		return []message.Message{
+			{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "List " + config.Get().WorkingDir()}}},
+			{Role: message.Assistant, Parts: []message.ContentPart{
+				message.ToolCall{ID: callID, Name: "ls", Input: "{}", Finished: true},
+				message.Finish{Reason: message.FinishReasonToolUse, Time: 123},
+			}},
+			{Role: message.Tool, Parts: []message.ContentPart{message.ToolResult{ToolCallID: callID, Content: "main.go"}}},
+		}
+	}
+
+	request := c.request(history("call_abc"), nil)
+	require.Equal(t, request.key(), c.request(history("toolu_xyz"), nil).key())
+	require.Equal(t, "List $WORKING_DIR", request.Messages[0].Text)
+	require.Equal(t, "call_1", request.Messages[1].ToolCalls[0].ID)
+	require.Equal(t, "call_1", request.Messages[2].ToolResults[0].ToolCallID)
+
+	changed := history("call_abc")
+	changed[2].Parts = []message.ContentPart{message.ToolResult{ToolCallID: "call_abc", Content: "go.mod"}}
+	require.NotEqual(t, request.key(), c.request(changed, nil).key())
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"strings"
 	"time"
@@ -69,7 +68,7 @@ func (g *geminiClient) convertMessages(messages []message.Message) []*genai.Cont
 		switch msg.Role {
 		case message.User:
 			var parts []*genai.Part
-			parts = append(parts, &genai.Part{Text: msg.Content().String()})
+			parts = append(parts, &genai.Part{Text: msg.PromptContent()})
 			for _, binaryContent := range msg.BinaryContent() {
 				parts = append(parts, &genai.Part{InlineData: &genai.Blob{
 					MIMEType: binaryContent.MIMEType,
@@ -186,12 +185,8 @@ func (g *geminiClient) send(ctx context.Context, messages []message.Message, too
 	// Convert messages
 	geminiMessages := g.convertMessages(messages)
 	model := g.providerOptions.model(g.providerOptions.modelType)
-	cfg := config.Get()
 
-	modelConfig := cfg.Models[config.SelectedModelTypeLarge]
-	if g.providerOptions.modelType == config.SelectedModelTypeSmall {
-		modelConfig = cfg.Models[config.SelectedModelTypeSmall]
-	}
+	modelConfig := g.providerOptions.modelConfig()
 
 	maxTokens := model.DefaultMaxTokens
 	if modelConfig.MaxTokens > 0 {
@@ -212,69 +207,51 @@ func (g *geminiClient) send(ctx context.Context, messages []message.Message, too
 	config.Tools = g.convertTools(tools)
 	chat, _ := g.client.Chats.Create(ctx, model.ID, config, history)
 
-	attempts := 0
-	for {
-		attempts++
-		var toolCalls []message.ToolCall
+	var toolCalls []message.ToolCall
 
-		var lastMsgParts []genai.Part
-		for _, part := range lastMsg.Parts {
-			lastMsgParts = append(lastMsgParts, *part)
-		}
-		resp, err := chat.SendMessage(ctx, lastMsgParts...)
-		// If there is an error we are going to see if we can retry the call
-		if err != nil {
-			retry, after, retryErr := g.shouldRetry(attempts, err)
-			if retryErr != nil {
-				return nil, retryErr
-			}
-			if retry {
-				slog.Warn("Retrying due to rate limit", "attempt", attempts, "max_retries", maxRetries, "error", err)
-				select {
-				case <-ctx.Done():
-					return nil, ctx.Err()
-				case <-time.After(time.Duration(after) * time.Millisecond):
-					continue
-				}
-			}
-			return nil, retryErr
-		}
+	var lastMsgParts []genai.Part
+	for _, part := range lastMsg.Parts {
+		lastMsgParts = append(lastMsgParts, *part)
+	}
+	resp, err := chat.SendMessage(ctx, lastMsgParts...)
+	if err != nil {
+		return nil, err
+	}
 
-		content := ""
-
-		if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
-			for _, part := range resp.Candidates[0].Content.Parts {
-				switch {
-				case part.Text != "":
-					content = string(part.Text)
-				case part.FunctionCall != nil:
-					id := "call_" + uuid.New().String()
-					args, _ := json.Marshal(part.FunctionCall.Args)
-					toolCalls = append(toolCalls, message.ToolCall{
-						ID:       id,
-						Name:     part.FunctionCall.Name,
-						Input:    string(args),
-						Type:     "function",
-						Finished: true,
-					})
-				}
+	content := ""
+
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			switch {
+			case part.Text != "":
+				content = string(part.Text)
+			case part.FunctionCall != nil:
+				id := "call_" + uuid.New().String()
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				toolCalls = append(toolCalls, message.ToolCall{
+					ID:       id,
+					Name:     part.FunctionCall.Name,
+					Input:    string(args),
+					Type:     "function",
+					Finished: true,
+				})
 			}
 		}
-		finishReason := message.FinishReasonEndTurn
-		if len(resp.Candidates) > 0 {
-			finishReason = g.finishReason(resp.Candidates[0].FinishReason)
-		}
-		if len(toolCalls) > 0 {
-			finishReason = message.FinishReasonToolUse
-		}
-
-		return &ProviderResponse{
-			Content:      content,
-			ToolCalls:    toolCalls,
-			Usage:        g.usage(resp),
-			FinishReason: finishReason,
-		}, nil
 	}
+	finishReason := message.FinishReasonEndTurn
+	if len(resp.Candidates) > 0 {
+		finishReason = g.finishReason(resp.Candidates[0].FinishReason)
+	}
+	if len(toolCalls) > 0 {
+		finishReason = message.FinishReasonToolUse
+	}
+
+	return &ProviderResponse{
+		Content:      content,
+		ToolCalls:    toolCalls,
+		Usage:        g.usage(resp),
+		FinishReason: finishReason,
+	}, nil
 }
 
 func (g *geminiClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
@@ -282,12 +259,8 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 	geminiMessages := g.convertMessages(messages)
 
 	model := g.providerOptions.model(g.providerOptions.modelType)
-	cfg := config.Get()
 
-	modelConfig := cfg.Models[config.SelectedModelTypeLarge]
-	if g.providerOptions.modelType == config.SelectedModelTypeSmall {
-		modelConfig = cfg.Models[config.SelectedModelTypeSmall]
-	}
+	modelConfig := g.providerOptions.modelConfig()
 	maxTokens := model.DefaultMaxTokens
 	if modelConfig.MaxTokens > 0 {
 		maxTokens = modelConfig.MaxTokens
@@ -312,111 +285,87 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 	config.Tools = g.convertTools(tools)
 	chat, _ := g.client.Chats.Create(ctx, model.ID, config, history)
 
-	attempts := 0
 	eventChan := make(chan ProviderEvent)
 
 	go func() {
 		defer close(eventChan)
 
-		for {
-			attempts++
+		currentContent := ""
+		toolCalls := []message.ToolCall{}
+		var finalResp *genai.GenerateContentResponse
 
-			currentContent := ""
-			toolCalls := []message.ToolCall{}
-			var finalResp *genai.GenerateContentResponse
+		eventChan <- ProviderEvent{Type: EventContentStart}
 
-			eventChan <- ProviderEvent{Type: EventContentStart}
+		var lastMsgParts []genai.Part
 
-			var lastMsgParts []genai.Part
+		for _, part := range lastMsg.Parts {
+			lastMsgParts = append(lastMsgParts, *part)
+		}
 
-			for _, part := range lastMsg.Parts {
-				lastMsgParts = append(lastMsgParts, *part)
+		for resp, err := range chat.SendMessageStream(ctx, lastMsgParts...) {
+			if err != nil {
+				eventChan <- ProviderEvent{Type: EventError, Error: err}
+				return
 			}
 
-			for resp, err := range chat.SendMessageStream(ctx, lastMsgParts...) {
-				if err != nil {
-					retry, after, retryErr := g.shouldRetry(attempts, err)
-					if retryErr != nil {
-						eventChan <- ProviderEvent{Type: EventError, Error: retryErr}
-						return
-					}
-					if retry {
-						slog.Warn("Retrying due to rate limit", "attempt", attempts, "max_retries", maxRetries, "error", err)
-						select {
-						case <-ctx.Done():
-							if ctx.Err() != nil {
-								eventChan <- ProviderEvent{Type: EventError, Error: ctx.Err()}
+			finalResp = resp
+
+			if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+				for _, part := range resp.Candidates[0].Content.Parts {
+					switch {
+					case part.Text != "":
+						delta := string(part.Text)
+						if delta != "" {
+							eventChan <- ProviderEvent{
+								Type:    EventContentDelta,
+								Content: delta,
 							}
-
-							return
-						case <-time.After(time.Duration(after) * time.Millisecond):
-							continue
+							currentContent += delta
 						}
-					} else {
-						eventChan <- ProviderEvent{Type: EventError, Error: err}
-						return
-					}
-				}
-
-				finalResp = resp
-
-				if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
-					for _, part := range resp.Candidates[0].Content.Parts {
-						switch {
-						case part.Text != "":
-							delta := string(part.Text)
-							if delta != "" {
-								eventChan <- ProviderEvent{
-									Type:    EventContentDelta,
-									Content: delta,
-								}
-								currentContent += delta
-							}
-						case part.FunctionCall != nil:
-							id := "call_" + uuid.New().String()
-							args, _ := json.Marshal(part.FunctionCall.Args)
-							newCall := message.ToolCall{
-								ID:       id,
-								Name:     part.FunctionCall.Name,
-								Input:    string(args),
-								Type:     "function",
-								Finished: true,
-							}
-
-							toolCalls = append(toolCalls, newCall)
+					case part.FunctionCall != nil:
+						id := "call_" + uuid.New().String()
+						args, _ := json.Marshal(part.FunctionCall.Args)
+						newCall := message.ToolCall{
+							ID:       id,
+							Name:     part.FunctionCall.Name,
+							Input:    string(args),
+							Type:     "function",
+							Finished: true,
 						}
+
+						toolCalls = append(toolCalls, newCall)
 					}
-				} else {
-					// no content received
-					break
 				}
+			} else {
+				// no content received
+				break
 			}
+		}
 
-			eventChan <- ProviderEvent{Type: EventContentStop}
+		eventChan <- ProviderEvent{Type: EventContentStop}
 
-			if finalResp != nil {
-				finishReason := message.FinishReasonEndTurn
-				if len(finalResp.Candidates) > 0 {
-					finishReason = g.finishReason(finalResp.Candidates[0].FinishReason)
-				}
-				if len(toolCalls) > 0 {
-					finishReason = message.FinishReasonToolUse
-				}
-				eventChan <- ProviderEvent{
-					Type: EventComplete,
-					Response: &ProviderResponse{
-						Content:      currentContent,
-						ToolCalls:    toolCalls,
-						Usage:        g.usage(finalResp),
-						FinishReason: finishReason,
-					},
-				}
-				return
-			} else {
-				eventChan <- ProviderEvent{
-					Type:  EventError,
-					Error: errors.New("no content received"),
-				}
+		if finalResp != nil {
+			finishReason := message.FinishReasonEndTurn
+			if len(finalResp.Candidates) > 0 {
+				finishReason = g.finishReason(finalResp.Candidates[0].FinishReason)
+			}
+			if len(toolCalls) > 0 {
+				finishReason = message.FinishReasonToolUse
+			}
+			eventChan <- ProviderEvent{
+				Type: EventComplete,
+				Response: &ProviderResponse{
+					Content:      currentContent,
+					ToolCalls:    toolCalls,
+					Usage:        g.usage(finalResp),
+					FinishReason: finishReason,
+				},
+			}
+			return
+		} else {
+			eventChan <- ProviderEvent{
+				Type:  EventError,
+				Error: errors.New("no content received"),
 			}
 		}
 	}()
@@ -424,52 +373,55 @@ func (g *geminiClient) stream(ctx context.Context, messages []message.Message, t
 	return eventChan
 }
 
-func (g *geminiClient) shouldRetry(attempts int, err error) (bool, int64, error) {
-	// Check if error is a rate limit error
-	if attempts > maxRetries {
-		return false, 0, fmt.Errorf("maximum retry attempts reached for rate limit: %d retries", maxRetries)
-	}
-
-	// Gemini doesn't have a standard error type we can check against
-	// So we'll check the error message for rate limit indicators
-	if errors.Is(err, io.EOF) {
-		return false, 0, err
-	}
-
-	errMsg := err.Error()
-	isRateLimit := contains(errMsg, "rate limit", "quota exceeded", "too many requests")
-
+func (g *geminiClient) shouldRetry(err error) (bool, time.Duration, error) {
 	// Check for token expiration (401 Unauthorized)
-	if contains(errMsg, "unauthorized", "invalid api key", "api key expired") {
+	if contains(err.Error(), "unauthorized", "invalid api key", "api key expired") {
 		prev := g.providerOptions.apiKey
 		// in case the key comes from a script, we try to re-evaluate it.
-		g.providerOptions.apiKey, err = config.Get().Resolve(g.providerOptions.config.APIKey)
-		if err != nil {
-			return false, 0, fmt.Errorf("failed to resolve API key: %w", err)
+		apiKey, resolveErr := config.Get().Resolve(g.providerOptions.config.APIKey)
+		if resolveErr != nil {
+			return false, 0, fmt.Errorf("failed to resolve API key: %w", resolveErr)
 		}
 		// if it didn't change, do not retry.
-		if prev == g.providerOptions.apiKey {
+		if prev == apiKey {
 			return false, 0, err
 		}
+		g.providerOptions.apiKey = apiKey
 		g.client, err = createGeminiClient(g.providerOptions)
 		if err != nil {
 			return false, 0, fmt.Errorf("failed to create Gemini client after API key refresh: %w", err)
 		}
-		return true, 0, nil
+		return true, retryNow, nil
 	}
 
-	// Check for common rate limit error messages
-
-	if !isRateLimit {
-		return false, 0, err
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		if !isRetryableStatus(apiErr.Code) {
+			return false, 0, err
+		}
+		return true, geminiRetryDelay(apiErr), nil
 	}
 
-	// Calculate backoff with jitter
-	backoffMs := 2000 * (1 << (attempts - 1))
-	jitterMs := int(float64(backoffMs) * 0.2)
-	retryMs := backoffMs + jitterMs
+	// Errors that don't come from the API are checked by their message.
+	if contains(err.Error(), "rate limit", "quota exceeded", "too many requests") {
+		return true, 0, nil
+	}
+	return isTransientError(err), 0, err
+}
 
-	return true, int64(retryMs), nil
+// geminiRetryDelay returns the delay asked in the RetryInfo detail of an error,
+// since Gemini doesn't send the Retry-After header.
+func geminiRetryDelay(apiErr genai.APIError) time.Duration {
+	for _, detail := range apiErr.Details {
+		if typ, _ := detail["@type"].(string); !strings.HasSuffix(typ, "google.rpc.RetryInfo") {
+			continue
+		}
+		value, _ := detail["retryDelay"].(string)
+		if delay, err := time.ParseDuration(value); err == nil {
+			return delay
+		}
+	}
+	return 0
 }
 
 func (g *geminiClient) usage(resp *genai.GenerateContentResponse) TokenUsage {
@@ -0,0 +1,233 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/google/uuid"
+)
+
+// mockScript is the content of the script file of a mock provider.
+//
+// Each request is answered by the turn whose index is the number of assistant
+// messages already in the conversation, so a script plays the same way no
+// matter how many providers read it or in which order. A conversation longer
+// than the script fails with an error.
+type mockScript struct {
+	// Pause between two streamed events, to watch a turn being written.
+	DelayMs int64      `json:"delay_ms,omitempty"`
+	Turns   []mockTurn `json:"turns"`
+}
+
+type mockTurn struct {
+	Thinking     []string       `json:"thinking,omitempty"`
+	Content      []string       `json:"content,omitempty"`
+	ToolCalls    []mockToolCall `json:"tool_calls,omitempty"`
+	Usage        mockUsage      `json:"usage,omitempty"`
+	FinishReason string         `json:"finish_reason,omitempty"`
+	// Error fails the turn with this message instead of answering it.
+	Error string `json:"error,omitempty"`
+	// Status is the HTTP status the error stands for, such as 529 for an
+	// overloaded server; see IsUnavailable.
+	Status int `json:"status,omitempty"`
+}
+
+// mockStatusError is the error of a turn that has a status.
+type mockStatusError struct {
+	message string
+	status  int
+}
+
+func (e *mockStatusError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.message, e.status)
+}
+
+type mockToolCall struct {
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type mockUsage struct {
+	InputTokens         int64 `json:"input_tokens,omitempty"`
+	OutputTokens        int64 `json:"output_tokens,omitempty"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+	CacheReadTokens     int64 `json:"cache_read_tokens,omitempty"`
+}
+
+type mockClient struct {
+	providerOptions providerClientOptions
+	scriptPath      string
+}
+
+type MockClient ProviderClient
+
+func newMockClient(opts providerClientOptions) MockClient {
+	scriptPath := opts.config.Script
+	if !filepath.IsAbs(scriptPath) {
+		scriptPath = filepath.Join(config.Get().WorkingDir(), scriptPath)
+	}
+	return &mockClient{
+		providerOptions: opts,
+		scriptPath:      scriptPath,
+	}
+}
+
+// turn reads the script, on every request so it can be edited while the app
+// runs, and returns the turn that answers messages.
+func (m *mockClient) turn(messages []message.Message) (mockScript, mockTurn, error) {
+	data, err := os.ReadFile(m.scriptPath)
+	if err != nil {
+		return mockScript{}, mockTurn{}, fmt.Errorf("failed to read mock script: %w", err)
+	}
+	var script mockScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		return mockScript{}, mockTurn{}, fmt.Errorf("failed to parse mock script %s: %w", m.scriptPath, err)
+	}
+
+	index := 0
+	for _, msg := range messages {
+		if msg.Role == message.Assistant {
+			index++
+		}
+	}
+	if index >= len(script.Turns) {
+		return mockScript{}, mockTurn{}, fmt.Errorf("mock script %s has no turn %d", m.scriptPath, index+1)
+	}
+	turn := script.Turns[index]
+	if turn.Status != 0 {
+		return mockScript{}, mockTurn{}, &mockStatusError{message: cmp.Or(turn.Error, http.StatusText(turn.Status)), status: turn.Status}
+	}
+	if turn.Error != "" {
+		return mockScript{}, mockTurn{}, errors.New(turn.Error)
+	}
+	return script, turn, nil
+}
+
+func (m *mockClient) response(turn mockTurn, toolCalls []message.ToolCall) *ProviderResponse {
+	finishReason := message.FinishReason(turn.FinishReason)
+	if finishReason == "" {
+		finishReason = message.FinishReasonEndTurn
+		if len(toolCalls) > 0 {
+			finishReason = message.FinishReasonToolUse
+		}
+	}
+	return &ProviderResponse{
+		Content:      strings.Join(turn.Content, ""),
+		ToolCalls:    toolCalls,
+		Usage:        TokenUsage(turn.Usage),
+		FinishReason: finishReason,
+	}
+}
+
+func (m *mockClient) toolCalls(turn mockTurn) []message.ToolCall {
+	toolCalls := make([]message.ToolCall, 0, len(turn.ToolCalls))
+	for _, call := range turn.ToolCalls {
+		id := call.ID
+		if id == "" {
+			id = "call_" + uuid.New().String()
+		}
+		input := "{}"
+		if len(call.Input) > 0 {
+			input = string(call.Input)
+		}
+		toolCalls = append(toolCalls, message.ToolCall{
+			ID:       id,
+			Name:     call.Name,
+			Input:    input,
+			Type:     "function",
+			Finished: true,
+		})
+	}
+	return toolCalls
+}
+
+func (m *mockClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	_, turn, err := m.turn(messages)
+	if err != nil {
+		return nil, err
+	}
+	return m.response(turn, m.toolCalls(turn)), nil
+}
+
+func (m *mockClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		script, turn, err := m.turn(messages)
+		if err != nil {
+			eventChan <- ProviderEvent{Type: EventError, Error: err}
+			return
+		}
+		delay := time.Duration(script.DelayMs) * time.Millisecond
+		emit := func(event ProviderEvent) bool {
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					eventChan <- ProviderEvent{Type: EventError, Error: ctx.Err()}
+					return false
+				case <-time.After(delay):
+				}
+			}
+			eventChan <- event
+			return true
+		}
+
+		if !emit(ProviderEvent{Type: EventContentStart}) {
+			return
+		}
+		for _, thinking := range turn.Thinking {
+			if !emit(ProviderEvent{Type: EventThinkingDelta, Thinking: thinking}) {
+				return
+			}
+		}
+		for _, content := range turn.Content {
+			if !emit(ProviderEvent{Type: EventContentDelta, Content: content}) {
+				return
+			}
+		}
+		toolCalls := m.toolCalls(turn)
+		for _, call := range toolCalls {
+			events := []ProviderEvent{
+				{Type: EventToolUseStart, ToolCall: &message.ToolCall{ID: call.ID, Name: call.Name}},
+				{Type: EventToolUseDelta, ToolCall: &message.ToolCall{ID: call.ID, Input: call.Input}},
+				{Type: EventToolUseStop, ToolCall: &call},
+			}
+			for _, event := range events {
+				if !emit(event) {
+					return
+				}
+			}
+		}
+		if !emit(ProviderEvent{Type: EventContentStop}) {
+			return
+		}
+		emit(ProviderEvent{Type: EventComplete, Response: m.response(turn, toolCalls)})
+	}()
+
+	return eventChan
+}
+
+// shouldRetry never retries: the errors of a script are part of what it plays.
+func (m *mockClient) shouldRetry(err error) (bool, time.Duration, error) {
+	return false, 0, err
+}
+
+func (m *mockClient) Model() catwalk.Model {
+	return m.providerOptions.model(m.providerOptions.modelType)
+}
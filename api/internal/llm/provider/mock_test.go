@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockClient(t *testing.T) {
+	scriptPath := filepath.Join(t.TempDir(), "script.json")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(`{"turns": [
+		{"content": ["Hel", "lo"], "tool_calls": [{"name": "ls"}], "usage": {"input_tokens": 3, "output_tokens": 2}},
+		{"error": "overloaded"}
+	]}`), 0o644))
+	client := newMockClient(providerClientOptions{config: config.ProviderConfig{Script: scriptPath}})
+
+	user := message.Message{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Hi"}}}
+	assistant := message.Message{Role: message.Assistant, Parts: []message.ContentPart{message.TextContent{Text: "Hello"}}}
+
+	var types []EventType
+	var resp *ProviderResponse
+	for event := range client.stream(t.Context(), []message.Message{user}, nil) {
+		types = append(types, event.Type)
+		if event.Type == EventComplete {
+			resp = event.Response
+		}
+	}
+	require.Equal(t, []EventType{
+		EventContentStart, EventContentDelta, EventContentDelta,
+		EventToolUseStart, EventToolUseDelta, EventToolUseStop,
+		EventContentStop, EventComplete,
+	}, types)
+	require.Equal(t, "Hello", resp.Content)
+	require.Equal(t, message.FinishReasonToolUse, resp.FinishReason)
+	require.Equal(t, TokenUsage{InputTokens: 3, OutputTokens: 2}, resp.Usage)
+	require.Equal(t, "{}", resp.ToolCalls[0].Input)
+
+	// The turn answered is given by the assistant messages in the history.
+	_, err := client.send(t.Context(), []message.Message{user, assistant, user}, nil)
+	require.EqualError(t, err, "overloaded")
+	_, err = client.send(t.Context(), []message.Message{user, assistant, user, assistant, user}, nil)
+	require.ErrorContains(t, err, "has no turn 3")
+}
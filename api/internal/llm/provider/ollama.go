@@ -0,0 +1,413 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/log"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/google/uuid"
+)
+
+type ollamaClient struct {
+	providerOptions providerClientOptions
+	client          *http.Client
+	baseURL         string
+}
+
+type OllamaClient ProviderClient
+
+func newOllamaClient(opts providerClientOptions) OllamaClient {
+	baseURL := config.DefaultOllamaURL
+	if opts.baseURL != "" {
+		resolvedBaseURL, err := config.Get().Resolve(opts.baseURL)
+		if err == nil && resolvedBaseURL != "" {
+			baseURL = resolvedBaseURL
+		}
+	}
+	client := http.DefaultClient
+	if config.Get().Options.Debug {
+		client = log.NewHTTPClient()
+	}
+	return &ollamaClient{
+		providerOptions: opts,
+		client:          client,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Think    *bool           `json:"think,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string             `json:"type"`
+	Function ollamaToolFunction `json:"function"`
+}
+
+type ollamaToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// ollamaStatusError is returned when the server answers with an error status.
+type ollamaStatusError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *ollamaStatusError) Error() string {
+	return fmt.Sprintf("ollama: %s (status %d)", e.Message, e.StatusCode)
+}
+
+func (o *ollamaClient) convertMessages(messages []message.Message) []ollamaMessage {
+	systemMessage := o.providerOptions.systemMessage
+	if o.providerOptions.systemPromptPrefix != "" {
+		systemMessage = o.providerOptions.systemPromptPrefix + "\n" + systemMessage
+	}
+	ollamaMessages := []ollamaMessage{{Role: "system", Content: systemMessage}}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case message.User:
+			userMsg := ollamaMessage{Role: "user", Content: msg.PromptContent()}
+			for _, binaryContent := range msg.BinaryContent() {
+				userMsg.Images = append(userMsg.Images, base64.StdEncoding.EncodeToString(binaryContent.Data))
+			}
+			ollamaMessages = append(ollamaMessages, userMsg)
+		case message.Assistant:
+			assistantMsg := ollamaMessage{
+				Role:     "assistant",
+				Content:  msg.Content().String(),
+				Thinking: msg.ReasoningContent().Thinking,
+			}
+			// Only include finished tool calls; interrupted tool calls must not be resent.
+			for _, call := range msg.ToolCalls() {
+				if !call.Finished {
+					continue
+				}
+				var toolCall ollamaToolCall
+				toolCall.Function.Name = call.Name
+				toolCall.Function.Arguments = json.RawMessage(call.Input)
+				if !json.Valid(toolCall.Function.Arguments) {
+					toolCall.Function.Arguments = json.RawMessage("{}")
+				}
+				assistantMsg.ToolCalls = append(assistantMsg.ToolCalls, toolCall)
+			}
+			if assistantMsg.Content == "" && len(assistantMsg.ToolCalls) == 0 {
+				continue
+			}
+			ollamaMessages = append(ollamaMessages, assistantMsg)
+		case message.Tool:
+			for _, result := range msg.ToolResults() {
+				ollamaMessages = append(ollamaMessages, ollamaMessage{
+					Role:     "tool",
+					Content:  result.Content,
+					ToolName: result.Name,
+				})
+			}
+		}
+	}
+	return ollamaMessages
+}
+
+func (o *ollamaClient) convertTools(tools []tools.BaseTool) []ollamaTool {
+	ollamaTools := make([]ollamaTool, 0, len(tools))
+	for _, tool := range tools {
+		info := tool.Info()
+		ollamaTools = append(ollamaTools, ollamaTool{
+			Type: "function",
+			Function: ollamaToolFunction{
+				Name:        info.Name,
+				Description: info.Description,
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": info.Parameters,
+					"required":   info.Required,
+				},
+			},
+		})
+	}
+	return ollamaTools
+}
+
+func (o *ollamaClient) finishReason(reason string) message.FinishReason {
+	switch reason {
+	case "stop":
+		return message.FinishReasonEndTurn
+	case "length":
+		return message.FinishReasonMaxTokens
+	default:
+		return message.FinishReasonUnknown
+	}
+}
+
+func (o *ollamaClient) preparedRequest(messages []message.Message, tools []tools.BaseTool, stream bool) ollamaChatRequest {
+	model := o.providerOptions.model(o.providerOptions.modelType)
+	modelConfig := o.providerOptions.modelConfig()
+
+	maxTokens := model.DefaultMaxTokens
+	if modelConfig.MaxTokens > 0 {
+		maxTokens = modelConfig.MaxTokens
+	}
+	// Override max tokens if set in provider options
+	if o.providerOptions.maxTokens > 0 {
+		maxTokens = o.providerOptions.maxTokens
+	}
+
+	options := map[string]any{}
+	// Ollama loads models with a small context by default, which silently
+	// truncates long conversations. Discovered models have a capped window,
+	// see config.DiscoverOllamaModels.
+	if model.ContextWindow > 0 {
+		options["num_ctx"] = model.ContextWindow
+	}
+	if maxTokens > 0 {
+		options["num_predict"] = maxTokens
+	}
+	request := ollamaChatRequest{
+		Model:    model.ID,
+		Messages: o.convertMessages(messages),
+		Tools:    o.convertTools(tools),
+		Stream:   stream,
+		Options:  options,
+	}
+	// Thinking models think unless told not to, and the others reject the
+	// option.
+	if model.CanReason {
+		request.Think = &modelConfig.Think
+	}
+	return request
+}
+
+// chat posts the request to /api/chat and returns the response body, a
+// single JSON object or, when streaming, one JSON object per line.
+func (o *ollamaClient) chat(ctx context.Context, request ollamaChatRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ollama request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.providerOptions.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.providerOptions.apiKey)
+	}
+	for key, value := range o.providerOptions.extraHeaders {
+		req.Header.Set(key, value)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &errResp) != nil || errResp.Error == "" {
+			errResp.Error = strings.TrimSpace(string(data))
+		}
+		return nil, &ollamaStatusError{StatusCode: resp.StatusCode, Message: errResp.Error, RetryAfter: retryAfter(resp.Header)}
+	}
+	return resp.Body, nil
+}
+
+func (o *ollamaClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	request := o.preparedRequest(messages, tools, false)
+	body, err := o.chat(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var resp ollamaChatResponse
+	err = json.NewDecoder(body).Decode(&resp)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ollama response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	toolCalls := o.toolCalls(resp.Message)
+	finishReason := o.finishReason(resp.DoneReason)
+	if len(toolCalls) > 0 {
+		finishReason = message.FinishReasonToolUse
+	}
+	return &ProviderResponse{
+		Content:      resp.Message.Content,
+		ToolCalls:    toolCalls,
+		Usage:        o.usage(resp),
+		FinishReason: finishReason,
+	}, nil
+}
+
+func (o *ollamaClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	request := o.preparedRequest(messages, tools, true)
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		body, err := o.chat(ctx, request)
+		if err != nil {
+			eventChan <- ProviderEvent{Type: EventError, Error: err}
+			return
+		}
+		defer body.Close()
+
+		eventChan <- ProviderEvent{Type: EventContentStart}
+
+		currentContent := ""
+		var toolCalls []message.ToolCall
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var chunk ollamaChatResponse
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				eventChan <- ProviderEvent{Type: EventError, Error: fmt.Errorf("failed to decode ollama response: %w", err)}
+				return
+			}
+			if chunk.Error != "" {
+				eventChan <- ProviderEvent{Type: EventError, Error: errors.New(chunk.Error)}
+				return
+			}
+			if chunk.Message.Thinking != "" {
+				eventChan <- ProviderEvent{Type: EventThinkingDelta, Thinking: chunk.Message.Thinking}
+			}
+			if chunk.Message.Content != "" {
+				eventChan <- ProviderEvent{Type: EventContentDelta, Content: chunk.Message.Content}
+				currentContent += chunk.Message.Content
+			}
+			// Ollama sends each tool call whole, in a single chunk.
+			for _, call := range o.toolCalls(chunk.Message) {
+				eventChan <- ProviderEvent{Type: EventToolUseStart, ToolCall: &message.ToolCall{ID: call.ID, Name: call.Name}}
+				eventChan <- ProviderEvent{Type: EventToolUseDelta, ToolCall: &message.ToolCall{ID: call.ID, Input: call.Input}}
+				eventChan <- ProviderEvent{Type: EventToolUseStop, ToolCall: &call}
+				toolCalls = append(toolCalls, call)
+			}
+			if !chunk.Done {
+				continue
+			}
+
+			eventChan <- ProviderEvent{Type: EventContentStop}
+			finishReason := o.finishReason(chunk.DoneReason)
+			if len(toolCalls) > 0 {
+				finishReason = message.FinishReasonToolUse
+			}
+			eventChan <- ProviderEvent{
+				Type: EventComplete,
+				Response: &ProviderResponse{
+					Content:      currentContent,
+					ToolCalls:    toolCalls,
+					Usage:        o.usage(chunk),
+					FinishReason: finishReason,
+				},
+			}
+			return
+		}
+
+		err = scanner.Err()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			err = errors.New("ollama stream ended before the response was done")
+		}
+		eventChan <- ProviderEvent{Type: EventError, Error: err}
+	}()
+
+	return eventChan
+}
+
+func (o *ollamaClient) shouldRetry(err error) (bool, time.Duration, error) {
+	var statusErr *ollamaStatusError
+	if !errors.As(err, &statusErr) {
+		return isTransientError(err), 0, err
+	}
+	// The server is busy loading a model or has too many queued requests.
+	if statusErr.StatusCode != http.StatusTooManyRequests && statusErr.StatusCode != http.StatusServiceUnavailable {
+		return false, 0, err
+	}
+	return true, statusErr.RetryAfter, nil
+}
+
+func (o *ollamaClient) toolCalls(msg ollamaMessage) []message.ToolCall {
+	var toolCalls []message.ToolCall
+	for _, call := range msg.ToolCalls {
+		input := string(call.Function.Arguments)
+		if input == "" || input == "null" {
+			input = "{}"
+		}
+		toolCalls = append(toolCalls, message.ToolCall{
+			ID:       "call_" + uuid.New().String(),
+			Name:     call.Function.Name,
+			Input:    input,
+			Type:     "function",
+			Finished: true,
+		})
+	}
+	return toolCalls
+}
+
+func (o *ollamaClient) usage(resp ollamaChatResponse) TokenUsage {
+	return TokenUsage{
+		InputTokens:  resp.PromptEvalCount,
+		OutputTokens: resp.EvalCount,
+	}
+}
+
+func (o *ollamaClient) Model() catwalk.Model {
+	return o.providerOptions.model(o.providerOptions.modelType)
+}
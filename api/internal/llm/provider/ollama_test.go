@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOllamaClient(url string) *ollamaClient {
+	return &ollamaClient{
+		providerOptions: providerClientOptions{
+			modelType:     config.SelectedModelTypeLarge,
+			systemMessage: "test",
+			selectedModel: &config.SelectedModel{Provider: "ollama", Model: "qwen3:8b", Think: true},
+			model: func(config.SelectedModelType) catwalk.Model {
+				return catwalk.Model{
+					ID:               "qwen3:8b",
+					ContextWindow:    40960,
+					DefaultMaxTokens: 4096,
+					CanReason:        true,
+				}
+			},
+		},
+		client:  http.DefaultClient,
+		baseURL: url,
+	}
+}
+
+func TestOllamaClientStream(t *testing.T) {
+	var request ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/chat", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"","thinking":"Let me look."},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Reading it."},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"view","arguments":{"file_path":"main.go"}}}]},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":120,"eval_count":30}`)
+	}))
+	defer server.Close()
+
+	messages := []message.Message{
+		{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Open main.go"}}},
+		{Role: message.Assistant, Parts: []message.ContentPart{
+			message.ToolCall{ID: "call_1", Name: "ls", Input: `{"path":"."}`, Finished: true},
+			message.ToolCall{ID: "call_2", Name: "bash", Input: `{"command":"`},
+		}},
+		{Role: message.Tool, Parts: []message.ContentPart{message.ToolResult{ToolCallID: "call_1", Name: "ls", Content: "main.go"}}},
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	var events []ProviderEvent
+	for event := range newTestOllamaClient(server.URL).stream(ctx, messages, nil) {
+		events = append(events, event)
+	}
+
+	require.Equal(t, "qwen3:8b", request.Model)
+	require.True(t, request.Stream)
+	require.NotNil(t, request.Think)
+	require.True(t, *request.Think)
+	require.EqualValues(t, 40960, request.Options["num_ctx"])
+	require.EqualValues(t, 4096, request.Options["num_predict"])
+	require.Len(t, request.Messages, 4)
+	require.Equal(t, "system", request.Messages[0].Role)
+	// The unfinished tool call is not resent.
+	require.Len(t, request.Messages[2].ToolCalls, 1)
+	require.JSONEq(t, `{"path":"."}`, string(request.Messages[2].ToolCalls[0].Function.Arguments))
+	require.Equal(t, ollamaMessage{Role: "tool", Content: "main.go", ToolName: "ls"}, request.Messages[3])
+
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []EventType{
+		EventContentStart, EventThinkingDelta, EventContentDelta,
+		EventToolUseStart, EventToolUseDelta, EventToolUseStop,
+		EventContentStop, EventComplete,
+	}, types)
+
+	resp := events[len(events)-1].Response
+	require.Equal(t, "Reading it.", resp.Content)
+	require.Equal(t, message.FinishReasonToolUse, resp.FinishReason)
+	require.Equal(t, TokenUsage{InputTokens: 120, OutputTokens: 30}, resp.Usage)
+	require.Len(t, resp.ToolCalls, 1)
+	require.Equal(t, "view", resp.ToolCalls[0].Name)
+	require.JSONEq(t, `{"file_path":"main.go"}`, resp.ToolCalls[0].Input)
+	require.True(t, resp.ToolCalls[0].Finished)
+	require.Equal(t, resp.ToolCalls[0].ID, events[3].ToolCall.ID)
+}
+
+func TestOllamaClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"qwen3:8b\" not found, try pulling it first"}`)
+	}))
+	defer server.Close()
+
+	messages := []message.Message{
+		{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Hello"}}},
+	}
+	_, err := newTestOllamaClient(server.URL).send(t.Context(), messages, nil)
+	require.EqualError(t, err, `ollama: model "qwen3:8b" not found, try pulling it first (status 404)`)
+}
+
+func TestOllamaThinkSetting(t *testing.T) {
+	client := newTestOllamaClient("")
+	client.providerOptions.selectedModel.Think = false
+	request := client.preparedRequest(nil, nil, true)
+	require.NotNil(t, request.Think, "thinking models are told not to think")
+	require.False(t, *request.Think)
+
+	client.providerOptions.model = func(config.SelectedModelType) catwalk.Model {
+		return catwalk.Model{ID: "llama3:8b"}
+	}
+	request = client.preparedRequest(nil, nil, true)
+	require.Nil(t, request.Think)
+	require.NotContains(t, request.Options, "num_ctx")
+}
@@ -63,6 +63,9 @@ func createOpenAIClient(opts providerClientOptions) openai.Client {
 		openaiClientOptions = append(openaiClientOptions, option.WithJSONSet(extraKey, extraValue))
 	}
 
+	// Failed requests are retried by the provider, see retryPolicy.
+	openaiClientOptions = append(openaiClientOptions, option.WithMaxRetries(0))
+
 	return openai.NewClient(openaiClientOptions...)
 }
 
@@ -99,7 +102,7 @@ func (o *openaiClient) convertMessages(messages []message.Message) (openaiMessag
 		case message.User:
 			var content []openai.ChatCompletionContentPartUnionParam
 
-			textBlock := openai.ChatCompletionContentPartTextParam{Text: msg.Content().String()}
+			textBlock := openai.ChatCompletionContentPartTextParam{Text: msg.PromptContent()}
 			content = append(content, openai.ChatCompletionContentPartUnionParam{OfText: &textBlock})
 			hasBinaryContent := false
 			for _, binaryContent := range msg.BinaryContent() {
@@ -119,7 +122,7 @@ func (o *openaiClient) convertMessages(messages []message.Message) (openaiMessag
 			if hasBinaryContent || (isAnthropicModel && !o.providerOptions.disableCache) {
 				openaiMessages = append(openaiMessages, openai.UserMessage(content))
 			} else {
-				openaiMessages = append(openaiMessages, openai.UserMessage(msg.Content().String()))
+				openaiMessages = append(openaiMessages, openai.UserMessage(msg.PromptContent()))
 			}
 
 		case message.Assistant:
@@ -219,12 +222,8 @@ func (o *openaiClient) finishReason(reason string) message.FinishReason {
 
 func (o *openaiClient) preparedParams(messages []openai.ChatCompletionMessageParamUnion, tools []openai.ChatCompletionToolParam) openai.ChatCompletionNewParams {
 	model := o.providerOptions.model(o.providerOptions.modelType)
-	cfg := config.Get()
 
-	modelConfig := cfg.Models[config.SelectedModelTypeLarge]
-	if o.providerOptions.modelType == config.SelectedModelTypeSmall {
-		modelConfig = cfg.Models[config.SelectedModelTypeSmall]
-	}
+	modelConfig := o.providerOptions.modelConfig()
 
 	reasoningEffort := modelConfig.ReasoningEffort
 
@@ -266,54 +265,36 @@ func (o *openaiClient) preparedParams(messages []openai.ChatCompletionMessagePar
 
 func (o *openaiClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (response *ProviderResponse, err error) {
 	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
-	attempts := 0
-	for {
-		attempts++
-		openaiResponse, err := o.client.Chat.Completions.New(
-			ctx,
-			params,
-		)
-		// If there is an error we are going to see if we can retry the call
-		if err != nil {
-			retry, after, retryErr := o.shouldRetry(attempts, err)
-			if retryErr != nil {
-				return nil, retryErr
-			}
-			if retry {
-				slog.Warn("Retrying due to rate limit", "attempt", attempts, "max_retries", maxRetries, "error", err)
-				select {
-				case <-ctx.Done():
-					return nil, ctx.Err()
-				case <-time.After(time.Duration(after) * time.Millisecond):
-					continue
-				}
-			}
-			return nil, retryErr
-		}
-
-		if len(openaiResponse.Choices) == 0 {
-			return nil, fmt.Errorf("received empty response from OpenAI API - check endpoint configuration")
-		}
+	openaiResponse, err := o.client.Chat.Completions.New(
+		ctx,
+		params,
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		content := ""
-		if openaiResponse.Choices[0].Message.Content != "" {
-			content = openaiResponse.Choices[0].Message.Content
-		}
+	if len(openaiResponse.Choices) == 0 {
+		return nil, fmt.Errorf("received empty response from OpenAI API - check endpoint configuration")
+	}
 
-		toolCalls := o.toolCalls(*openaiResponse)
-		finishReason := o.finishReason(string(openaiResponse.Choices[0].FinishReason))
+	content := ""
+	if openaiResponse.Choices[0].Message.Content != "" {
+		content = openaiResponse.Choices[0].Message.Content
+	}
 
-		if len(toolCalls) > 0 {
-			finishReason = message.FinishReasonToolUse
-		}
+	toolCalls := o.toolCalls(*openaiResponse)
+	finishReason := o.finishReason(string(openaiResponse.Choices[0].FinishReason))
 
-		return &ProviderResponse{
-			Content:      content,
-			ToolCalls:    toolCalls,
-			Usage:        o.usage(*openaiResponse),
-			FinishReason: finishReason,
-		}, nil
+	if len(toolCalls) > 0 {
+		finishReason = message.FinishReasonToolUse
 	}
+
+	return &ProviderResponse{
+		Content:      content,
+		ToolCalls:    toolCalls,
+		Usage:        o.usage(*openaiResponse),
+		FinishReason: finishReason,
+	}, nil
 }
 
 func (o *openaiClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
@@ -322,247 +303,197 @@ func (o *openaiClient) stream(ctx context.Context, messages []message.Message, t
 		IncludeUsage: openai.Bool(true),
 	}
 
-	attempts := 0
 	eventChan := make(chan ProviderEvent)
 
 	go func() {
-		for {
-			attempts++
-			// Kujtim: fixes an issue with anthropig models on openrouter
-			if len(params.Tools) == 0 {
-				params.Tools = nil
+		defer close(eventChan)
+
+		// Kujtim: fixes an issue with anthropig models on openrouter
+		if len(params.Tools) == 0 {
+			params.Tools = nil
+		}
+		openaiStream := o.client.Chat.Completions.NewStreaming(
+			ctx,
+			params,
+		)
+
+		acc := openai.ChatCompletionAccumulator{}
+		currentContent := ""
+		toolCalls := make([]message.ToolCall, 0)
+		msgToolCalls := make(map[int64]openai.ChatCompletionMessageToolCall)
+		toolMap := make(map[string]openai.ChatCompletionMessageToolCall)
+		toolCallIDMap := make(map[string]string)
+		for openaiStream.Next() {
+			chunk := openaiStream.Current()
+			// Kujtim: this is an issue with openrouter qwen, its sending -1 for the tool index
+			if len(chunk.Choices) != 0 && len(chunk.Choices[0].Delta.ToolCalls) > 0 && chunk.Choices[0].Delta.ToolCalls[0].Index == -1 {
+				chunk.Choices[0].Delta.ToolCalls[0].Index = 0
 			}
-			openaiStream := o.client.Chat.Completions.NewStreaming(
-				ctx,
-				params,
-			)
-
-			acc := openai.ChatCompletionAccumulator{}
-			currentContent := ""
-			toolCalls := make([]message.ToolCall, 0)
-			msgToolCalls := make(map[int64]openai.ChatCompletionMessageToolCall)
-			toolMap := make(map[string]openai.ChatCompletionMessageToolCall)
-			toolCallIDMap := make(map[string]string)
-			for openaiStream.Next() {
-				chunk := openaiStream.Current()
-				// Kujtim: this is an issue with openrouter qwen, its sending -1 for the tool index
-				if len(chunk.Choices) != 0 && len(chunk.Choices[0].Delta.ToolCalls) > 0 && chunk.Choices[0].Delta.ToolCalls[0].Index == -1 {
-					chunk.Choices[0].Delta.ToolCalls[0].Index = 0
-				}
-				acc.AddChunk(chunk)
-				for i, choice := range chunk.Choices {
-					reasoning, ok := choice.Delta.JSON.ExtraFields["reasoning"]
-					if ok && reasoning.Raw() != "" {
-						reasoningStr := ""
-						json.Unmarshal([]byte(reasoning.Raw()), &reasoningStr)
-						if reasoningStr != "" {
-							eventChan <- ProviderEvent{
-								Type:     EventThinkingDelta,
-								Thinking: reasoningStr,
-							}
-						}
-					}
-					if choice.Delta.Content != "" {
+			acc.AddChunk(chunk)
+			for i, choice := range chunk.Choices {
+				reasoning, ok := choice.Delta.JSON.ExtraFields["reasoning"]
+				if ok && reasoning.Raw() != "" {
+					reasoningStr := ""
+					json.Unmarshal([]byte(reasoning.Raw()), &reasoningStr)
+					if reasoningStr != "" {
 						eventChan <- ProviderEvent{
-							Type:    EventContentDelta,
-							Content: choice.Delta.Content,
+							Type:     EventThinkingDelta,
+							Thinking: reasoningStr,
 						}
-						currentContent += choice.Delta.Content
-					} else if len(choice.Delta.ToolCalls) > 0 {
-						toolCall := choice.Delta.ToolCalls[0]
-						if strings.HasPrefix(toolCall.ID, "functions.") {
-							exID, ok := toolCallIDMap[toolCall.ID]
-							if !ok {
-								newID := uuid.NewString()
-								toolCallIDMap[toolCall.ID] = newID
-								toolCall.ID = newID
-							} else {
-								toolCall.ID = exID
-							}
+					}
+				}
+				if choice.Delta.Content != "" {
+					eventChan <- ProviderEvent{
+						Type:    EventContentDelta,
+						Content: choice.Delta.Content,
+					}
+					currentContent += choice.Delta.Content
+				} else if len(choice.Delta.ToolCalls) > 0 {
+					toolCall := choice.Delta.ToolCalls[0]
+					if strings.HasPrefix(toolCall.ID, "functions.") {
+						exID, ok := toolCallIDMap[toolCall.ID]
+						if !ok {
+							newID := uuid.NewString()
+							toolCallIDMap[toolCall.ID] = newID
+							toolCall.ID = newID
+						} else {
+							toolCall.ID = exID
 						}
-						newToolCall := false
-						if existingToolCall, ok := msgToolCalls[toolCall.Index]; ok { // tool call exists
-							if toolCall.ID != "" && toolCall.ID != existingToolCall.ID {
-								found := false
-								// try to find the tool based on the ID
-								for _, tool := range msgToolCalls {
-									if tool.ID == toolCall.ID {
-										existingToolCall.Function.Arguments += toolCall.Function.Arguments
-										msgToolCalls[toolCall.Index] = existingToolCall
-										toolMap[existingToolCall.ID] = existingToolCall
-										found = true
-									}
-								}
-								if !found {
-									newToolCall = true
+					}
+					newToolCall := false
+					if existingToolCall, ok := msgToolCalls[toolCall.Index]; ok { // tool call exists
+						if toolCall.ID != "" && toolCall.ID != existingToolCall.ID {
+							found := false
+							// try to find the tool based on the ID
+							for _, tool := range msgToolCalls {
+								if tool.ID == toolCall.ID {
+									existingToolCall.Function.Arguments += toolCall.Function.Arguments
+									msgToolCalls[toolCall.Index] = existingToolCall
+									toolMap[existingToolCall.ID] = existingToolCall
+									found = true
 								}
-							} else {
-								existingToolCall.Function.Arguments += toolCall.Function.Arguments
-								msgToolCalls[toolCall.Index] = existingToolCall
-								toolMap[existingToolCall.ID] = existingToolCall
+							}
+							if !found {
+								newToolCall = true
 							}
 						} else {
-							newToolCall = true
+							existingToolCall.Function.Arguments += toolCall.Function.Arguments
+							msgToolCalls[toolCall.Index] = existingToolCall
+							toolMap[existingToolCall.ID] = existingToolCall
 						}
-						if newToolCall { // new tool call
-							if toolCall.ID == "" {
-								toolCall.ID = uuid.NewString()
-							}
-							eventChan <- ProviderEvent{
-								Type: EventToolUseStart,
-								ToolCall: &message.ToolCall{
-									ID:       toolCall.ID,
-									Name:     toolCall.Function.Name,
-									Finished: false,
-								},
-							}
-							msgToolCalls[toolCall.Index] = openai.ChatCompletionMessageToolCall{
-								ID:   toolCall.ID,
-								Type: "function",
-								Function: openai.ChatCompletionMessageToolCallFunction{
-									Name:      toolCall.Function.Name,
-									Arguments: toolCall.Function.Arguments,
-								},
-							}
-							toolMap[toolCall.ID] = msgToolCalls[toolCall.Index]
+					} else {
+						newToolCall = true
+					}
+					if newToolCall { // new tool call
+						if toolCall.ID == "" {
+							toolCall.ID = uuid.NewString()
 						}
-						toolCalls := []openai.ChatCompletionMessageToolCall{}
-						for _, tc := range toolMap {
-							toolCalls = append(toolCalls, tc)
+						eventChan <- ProviderEvent{
+							Type: EventToolUseStart,
+							ToolCall: &message.ToolCall{
+								ID:       toolCall.ID,
+								Name:     toolCall.Function.Name,
+								Finished: false,
+							},
+						}
+						msgToolCalls[toolCall.Index] = openai.ChatCompletionMessageToolCall{
+							ID:   toolCall.ID,
+							Type: "function",
+							Function: openai.ChatCompletionMessageToolCallFunction{
+								Name:      toolCall.Function.Name,
+								Arguments: toolCall.Function.Arguments,
+							},
 						}
-						acc.Choices[i].Message.ToolCalls = toolCalls
+						toolMap[toolCall.ID] = msgToolCalls[toolCall.Index]
 					}
-				}
-			}
-
-			err := openaiStream.Err()
-			if err == nil || errors.Is(err, io.EOF) {
-				if len(acc.Choices) == 0 {
-					eventChan <- ProviderEvent{
-						Type:  EventError,
-						Error: fmt.Errorf("received empty streaming response from OpenAI API - check endpoint configuration"),
+					toolCalls := []openai.ChatCompletionMessageToolCall{}
+					for _, tc := range toolMap {
+						toolCalls = append(toolCalls, tc)
 					}
-					return
-				}
-
-				resultFinishReason := acc.Choices[0].FinishReason
-				if resultFinishReason == "" {
-					// If the finish reason is empty, we assume it was a successful completion
-					// INFO: this is happening for openrouter for some reason
-					resultFinishReason = "stop"
-				}
-				// Stream completed successfully
-				finishReason := o.finishReason(resultFinishReason)
-				if len(acc.Choices[0].Message.ToolCalls) > 0 {
-					toolCalls = append(toolCalls, o.toolCalls(acc.ChatCompletion)...)
-				}
-				if len(toolCalls) > 0 {
-					finishReason = message.FinishReasonToolUse
+					acc.Choices[i].Message.ToolCalls = toolCalls
 				}
+			}
+		}
 
+		err := openaiStream.Err()
+		if err == nil || errors.Is(err, io.EOF) {
+			if len(acc.Choices) == 0 {
 				eventChan <- ProviderEvent{
-					Type: EventComplete,
-					Response: &ProviderResponse{
-						Content:      currentContent,
-						ToolCalls:    toolCalls,
-						Usage:        o.usage(acc.ChatCompletion),
-						FinishReason: finishReason,
-					},
+					Type:  EventError,
+					Error: fmt.Errorf("received empty streaming response from OpenAI API - check endpoint configuration"),
 				}
-				close(eventChan)
 				return
 			}
 
-			// If there is an error we are going to see if we can retry the call
-			retry, after, retryErr := o.shouldRetry(attempts, err)
-			if retryErr != nil {
-				eventChan <- ProviderEvent{Type: EventError, Error: retryErr}
-				close(eventChan)
-				return
+			resultFinishReason := acc.Choices[0].FinishReason
+			if resultFinishReason == "" {
+				// If the finish reason is empty, we assume it was a successful completion
+				// INFO: this is happening for openrouter for some reason
+				resultFinishReason = "stop"
 			}
-			if retry {
-				slog.Warn("Retrying due to rate limit", "attempt", attempts, "max_retries", maxRetries, "error", err)
-				select {
-				case <-ctx.Done():
-					// context cancelled
-					if ctx.Err() != nil {
-						eventChan <- ProviderEvent{Type: EventError, Error: ctx.Err()}
-					}
-					close(eventChan)
-					return
-				case <-time.After(time.Duration(after) * time.Millisecond):
-					continue
-				}
+			// Stream completed successfully
+			finishReason := o.finishReason(resultFinishReason)
+			if len(acc.Choices[0].Message.ToolCalls) > 0 {
+				toolCalls = append(toolCalls, o.toolCalls(acc.ChatCompletion)...)
+			}
+			if len(toolCalls) > 0 {
+				finishReason = message.FinishReasonToolUse
+			}
+
+			eventChan <- ProviderEvent{
+				Type: EventComplete,
+				Response: &ProviderResponse{
+					Content:      currentContent,
+					ToolCalls:    toolCalls,
+					Usage:        o.usage(acc.ChatCompletion),
+					FinishReason: finishReason,
+				},
 			}
-			eventChan <- ProviderEvent{Type: EventError, Error: retryErr}
-			close(eventChan)
 			return
 		}
+
+		eventChan <- ProviderEvent{Type: EventError, Error: err}
 	}()
 
 	return eventChan
 }
 
-func (o *openaiClient) shouldRetry(attempts int, err error) (bool, int64, error) {
-	if attempts > maxRetries {
-		return false, 0, fmt.Errorf("maximum retry attempts reached for rate limit: %d retries", maxRetries)
-	}
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false, 0, err
-	}
+func (o *openaiClient) shouldRetry(err error) (bool, time.Duration, error) {
 	var apiErr *openai.Error
-	retryMs := 0
-	retryAfterValues := []string{}
-	if errors.As(err, &apiErr) {
-		// Check for token expiration (401 Unauthorized)
-		if apiErr.StatusCode == http.StatusUnauthorized {
-			prev := o.providerOptions.apiKey
-			// in case the key comes from a script, we try to re-evaluate it.
-			o.providerOptions.apiKey, err = config.Get().Resolve(o.providerOptions.config.APIKey)
-			if err != nil {
-				return false, 0, fmt.Errorf("failed to resolve API key: %w", err)
-			}
-			// if it didn't change, do not retry.
-			if prev == o.providerOptions.apiKey {
-				return false, 0, err
-			}
-			o.client = createOpenAIClient(o.providerOptions)
-			return true, 0, nil
-		}
+	if !errors.As(err, &apiErr) {
+		return isTransientError(err), 0, err
+	}
 
-		if apiErr.StatusCode == http.StatusTooManyRequests {
-			// Check if this is an insufficient quota error (permanent)
-			if apiErr.Type == "insufficient_quota" || apiErr.Code == "insufficient_quota" {
-				return false, 0, fmt.Errorf("OpenAI quota exceeded: %s. Please check your plan and billing details", apiErr.Message)
-			}
-			// Other 429 errors (rate limiting) can be retried
-		} else if apiErr.StatusCode != http.StatusInternalServerError {
-			return false, 0, err
+	// Check for token expiration (401 Unauthorized)
+	if apiErr.StatusCode == http.StatusUnauthorized {
+		prev := o.providerOptions.apiKey
+		// in case the key comes from a script, we try to re-evaluate it.
+		o.providerOptions.apiKey, err = config.Get().Resolve(o.providerOptions.config.APIKey)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to resolve API key: %w", err)
 		}
-
-		if apiErr.Response != nil {
-			retryAfterValues = apiErr.Response.Header.Values("Retry-After")
+		// if it didn't change, do not retry.
+		if prev == o.providerOptions.apiKey {
+			return false, 0, apiErr
 		}
+		o.client = createOpenAIClient(o.providerOptions)
+		return true, retryNow, nil
 	}
 
-	if apiErr != nil {
-		slog.Warn("OpenAI API error", "status_code", apiErr.StatusCode, "message", apiErr.Message, "type", apiErr.Type)
-		if len(retryAfterValues) > 0 {
-			slog.Warn("Retry-After header", "values", retryAfterValues)
-		}
-	} else {
-		slog.Error("OpenAI API error", "error", err.Error(), "attempt", attempts, "max_retries", maxRetries)
+	// Check if this is an insufficient quota error (permanent)
+	if apiErr.StatusCode == http.StatusTooManyRequests && (apiErr.Type == "insufficient_quota" || apiErr.Code == "insufficient_quota") {
+		return false, 0, fmt.Errorf("OpenAI quota exceeded: %s. Please check your plan and billing details", apiErr.Message)
+	}
+	if !isRetryableStatus(apiErr.StatusCode) {
+		return false, 0, err
 	}
 
-	backoffMs := 2000 * (1 << (attempts - 1))
-	jitterMs := int(float64(backoffMs) * 0.2)
-	retryMs = backoffMs + jitterMs
-	if len(retryAfterValues) > 0 {
-		if _, err := fmt.Sscanf(retryAfterValues[0], "%d", &retryMs); err == nil {
-			retryMs = retryMs * 1000
-		}
+	slog.Warn("OpenAI API error", "status_code", apiErr.StatusCode, "message", apiErr.Message, "type", apiErr.Type)
+	var header http.Header
+	if apiErr.Response != nil {
+		header = apiErr.Response.Header
 	}
-	return true, int64(retryMs), nil
+	return true, retryAfter(header), nil
 }
 
 func (o *openaiClient) toolCalls(completion openai.ChatCompletion) []message.ToolCall {
@@ -0,0 +1,321 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+	"github.com/openai/openai-go/shared"
+)
+
+// openaiResponsesClient talks to the OpenAI Responses API. It shares the
+// client, the retry logic and the model of the Chat Completions one.
+type openaiResponsesClient struct {
+	*openaiClient
+}
+
+type OpenAIResponsesClient ProviderClient
+
+func newOpenAIResponsesClient(opts providerClientOptions) OpenAIResponsesClient {
+	return &openaiResponsesClient{
+		openaiClient: &openaiClient{
+			providerOptions: opts,
+			client:          createOpenAIClient(opts),
+		},
+	}
+}
+
+// responsesReasoning is a reasoning item of a response. Requests aren't stored
+// by OpenAI, so the encrypted items are kept in the signature of the message
+// reasoning and sent back on the next turns.
+type responsesReasoning struct {
+	ID               string `json:"id"`
+	EncryptedContent string `json:"encrypted_content"`
+}
+
+func (o *openaiResponsesClient) convertMessages(messages []message.Message) (input responses.ResponseInputParam) {
+	for _, msg := range messages {
+		switch msg.Role {
+		case message.User:
+			content := responses.ResponseInputMessageContentListParam{
+				responses.ResponseInputContentParamOfInputText(msg.PromptContent()),
+			}
+			for _, binaryContent := range msg.BinaryContent() {
+				image := responses.ResponseInputContentParamOfInputImage(responses.ResponseInputImageDetailAuto)
+				image.OfInputImage.ImageURL = openai.String(binaryContent.String(catwalk.InferenceProviderOpenAI))
+				content = append(content, image)
+			}
+			input = append(input, responses.ResponseInputItemParamOfMessage(content, responses.EasyInputMessageRoleUser))
+
+		case message.Assistant:
+			// Reasoning items must come before the output they produced.
+			for _, reasoning := range o.reasoningItems(msg.ReasoningContent().Signature) {
+				item := responses.ResponseInputItemParamOfReasoning(reasoning.ID, []responses.ResponseReasoningItemSummaryParam{})
+				item.OfReasoning.EncryptedContent = openai.String(reasoning.EncryptedContent)
+				input = append(input, item)
+			}
+			if text := msg.Content().String(); text != "" {
+				input = append(input, responses.ResponseInputItemParamOfMessage(text, responses.EasyInputMessageRoleAssistant))
+			}
+			// Only include finished tool calls; interrupted tool calls must not be resent.
+			for _, call := range msg.ToolCalls() {
+				if call.Finished {
+					input = append(input, responses.ResponseInputItemParamOfFunctionCall(call.Input, call.ID, call.Name))
+				}
+			}
+
+		case message.Tool:
+			for _, result := range msg.ToolResults() {
+				input = append(input, responses.ResponseInputItemParamOfFunctionCallOutput(result.ToolCallID, result.Content))
+			}
+		}
+	}
+	return input
+}
+
+// reasoningItems decodes the reasoning items kept in a message signature. A
+// signature written by another client is ignored.
+func (o *openaiResponsesClient) reasoningItems(signature string) []responsesReasoning {
+	if signature == "" {
+		return nil
+	}
+	var items []responsesReasoning
+	if err := json.Unmarshal([]byte(signature), &items); err != nil {
+		slog.Debug("Ignoring reasoning signature not created by the Responses API", "error", err)
+		return nil
+	}
+	return items
+}
+
+func (o *openaiResponsesClient) convertTools(tools []tools.BaseTool) []responses.ToolUnionParam {
+	responsesTools := make([]responses.ToolUnionParam, len(tools))
+	for i, tool := range tools {
+		info := tool.Info()
+		responsesTools[i] = responses.ToolUnionParam{
+			OfFunction: &responses.FunctionToolParam{
+				Name:        info.Name,
+				Description: openai.String(info.Description),
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": info.Parameters,
+					"required":   info.Required,
+				},
+				Strict: openai.Bool(false),
+			},
+		}
+	}
+	return responsesTools
+}
+
+func (o *openaiResponsesClient) preparedParams(input responses.ResponseInputParam, tools []responses.ToolUnionParam) responses.ResponseNewParams {
+	model := o.providerOptions.model(o.providerOptions.modelType)
+	modelConfig := o.providerOptions.modelConfig()
+
+	systemMessage := o.providerOptions.systemMessage
+	if o.providerOptions.systemPromptPrefix != "" {
+		systemMessage = o.providerOptions.systemPromptPrefix + "\n" + systemMessage
+	}
+
+	params := responses.ResponseNewParams{
+		Model:        shared.ResponsesModel(model.ID),
+		Instructions: openai.String(systemMessage),
+		Input:        responses.ResponseNewParamsInputUnion{OfInputItemList: input},
+		Store:        openai.Bool(false),
+	}
+	if len(tools) > 0 {
+		params.Tools = tools
+		params.ParallelToolCalls = openai.Bool(true)
+	}
+
+	maxTokens := model.DefaultMaxTokens
+	if modelConfig.MaxTokens > 0 {
+		maxTokens = modelConfig.MaxTokens
+	}
+	// Override max tokens if set in provider options
+	if o.providerOptions.maxTokens > 0 {
+		maxTokens = o.providerOptions.maxTokens
+	}
+	if maxTokens > 0 {
+		params.MaxOutputTokens = openai.Int(maxTokens)
+	}
+
+	if model.CanReason {
+		params.Reasoning = shared.ReasoningParam{
+			Effort:  shared.ReasoningEffort(modelConfig.ReasoningEffort),
+			Summary: shared.ReasoningSummaryAuto,
+		}
+		params.Include = []responses.ResponseIncludable{responses.ResponseIncludableReasoningEncryptedContent}
+	}
+	return params
+}
+
+func (o *openaiResponsesClient) finishReason(resp responses.Response) message.FinishReason {
+	switch resp.Status {
+	case responses.ResponseStatusCompleted:
+		return message.FinishReasonEndTurn
+	case responses.ResponseStatusIncomplete:
+		if resp.IncompleteDetails.Reason == "max_output_tokens" {
+			return message.FinishReasonMaxTokens
+		}
+	}
+	return message.FinishReasonUnknown
+}
+
+func (o *openaiResponsesClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+	resp, err := o.client.Responses.New(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	toolCalls := o.toolCalls(*resp)
+	finishReason := o.finishReason(*resp)
+	if len(toolCalls) > 0 {
+		finishReason = message.FinishReasonToolUse
+	}
+	return &ProviderResponse{
+		Content:      resp.OutputText(),
+		ToolCalls:    toolCalls,
+		Usage:        o.usage(*resp),
+		FinishReason: finishReason,
+	}, nil
+}
+
+func (o *openaiResponsesClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	params := o.preparedParams(o.convertMessages(messages), o.convertTools(tools))
+
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		responsesStream := o.client.Responses.NewStreaming(ctx, params)
+
+		eventChan <- ProviderEvent{Type: EventContentStart}
+
+		currentContent := ""
+		var toolCalls []message.ToolCall
+		var reasoning []responsesReasoning
+		// Deltas of the arguments refer to the item, not to the call ID.
+		callIDs := make(map[string]string)
+		for responsesStream.Next() {
+			event := responsesStream.Current()
+			switch event.Type {
+			case "response.output_text.delta":
+				eventChan <- ProviderEvent{Type: EventContentDelta, Content: event.Delta.OfString}
+				currentContent += event.Delta.OfString
+			case "response.reasoning_summary_part.added":
+				if event.SummaryIndex > 0 {
+					eventChan <- ProviderEvent{Type: EventThinkingDelta, Thinking: "\n\n"}
+				}
+			case "response.reasoning_summary_text.delta":
+				eventChan <- ProviderEvent{Type: EventThinkingDelta, Thinking: event.Delta.OfString}
+			case "response.output_item.added":
+				if event.Item.Type == "function_call" {
+					callIDs[event.Item.ID] = event.Item.CallID
+					eventChan <- ProviderEvent{
+						Type:     EventToolUseStart,
+						ToolCall: &message.ToolCall{ID: event.Item.CallID, Name: event.Item.Name},
+					}
+				}
+			case "response.function_call_arguments.delta":
+				eventChan <- ProviderEvent{
+					Type:     EventToolUseDelta,
+					ToolCall: &message.ToolCall{ID: callIDs[event.ItemID], Input: event.Delta.OfString},
+				}
+			case "response.output_item.done":
+				switch event.Item.Type {
+				case "function_call":
+					toolCall := message.ToolCall{
+						ID:       event.Item.CallID,
+						Name:     event.Item.Name,
+						Input:    event.Item.Arguments,
+						Type:     "function",
+						Finished: true,
+					}
+					eventChan <- ProviderEvent{Type: EventToolUseStop, ToolCall: &toolCall}
+					toolCalls = append(toolCalls, toolCall)
+				case "reasoning":
+					if event.Item.EncryptedContent != "" {
+						reasoning = append(reasoning, responsesReasoning{ID: event.Item.ID, EncryptedContent: event.Item.EncryptedContent})
+					}
+				}
+			case "response.completed", "response.incomplete":
+				if len(reasoning) > 0 {
+					signature, _ := json.Marshal(reasoning)
+					eventChan <- ProviderEvent{Type: EventSignatureDelta, Signature: string(signature)}
+				}
+				eventChan <- ProviderEvent{Type: EventContentStop}
+
+				finishReason := o.finishReason(event.Response)
+				if len(toolCalls) > 0 {
+					finishReason = message.FinishReasonToolUse
+				}
+				eventChan <- ProviderEvent{
+					Type: EventComplete,
+					Response: &ProviderResponse{
+						Content:      currentContent,
+						ToolCalls:    toolCalls,
+						Usage:        o.usage(event.Response),
+						FinishReason: finishReason,
+					},
+				}
+				return
+			case "response.failed":
+				eventChan <- ProviderEvent{Type: EventError, Error: fmt.Errorf("OpenAI response failed: %s", event.Response.Error.Message)}
+				return
+			case "error":
+				eventChan <- ProviderEvent{Type: EventError, Error: fmt.Errorf("OpenAI stream error: %s", event.Message)}
+				return
+			}
+		}
+
+		err := responsesStream.Err()
+		if err == nil || errors.Is(err, io.EOF) {
+			eventChan <- ProviderEvent{
+				Type:  EventError,
+				Error: fmt.Errorf("the OpenAI stream ended before the response was completed"),
+			}
+			return
+		}
+
+		eventChan <- ProviderEvent{Type: EventError, Error: err}
+	}()
+
+	return eventChan
+}
+
+func (o *openaiResponsesClient) toolCalls(resp responses.Response) []message.ToolCall {
+	var toolCalls []message.ToolCall
+	for _, item := range resp.Output {
+		if item.Type != "function_call" {
+			continue
+		}
+		toolCalls = append(toolCalls, message.ToolCall{
+			ID:       item.CallID,
+			Name:     item.Name,
+			Input:    item.Arguments,
+			Type:     "function",
+			Finished: true,
+		})
+	}
+	return toolCalls
+}
+
+func (o *openaiResponsesClient) usage(resp responses.Response) TokenUsage {
+	cachedTokens := resp.Usage.InputTokensDetails.CachedTokens
+	return TokenUsage{
+		InputTokens:     resp.Usage.InputTokens - cachedTokens,
+		OutputTokens:    resp.Usage.OutputTokens,
+		CacheReadTokens: cachedTokens,
+	}
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAIResponsesClientStream(t *testing.T) {
+	var request map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/responses", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &request))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for _, event := range []string{
+			`{"type":"response.output_item.added","output_index":0,"item":{"type":"reasoning","id":"rs_2","summary":[]}}`,
+			`{"type":"response.reasoning_summary_part.added","item_id":"rs_2","summary_index":0}`,
+			`{"type":"response.reasoning_summary_text.delta","item_id":"rs_2","summary_index":0,"delta":"Checking files"}`,
+			`{"type":"response.reasoning_summary_part.added","item_id":"rs_2","summary_index":1}`,
+			`{"type":"response.reasoning_summary_text.delta","item_id":"rs_2","summary_index":1,"delta":"Reading both"}`,
+			`{"type":"response.output_item.done","output_index":0,"item":{"type":"reasoning","id":"rs_2","summary":[],"encrypted_content":"enc-2"}}`,
+			`{"type":"response.output_text.delta","item_id":"msg_1","delta":"Reading."}`,
+			`{"type":"response.output_item.added","output_index":2,"item":{"type":"function_call","id":"fc_1","call_id":"call_a","name":"view","arguments":""}}`,
+			`{"type":"response.output_item.added","output_index":3,"item":{"type":"function_call","id":"fc_2","call_id":"call_b","name":"view","arguments":""}}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_2","delta":"{\"file_path\":\"b.go\"}"}`,
+			`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"file_path\":\"a.go\"}"}`,
+			`{"type":"response.output_item.done","output_index":2,"item":{"type":"function_call","id":"fc_1","call_id":"call_a","name":"view","arguments":"{\"file_path\":\"a.go\"}"}}`,
+			`{"type":"response.output_item.done","output_index":3,"item":{"type":"function_call","id":"fc_2","call_id":"call_b","name":"view","arguments":"{\"file_path\":\"b.go\"}"}}`,
+			`{"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":100,"input_tokens_details":{"cached_tokens":40},"output_tokens":20}}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	client := &openaiResponsesClient{
+		openaiClient: &openaiClient{
+			providerOptions: providerClientOptions{
+				modelType:     config.SelectedModelTypeLarge,
+				systemMessage: "test",
+				selectedModel: &config.SelectedModel{Provider: "openai", Model: "o4-mini", ReasoningEffort: "high"},
+				model: func(config.SelectedModelType) catwalk.Model {
+					return catwalk.Model{ID: "o4-mini", DefaultMaxTokens: 1000, CanReason: true}
+				},
+			},
+			client: openai.NewClient(
+				option.WithAPIKey("test-key"),
+				option.WithBaseURL(server.URL),
+			),
+		},
+	}
+
+	messages := []message.Message{
+		{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "Compare a.go and b.go"}}},
+		{Role: message.Assistant, Parts: []message.ContentPart{
+			message.ReasoningContent{Thinking: "Listing", Signature: `[{"id":"rs_1","encrypted_content":"enc-1"}]`},
+			message.ToolCall{ID: "call_0", Name: "ls", Input: `{"path":"."}`, Finished: true},
+		}},
+		{Role: message.Tool, Parts: []message.ContentPart{message.ToolResult{ToolCallID: "call_0", Name: "ls", Content: "a.go b.go"}}},
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	var events []ProviderEvent
+	for event := range client.stream(ctx, messages, nil) {
+		require.NotEqual(t, EventError, event.Type, "unexpected error: %v", event.Error)
+		events = append(events, event)
+	}
+
+	require.Equal(t, "o4-mini", request["model"])
+	require.Equal(t, "test", request["instructions"])
+	require.Equal(t, false, request["store"])
+	require.Equal(t, []any{"reasoning.encrypted_content"}, request["include"])
+	require.Equal(t, map[string]any{"effort": "high", "summary": "auto"}, request["reasoning"])
+	input := request["input"].([]any)
+	require.Len(t, input, 4)
+	require.Equal(t, "reasoning", input[1].(map[string]any)["type"])
+	require.Equal(t, "rs_1", input[1].(map[string]any)["id"])
+	require.Equal(t, "enc-1", input[1].(map[string]any)["encrypted_content"])
+	require.Equal(t, "function_call", input[2].(map[string]any)["type"])
+	require.Equal(t, "call_0", input[2].(map[string]any)["call_id"])
+	require.Equal(t, "function_call_output", input[3].(map[string]any)["type"])
+	require.Equal(t, "a.go b.go", input[3].(map[string]any)["output"])
+
+	var thinking, signature string
+	var deltas []message.ToolCall
+	for _, event := range events {
+		switch event.Type {
+		case EventThinkingDelta:
+			thinking += event.Thinking
+		case EventSignatureDelta:
+			signature += event.Signature
+		case EventToolUseDelta:
+			deltas = append(deltas, *event.ToolCall)
+		}
+	}
+	require.Equal(t, "Checking files\n\nReading both", thinking)
+	require.JSONEq(t, `[{"id":"rs_2","encrypted_content":"enc-2"}]`, signature)
+	// Parallel calls stream their arguments interleaved.
+	require.Equal(t, []message.ToolCall{
+		{ID: "call_b", Input: `{"file_path":"b.go"}`},
+		{ID: "call_a", Input: `{"file_path":"a.go"}`},
+	}, deltas)
+
+	resp := events[len(events)-1].Response
+	require.Equal(t, EventComplete, events[len(events)-1].Type)
+	require.Equal(t, "Reading.", resp.Content)
+	require.Equal(t, message.FinishReasonToolUse, resp.FinishReason)
+	require.Equal(t, TokenUsage{InputTokens: 60, OutputTokens: 20, CacheReadTokens: 40}, resp.Usage)
+	require.Len(t, resp.ToolCalls, 2)
+	require.Equal(t, "call_a", resp.ToolCalls[0].ID)
+	require.Equal(t, "call_b", resp.ToolCalls[1].ID)
+}
@@ -118,7 +118,7 @@ func TestOpenAIClient429InsufficientQuotaError(t *testing.T) {
 		Code:       "insufficient_quota",
 	}
 
-	retry, _, err := client.shouldRetry(1, apiErr)
+	retry, _, err := client.shouldRetry(apiErr)
 	if retry {
 		t.Error("Expected shouldRetry to return false for insufficient_quota error, but got true")
 	}
@@ -157,7 +157,7 @@ func TestOpenAIClient429RateLimitError(t *testing.T) {
 		Code:       "rate_limit_exceeded",
 	}
 
-	retry, _, err := client.shouldRetry(1, apiErr)
+	retry, _, err := client.shouldRetry(apiErr)
 	if !retry {
 		t.Error("Expected shouldRetry to return true for rate_limit_exceeded error, but got false")
 	}
@@ -1,8 +1,12 @@
 package provider
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
 
@@ -13,8 +17,6 @@ import (
 
 type EventType string
 
-const maxRetries = 3
-
 const (
 	EventContentStart   EventType = "content_start"
 	EventToolUseStart   EventType = "tool_use_start"
@@ -67,6 +69,7 @@ type providerClientOptions struct {
 	apiKey             string
 	modelType          config.SelectedModelType
 	model              func(config.SelectedModelType) catwalk.Model
+	selectedModel      *config.SelectedModel
 	disableCache       bool
 	systemMessage      string
 	systemPromptPrefix string
@@ -78,10 +81,29 @@ type providerClientOptions struct {
 
 type ProviderClientOption func(*providerClientOptions)
 
+// modelConfig returns the selected model the client talks to: the one given
+// by WithSelectedModel or else the one configured for the model type.
+func (o providerClientOptions) modelConfig() config.SelectedModel {
+	if o.selectedModel != nil {
+		return *o.selectedModel
+	}
+	cfg := config.Get()
+	if o.modelType == config.SelectedModelTypeSmall {
+		return cfg.Models[config.SelectedModelTypeSmall]
+	}
+	return cfg.Models[config.SelectedModelTypeLarge]
+}
+
 type ProviderClient interface {
 	send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error)
 	stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent
 
+	// shouldRetry tells whether a failed request may succeed if sent again,
+	// and how long the server asked to wait before that, or retryNow when the
+	// client fixed the request itself. When it doesn't, the error returned is
+	// the one to report.
+	shouldRetry(err error) (bool, time.Duration, error)
+
 	Model() catwalk.Model
 }
 
@@ -96,6 +118,14 @@ func (p *baseProvider[C]) cleanMessages(messages []message.Message) (cleaned []m
 		if len(msg.Parts) == 0 {
 			continue
 		}
+		// Reasoning and its signature only make sense to the provider that
+		// produced them, e.g. when a fallback provider answered a turn.
+		if msg.Provider != "" && msg.Provider != p.options.config.ID {
+			msg.Parts = slices.DeleteFunc(slices.Clone(msg.Parts), func(part message.ContentPart) bool {
+				_, ok := part.(message.ReasoningContent)
+				return ok
+			})
+		}
 		cleaned = append(cleaned, msg)
 	}
 	return cleaned
@@ -103,12 +133,128 @@ func (p *baseProvider[C]) cleanMessages(messages []message.Message) (cleaned []m
 
 func (p *baseProvider[C]) SendMessages(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
 	messages = p.cleanMessages(messages)
-	return p.client.send(ctx, messages, tools)
+	policy := newRetryPolicy(p.options.config)
+	for retry := 1; ; retry++ {
+		if err := policy.allow(); err != nil {
+			return nil, err
+		}
+		resp, err := p.client.send(ctx, messages, tools)
+		if err == nil {
+			policy.success()
+			return resp, nil
+		}
+		delay, retryErr := p.retryDelay(policy, retry, err)
+		if retryErr != nil {
+			return nil, retryErr
+		}
+		slog.Warn("Retrying provider request", "provider", p.options.config.ID, "retry", retry, "max_retries", policy.maxRetries, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
 }
 
+// StreamResponse streams the response of the client, sending the request again
+// while it fails before any output. A warning event tells how long until the
+// next try. Once output was streamed the error is left to the caller, since
+// what was shown can't be taken back.
 func (p *baseProvider[C]) StreamResponse(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
 	messages = p.cleanMessages(messages)
-	return p.client.stream(ctx, messages, tools)
+	policy := newRetryPolicy(p.options.config)
+	eventChan := make(chan ProviderEvent)
+
+	go func() {
+		defer close(eventChan)
+
+		started := false
+		for retry := 1; ; retry++ {
+			if err := policy.allow(); err != nil {
+				eventChan <- ProviderEvent{Type: EventError, Error: err}
+				return
+			}
+
+			var failed error
+			output := false
+			for event := range p.client.stream(ctx, messages, tools) {
+				switch event.Type {
+				case EventError:
+					failed = event.Error
+					continue
+				case EventContentStart:
+					if started {
+						continue
+					}
+					started = true
+				default:
+					output = true
+				}
+				eventChan <- event
+			}
+			if failed == nil {
+				policy.success()
+				return
+			}
+			if output {
+				if retryable, after, _ := p.client.shouldRetry(failed); !retryable {
+					policy.success()
+				} else if after != retryNow {
+					policy.failure()
+				}
+				eventChan <- ProviderEvent{Type: EventError, Error: failed}
+				return
+			}
+
+			delay, err := p.retryDelay(policy, retry, failed)
+			if err != nil {
+				eventChan <- ProviderEvent{Type: EventError, Error: err}
+				return
+			}
+			slog.Warn("Retrying provider request", "provider", p.options.config.ID, "retry", retry, "max_retries", policy.maxRetries, "delay", delay, "error", failed)
+			if delay == 0 {
+				continue
+			}
+			eventChan <- ProviderEvent{
+				Type:    EventWarning,
+				Content: fmt.Sprintf("%s failed, retrying in %s (retry %d of %d): %v", cmp.Or(p.options.config.Name, p.options.config.ID), delay.Round(100*time.Millisecond), retry, policy.maxRetries, failed),
+			}
+			select {
+			case <-ctx.Done():
+				eventChan <- ProviderEvent{Type: EventError, Error: ctx.Err()}
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+
+	return eventChan
+}
+
+// retryDelay returns how long to wait before sending again a request that
+// failed with err, or the error to report if it must not be sent again.
+func (p *baseProvider[C]) retryDelay(policy retryPolicy, retry int, err error) (time.Duration, error) {
+	retryable, after, retryErr := p.client.shouldRetry(err)
+	if !retryable {
+		// An error a retry wouldn't fix, like a bad request, still shows the
+		// provider is up.
+		policy.success()
+		if retryErr != nil {
+			return 0, retryErr
+		}
+		return 0, err
+	}
+	if after != retryNow {
+		policy.failure()
+	}
+	delay, ok := policy.delay(retry, after)
+	if !ok {
+		if retry > policy.maxRetries {
+			return 0, fmt.Errorf("maximum retry attempts reached: %d retries: %w", policy.maxRetries, err)
+		}
+		return 0, fmt.Errorf("%w (the provider asked to wait %s)", err, after.Round(time.Second))
+	}
+	return delay, nil
 }
 
 func (p *baseProvider[C]) Model() catwalk.Model {
@@ -133,6 +279,20 @@ func WithSystemMessage(systemMessage string) ProviderClientOption {
 	}
 }
 
+// WithSelectedModel makes the client use model, with its options, instead of
+// the model configured for the model type. Fallback providers use it.
+func WithSelectedModel(model config.SelectedModel) ProviderClientOption {
+	return func(options *providerClientOptions) {
+		options.selectedModel = &model
+		options.model = func(config.SelectedModelType) catwalk.Model {
+			if m := config.Get().GetModel(model.Provider, model.Model); m != nil {
+				return *m
+			}
+			return catwalk.Model{ID: model.Model, Name: model.Model}
+		}
+	}
+}
+
 func WithMaxTokens(maxTokens int64) ProviderClientOption {
 	return func(options *providerClientOptions) {
 		options.maxTokens = maxTokens
@@ -172,6 +332,14 @@ func NewProvider(cfg config.ProviderConfig, opts ...ProviderClientOption) (Provi
 	for _, o := range opts {
 		o(&clientOptions)
 	}
+	p, err := newProvider(cfg, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	return withCassette(p, clientOptions), nil
+}
+
+func newProvider(cfg config.ProviderConfig, clientOptions providerClientOptions) (Provider, error) {
 	switch cfg.Type {
 	case catwalk.TypeAnthropic:
 		return &baseProvider[AnthropicClient]{
@@ -179,6 +347,12 @@ func NewProvider(cfg config.ProviderConfig, opts ...ProviderClientOption) (Provi
 			client:  newAnthropicClient(clientOptions, AnthropicClientTypeNormal),
 		}, nil
 	case catwalk.TypeOpenAI:
+		if cfg.ResponsesAPI {
+			return &baseProvider[OpenAIResponsesClient]{
+				options: clientOptions,
+				client:  newOpenAIResponsesClient(clientOptions),
+			}, nil
+		}
 		return &baseProvider[OpenAIClient]{
 			options: clientOptions,
 			client:  newOpenAIClient(clientOptions),
@@ -203,6 +377,16 @@ func NewProvider(cfg config.ProviderConfig, opts ...ProviderClientOption) (Provi
 			options: clientOptions,
 			client:  newVertexAIClient(clientOptions),
 		}, nil
+	case config.TypeOllama:
+		return &baseProvider[OllamaClient]{
+			options: clientOptions,
+			client:  newOllamaClient(clientOptions),
+		}, nil
+	case config.TypeMock:
+		return &baseProvider[MockClient]{
+			options: clientOptions,
+			client:  newMockClient(clientOptions),
+		}, nil
 	}
 	return nil, fmt.Errorf("provider not supported: %s", cfg.Type)
 }
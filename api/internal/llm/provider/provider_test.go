@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanMessagesDropsReasoningOfOtherProviders(t *testing.T) {
+	p := &baseProvider[OpenAIClient]{options: providerClientOptions{config: config.ProviderConfig{ID: "openai"}}}
+	reasoning := message.ReasoningContent{Thinking: "hmm", Signature: "sig"}
+	text := message.TextContent{Text: "answer"}
+	messages := []message.Message{
+		{Role: message.Assistant, Provider: "anthropic", Parts: []message.ContentPart{reasoning, text}},
+		{Role: message.Assistant, Provider: "openai", Parts: []message.ContentPart{reasoning, text}},
+		{Role: message.Assistant, Parts: []message.ContentPart{reasoning, text}},
+		{Role: message.Assistant, Provider: "anthropic"},
+	}
+
+	cleaned := p.cleanMessages(messages)
+	require.Len(t, cleaned, 3)
+	require.Equal(t, []message.ContentPart{text}, cleaned[0].Parts)
+	require.Equal(t, []message.ContentPart{reasoning, text}, cleaned[1].Parts)
+	require.Equal(t, []message.ContentPart{reasoning, text}, cleaned[2].Parts)
+	// The history itself is left alone.
+	require.Len(t, messages[0].Parts, 2)
+}
+
+func TestWithSelectedModel(t *testing.T) {
+	opts := providerClientOptions{modelType: config.SelectedModelTypeLarge}
+	WithSelectedModel(config.SelectedModel{Provider: "missing", Model: "fallback-model", MaxTokens: 123})(&opts)
+
+	require.Equal(t, int64(123), opts.modelConfig().MaxTokens)
+	require.Equal(t, "fallback-model", opts.model(config.SelectedModelTypeLarge).ID)
+}
@@ -0,0 +1,274 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+// ErrCircuitOpen is returned without calling a provider that failed too many
+// times in a row, until its cooldown ends.
+var ErrCircuitOpen = errors.New("provider is unavailable")
+
+// retryNow is the delay shouldRetry returns when the client changed what it
+// sends so the request may now succeed, like a refreshed API key or a lower
+// max_tokens. The request is sent again at once, and the failure doesn't count
+// against the circuit breaker.
+const retryNow time.Duration = -1
+
+const (
+	defaultMaxRetries       = 3
+	defaultInitialDelay     = 2 * time.Second
+	defaultMaxDelay         = 60 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// retryPolicy decides how many times and after how long a failed request to a
+// provider is sent again. The clients only tell whether an error is worth a
+// retry; the policy is the same for all of them.
+type retryPolicy struct {
+	maxRetries   int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	breaker      *circuitBreaker
+}
+
+func newRetryPolicy(cfg config.ProviderConfig) retryPolicy {
+	retry := cfg.Retry
+	policy := retryPolicy{
+		maxRetries:   defaultMaxRetries,
+		initialDelay: defaultInitialDelay,
+		maxDelay:     defaultMaxDelay,
+	}
+	if retry.MaxRetries > 0 {
+		policy.maxRetries = retry.MaxRetries
+	} else if retry.MaxRetries < 0 {
+		policy.maxRetries = 0
+	}
+	if retry.InitialDelayMs > 0 {
+		policy.initialDelay = time.Duration(retry.InitialDelayMs) * time.Millisecond
+	}
+	if retry.MaxDelayMs > 0 {
+		policy.maxDelay = time.Duration(retry.MaxDelayMs) * time.Millisecond
+	}
+	if retry.BreakerThreshold >= 0 {
+		threshold := defaultBreakerThreshold
+		if retry.BreakerThreshold > 0 {
+			threshold = retry.BreakerThreshold
+		}
+		cooldown := defaultBreakerCooldown
+		if retry.BreakerCooldownS > 0 {
+			cooldown = time.Duration(retry.BreakerCooldownS) * time.Second
+		}
+		policy.breaker = breakerFor(cfg.ID, threshold, cooldown)
+	}
+	return policy
+}
+
+// delay returns how long to wait before the given retry, starting at 1, and
+// whether to retry at all. The delay asked by the server is honored unless it
+// is longer than the maximum delay, in which case the request fails so that a
+// fallback model can answer instead.
+func (p retryPolicy) delay(retry int, after time.Duration) (time.Duration, bool) {
+	if retry > p.maxRetries {
+		return 0, false
+	}
+	if after == retryNow {
+		return 0, true
+	}
+	if after > 0 {
+		return after, after <= p.maxDelay
+	}
+	backoff := p.initialDelay << (retry - 1)
+	if backoff <= 0 || backoff > p.maxDelay {
+		backoff = p.maxDelay
+	}
+	// Equal jitter keeps at least half the backoff while spreading out
+	// clients that failed at the same time.
+	half := backoff / 2
+	return half + rand.N(half+1), true
+}
+
+// allow returns ErrCircuitOpen while the provider is considered down.
+func (p retryPolicy) allow() error {
+	if p.breaker == nil {
+		return nil
+	}
+	return p.breaker.allow()
+}
+
+func (p retryPolicy) success() {
+	if p.breaker != nil {
+		p.breaker.success()
+	}
+}
+
+func (p retryPolicy) failure() {
+	if p.breaker != nil {
+		p.breaker.failure()
+	}
+}
+
+// circuitBreaker stops calling a provider after a number of consecutive
+// failed attempts. Once the cooldown ends one request goes through: the
+// breaker closes if it succeeds or fails with an error that a retry wouldn't
+// fix, and opens again if it fails with a retryable one.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+var breakers = struct {
+	sync.Mutex
+	byProvider map[string]*circuitBreaker
+}{byProvider: make(map[string]*circuitBreaker)}
+
+// breakerFor returns the breaker of a provider, shared by all its clients, so
+// an outage seen by the coder also stops the title and summary requests.
+func breakerFor(providerID string, threshold int, cooldown time.Duration) *circuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.byProvider[providerID]
+	if !ok {
+		b = &circuitBreaker{name: providerID, now: time.Now}
+		breakers.byProvider[providerID] = b
+	}
+	b.mu.Lock()
+	b.threshold = threshold
+	b.cooldown = cooldown
+	b.mu.Unlock()
+	return b
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return fmt.Errorf("%w: %s failed %d times in a row, retrying it in %s", ErrCircuitOpen, b.name, b.failures, b.openUntil.Sub(now).Round(time.Second))
+	}
+	// Half open: let this request through, and fail fast the others until
+	// it is done.
+	b.openUntil = now.Add(b.cooldown)
+	return nil
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// retryAfter reads how long the server asked to wait from the headers of its
+// response: retry-after-ms, or Retry-After in seconds or as an HTTP date.
+func retryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// isRetryableStatus reports whether a response status means the server is
+// busy or failing rather than the request being wrong.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		529: // 529 (unofficial): the service is overloaded
+		return true
+	}
+	return false
+}
+
+// IsUnavailable reports whether err means the provider can't answer for now:
+// it is rate limited, overloaded or failing (status 429, 5xx or 529), or its
+// circuit breaker is open. Another provider may answer the same request, which
+// is not the case when the request itself is wrong.
+func IsUnavailable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	status, ok := statusCode(err)
+	return ok && (isRetryableStatus(status) || status >= http.StatusInternalServerError)
+}
+
+// statusCode returns the HTTP status of the error response err comes from.
+func statusCode(err error) (int, bool) {
+	var anthropicErr *anthropic.Error
+	var openaiErr *openai.Error
+	var geminiErr genai.APIError
+	var ollamaErr *ollamaStatusError
+	var mockErr *mockStatusError
+	switch {
+	case errors.As(err, &anthropicErr):
+		return anthropicErr.StatusCode, true
+	case errors.As(err, &openaiErr):
+		return openaiErr.StatusCode, true
+	case errors.As(err, &geminiErr):
+		return geminiErr.Code, true
+	case errors.As(err, &ollamaErr):
+		return ollamaErr.StatusCode, true
+	case errors.As(err, &mockErr):
+		return mockErr.status, true
+	}
+	return 0, false
+}
+
+// isTransientError reports whether err is a network failure that may not
+// happen again, such as a dropped or refused connection.
+func isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
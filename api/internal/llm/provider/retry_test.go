@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/tools"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errOverloaded = errors.New("overloaded")
+	errBadRequest = errors.New("bad request")
+)
+
+// flakyClient fails its first requests with err, errOverloaded by default,
+// asking to wait after before sending them again.
+type flakyClient struct {
+	failures int
+	err      error
+	after    time.Duration
+	calls    int
+}
+
+func (f *flakyClient) send(ctx context.Context, messages []message.Message, tools []tools.BaseTool) (*ProviderResponse, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, cmp.Or(f.err, errOverloaded)
+	}
+	return &ProviderResponse{Content: "Hi", FinishReason: message.FinishReasonEndTurn}, nil
+}
+
+func (f *flakyClient) stream(ctx context.Context, messages []message.Message, tools []tools.BaseTool) <-chan ProviderEvent {
+	eventChan := make(chan ProviderEvent, 3)
+	f.calls++
+	eventChan <- ProviderEvent{Type: EventContentStart}
+	if f.calls <= f.failures {
+		eventChan <- ProviderEvent{Type: EventError, Error: cmp.Or(f.err, errOverloaded)}
+	} else {
+		eventChan <- ProviderEvent{Type: EventContentDelta, Content: "Hi"}
+		eventChan <- ProviderEvent{Type: EventComplete, Response: &ProviderResponse{Content: "Hi"}}
+	}
+	close(eventChan)
+	return eventChan
+}
+
+func (f *flakyClient) shouldRetry(err error) (bool, time.Duration, error) {
+	return errors.Is(err, errOverloaded), f.after, err
+}
+
+func (f *flakyClient) Model() catwalk.Model {
+	return catwalk.Model{ID: "flaky"}
+}
+
+func newFlakyProvider(t *testing.T, failures int, retry config.Retry) (*baseProvider[ProviderClient], *flakyClient) {
+	client := &flakyClient{failures: failures}
+	return &baseProvider[ProviderClient]{
+		// The circuit breakers are shared by provider ID.
+		options: providerClientOptions{config: config.ProviderConfig{ID: t.Name(), Retry: retry}},
+		client:  client,
+	}, client
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := newRetryPolicy(config.ProviderConfig{Retry: config.Retry{InitialDelayMs: 1000, MaxDelayMs: 3000, BreakerThreshold: -1}})
+
+	for retry, backoff := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 3 * time.Second} {
+		delay, ok := policy.delay(retry, 0)
+		require.True(t, ok)
+		require.GreaterOrEqual(t, delay, backoff/2)
+		require.LessOrEqual(t, delay, backoff)
+	}
+
+	_, ok := policy.delay(4, 0)
+	require.False(t, ok, "more retries than the limit")
+
+	delay, ok := policy.delay(1, 2500*time.Millisecond)
+	require.True(t, ok)
+	require.Equal(t, 2500*time.Millisecond, delay)
+	_, ok = policy.delay(1, time.Minute)
+	require.False(t, ok, "the server asked to wait longer than the maximum delay")
+	delay, ok = policy.delay(1, retryNow)
+	require.True(t, ok)
+	require.Zero(t, delay)
+	_, ok = policy.delay(4, retryNow)
+	require.False(t, ok, "immediate retries count against the limit too")
+
+	disabled := newRetryPolicy(config.ProviderConfig{Retry: config.Retry{MaxRetries: -1, BreakerThreshold: -1}})
+	_, ok = disabled.delay(1, 0)
+	require.False(t, ok)
+	require.Nil(t, disabled.breaker)
+}
+
+func TestRetryAfter(t *testing.T) {
+	require.Equal(t, time.Duration(0), retryAfter(nil))
+	require.Equal(t, 12*time.Second, retryAfter(http.Header{"Retry-After": {"12"}}))
+	require.Equal(t, 1500*time.Millisecond, retryAfter(http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"2"}}))
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	after := retryAfter(http.Header{"Retry-After": {date}})
+	require.Greater(t, after, 58*time.Second)
+	require.LessOrEqual(t, after, time.Minute)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := &circuitBreaker{name: "test", threshold: 2, cooldown: 30 * time.Second, now: func() time.Time { return now }}
+
+	b.failure()
+	require.NoError(t, b.allow())
+	b.failure()
+	require.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	// After the cooldown a single request goes through.
+	now = now.Add(31 * time.Second)
+	require.NoError(t, b.allow())
+	require.ErrorIs(t, b.allow(), ErrCircuitOpen)
+
+	b.success()
+	require.NoError(t, b.allow())
+}
+
+func TestBaseProviderStreamRetries(t *testing.T) {
+	p, client := newFlakyProvider(t, 2, config.Retry{InitialDelayMs: 1})
+
+	var types []EventType
+	var warnings []string
+	for event := range p.StreamResponse(t.Context(), nil, nil) {
+		types = append(types, event.Type)
+		if event.Type == EventWarning {
+			warnings = append(warnings, event.Content)
+		}
+	}
+	require.Equal(t, []EventType{EventContentStart, EventWarning, EventWarning, EventContentDelta, EventComplete}, types)
+	require.Equal(t, 3, client.calls)
+	require.Contains(t, warnings[0], "retrying in")
+	require.Contains(t, warnings[1], "(retry 2 of 3)")
+}
+
+func TestBaseProviderSendRetries(t *testing.T) {
+	p, client := newFlakyProvider(t, 5, config.Retry{MaxRetries: 2, InitialDelayMs: 1, BreakerThreshold: -1})
+
+	_, err := p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, errOverloaded)
+	require.ErrorContains(t, err, "maximum retry attempts reached")
+	require.Equal(t, 3, client.calls)
+}
+
+func TestBaseProviderCircuitOpen(t *testing.T) {
+	p, client := newFlakyProvider(t, 10, config.Retry{MaxRetries: 5, InitialDelayMs: 1, BreakerThreshold: 2})
+
+	var last ProviderEvent
+	for event := range p.StreamResponse(t.Context(), nil, nil) {
+		last = event
+	}
+	require.Equal(t, EventError, last.Type)
+	require.ErrorIs(t, last.Error, ErrCircuitOpen)
+	require.Equal(t, 2, client.calls)
+
+	// The open breaker fails the next requests without calling the client.
+	_, err := p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, 2, client.calls)
+}
+
+func TestBaseProviderRetryNow(t *testing.T) {
+	// The delay and the breaker would fail the test if they applied.
+	p, client := newFlakyProvider(t, 2, config.Retry{InitialDelayMs: 60000, BreakerThreshold: 1})
+	client.after = retryNow
+
+	var types []EventType
+	for event := range p.StreamResponse(t.Context(), nil, nil) {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []EventType{EventContentStart, EventContentDelta, EventComplete}, types)
+	require.Equal(t, 3, client.calls)
+
+	client.calls = 0
+	resp, err := p.SendMessages(t.Context(), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Hi", resp.Content)
+	require.Equal(t, 3, client.calls)
+}
+
+func TestBaseProviderProbeClosesOnNonRetryableError(t *testing.T) {
+	p, client := newFlakyProvider(t, 10, config.Retry{MaxRetries: -1, BreakerThreshold: 1, BreakerCooldownS: 30})
+	_, err := p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, errOverloaded)
+	_, err = p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, ErrCircuitOpen)
+
+	// The probe after the cooldown gets an answer a retry wouldn't fix: the
+	// provider is up, so the breaker closes.
+	b := breakerFor(t.Name(), 1, 30*time.Second)
+	b.mu.Lock()
+	b.now = func() time.Time { return time.Now().Add(31 * time.Second) }
+	b.mu.Unlock()
+	client.err = errBadRequest
+	_, err = p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, errBadRequest)
+	_, err = p.SendMessages(t.Context(), nil, nil)
+	require.ErrorIs(t, err, errBadRequest)
+	require.Equal(t, 3, client.calls)
+}
@@ -0,0 +1,353 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SplitCommandLine splits a slash command line into arguments. Arguments are
+// separated by unquoted whitespace; single quotes keep their content verbatim,
+// double quotes accept backslash escapes (\", \\, \n, \t). Outside quotes a
+// backslash only escapes whitespace or a quote and is otherwise kept, so
+// Windows paths like C:\src\main.go need no quoting. Newlines inside quotes
+// are kept.
+func SplitCommandLine(line string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	runes := []rune(line)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			if quote == '"' {
+				switch r {
+				case 'n':
+					r = '\n'
+				case 't':
+					r = '\t'
+				case '"', '\\':
+				default:
+					current.WriteRune('\\')
+				}
+			}
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote == '"':
+			escaped = true
+		case r == '\\' && quote == 0:
+			inArg = true
+			if i+1 < len(runes) && strings.ContainsRune(" \t\n\r\"'", runes[i+1]) {
+				escaped = true
+			} else {
+				current.WriteRune(r)
+			}
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// commandParams returns the parameter names in positional order: required
+// parameters in the order they are declared, then the optional ones sorted.
+func commandParams(info ToolInfo) []string {
+	names := make([]string, 0, len(info.Parameters))
+	for _, name := range info.Required {
+		if _, ok := info.Parameters[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var optional []string
+	for name := range info.Parameters {
+		if !slices.Contains(info.Required, name) {
+			optional = append(optional, name)
+		}
+	}
+	slices.Sort(optional)
+	return append(names, optional...)
+}
+
+// paramSchema returns the JSON schema of a parameter as a map, if any.
+func paramSchema(info ToolInfo, name string) map[string]any {
+	schema, _ := info.Parameters[name].(map[string]any)
+	return schema
+}
+
+// schemaType returns the JSON schema type, ignoring "null" in type unions.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	case []string:
+		for _, s := range t {
+			if s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// schemaEnum returns the allowed values of a parameter, if restricted.
+func schemaEnum(schema map[string]any) []any {
+	switch e := schema["enum"].(type) {
+	case []any:
+		return e
+	case []string:
+		enum := make([]any, len(e))
+		for i, v := range e {
+			enum[i] = v
+		}
+		return enum
+	}
+	return nil
+}
+
+// convertValue converts a command line value to the type declared by schema.
+func convertValue(schema map[string]any, value string) (any, error) {
+	var (
+		result any
+		err    error
+	)
+	switch schemaType(schema) {
+	case "string":
+		result = value
+	case "integer":
+		result, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", value)
+		}
+	case "number":
+		result, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %q", value)
+		}
+	case "boolean":
+		result, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false, got %q", value)
+		}
+	case "array":
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var items []any
+			if err := json.Unmarshal([]byte(value), &items); err != nil {
+				return nil, fmt.Errorf("invalid JSON array: %w", err)
+			}
+			return items, nil
+		}
+		itemSchema, _ := schema["items"].(map[string]any)
+		var items []any
+		for part := range strings.SplitSeq(value, ",") {
+			item, err := convertValue(itemSchema, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case "object":
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(value), &obj); err != nil {
+			return nil, fmt.Errorf("invalid JSON object: %w", err)
+		}
+		return obj, nil
+	default:
+		// Untyped parameter: accept JSON literals, fall back to a plain string.
+		var v any
+		if json.Unmarshal([]byte(value), &v) == nil {
+			return v, nil
+		}
+		return value, nil
+	}
+
+	if enum := schemaEnum(schema); len(enum) > 0 {
+		if !slices.ContainsFunc(enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(result) }) {
+			return nil, fmt.Errorf("%q is not one of %v", value, enum)
+		}
+	}
+	return result, nil
+}
+
+// BuildCommandInput builds the JSON input of a tool from slash command
+// arguments, using the tool's parameter schema to map and convert them.
+//
+// Positional arguments fill the required parameters in declaration order, or
+// the optional ones in alphabetical order when the tool requires none. Any
+// parameter may be given as a flag: --name=value, --name value, or just
+// --name for booleans; dashes in a flag name match underscores when no
+// parameter has the name as written. Array
+// parameters take JSON arrays or comma separated values and may be repeated.
+// A value with spaces must be quoted, as in /write file.txt "some text";
+// positional arguments beyond the parameters left to fill are an error.
+func BuildCommandInput(info ToolInfo, args []string) (string, error) {
+	params := commandParams(info)
+	input := make(map[string]any)
+	var positional []string
+
+	set := func(name, value string) error {
+		schema := paramSchema(info, name)
+		v, err := convertValue(schema, value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		if schemaType(schema) == "array" {
+			if prev, ok := input[name].([]any); ok {
+				v = append(prev, v.([]any)...)
+			}
+		}
+		input[name] = v
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") || len(arg) == 2 {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg[2:], "=")
+		if _, ok := info.Parameters[name]; !ok {
+			underscored := strings.ReplaceAll(name, "-", "_")
+			if _, ok := info.Parameters[underscored]; !ok {
+				return "", fmt.Errorf("unknown flag --%s", name)
+			}
+			name = underscored
+		}
+		if !hasValue {
+			if schemaType(paramSchema(info, name)) == "boolean" {
+				value = "true"
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return "", fmt.Errorf("flag --%s requires a value", name)
+			}
+		}
+		if err := set(name, value); err != nil {
+			return "", err
+		}
+	}
+
+	// Positional arguments fill the parameters not given as flags.
+	if len(info.Required) > 0 {
+		params = slices.DeleteFunc(params, func(name string) bool {
+			return !slices.Contains(info.Required, name)
+		})
+	}
+	var free []string
+	for _, name := range params {
+		if _, ok := input[name]; !ok {
+			free = append(free, name)
+		}
+	}
+	if len(positional) > len(free) {
+		return "", fmt.Errorf("too many arguments: %q; quote values that contain spaces", strings.Join(positional[len(free):], " "))
+	}
+	for i, value := range positional {
+		if err := set(free[i], value); err != nil {
+			return "", err
+		}
+	}
+
+	var missing []string
+	for _, name := range info.Required {
+		if _, ok := input[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing required argument(s): %s", strings.Join(missing, ", "))
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// CommandUsage returns a usage help text for invoking the tool as a slash command.
+func CommandUsage(info ToolInfo) string {
+	params := commandParams(info)
+	var b strings.Builder
+	b.WriteString("/" + info.Name)
+	for _, name := range params {
+		if slices.Contains(info.Required, name) {
+			fmt.Fprintf(&b, " <%s>", name)
+		}
+	}
+	for _, name := range params {
+		if slices.Contains(info.Required, name) {
+			continue
+		}
+		if t := schemaType(paramSchema(info, name)); t == "boolean" {
+			fmt.Fprintf(&b, " [--%s]", name)
+		} else if t != "" {
+			fmt.Fprintf(&b, " [--%s=<%s>]", name, t)
+		} else {
+			fmt.Fprintf(&b, " [--%s=<value>]", name)
+		}
+	}
+	if len(params) == 0 {
+		return b.String()
+	}
+
+	width := 0
+	for _, name := range params {
+		width = max(width, len(name))
+	}
+	b.WriteString("\n")
+	for _, name := range params {
+		schema := paramSchema(info, name)
+		desc, _ := schema["description"].(string)
+		desc = strings.Join(strings.Fields(desc), " ")
+		if t := schemaType(schema); t != "" {
+			desc = fmt.Sprintf("(%s) %s", t, desc)
+		}
+		if enum := schemaEnum(schema); len(enum) > 0 {
+			desc += fmt.Sprintf(" One of: %v.", enum)
+		}
+		fmt.Fprintf(&b, "\n  %-*s  %s", width, name, strings.TrimSpace(desc))
+	}
+	b.WriteString("\n\nQuote values that contain spaces.")
+	return b.String()
+}
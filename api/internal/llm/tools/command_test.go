@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", line: "view  main.go\t10", want: []string{"view", "main.go", "10"}},
+		{name: "double quotes", line: `view "my file.go"`, want: []string{"view", "my file.go"}},
+		{name: "single quotes", line: `write a.txt 'say "hi" \n'`, want: []string{"write", "a.txt", `say "hi" \n`}},
+		{name: "escapes", line: `write a.txt "line1\nline2 \"q\""`, want: []string{"write", "a.txt", "line1\nline2 \"q\""}},
+		{name: "escaped space", line: `view my\ file.go`, want: []string{"view", "my file.go"}},
+		{name: "windows path", line: `view C:\src\main.go`, want: []string{"view", `C:\src\main.go`}},
+		{name: "windows path with escaped space", line: `view C:\my\ src\main.go`, want: []string{"view", `C:\my src\main.go`}},
+		{name: "unc path and trailing backslash", line: `ls \\server\share\`, want: []string{"ls", `\\server\share\`}},
+		{name: "multiline quoted", line: "write a.txt \"one\ntwo\"", want: []string{"write", "a.txt", "one\ntwo"}},
+		{name: "empty quoted", line: `grep ""`, want: []string{"grep", ""}},
+		{name: "unterminated", line: `view "main.go`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := SplitCommandLine(tt.line)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildCommandInput(t *testing.T) {
+	t.Parallel()
+
+	info := ToolInfo{
+		Name: "sample",
+		Parameters: map[string]any{
+			"path":        map[string]any{"type": "string"},
+			"content":     map[string]any{"type": "string"},
+			"limit":       map[string]any{"type": "integer"},
+			"force":       map[string]any{"type": "boolean"},
+			"ignore":      map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"format":      map[string]any{"type": "string", "enum": []string{"text", "html"}},
+			"some_flag":   map[string]any{"type": "boolean"},
+			"max-results": map[string]any{"type": "integer"},
+		},
+		Required: []string{"path", "content"},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "positional",
+			args: []string{"a.txt", "hello"},
+			want: map[string]any{"path": "a.txt", "content": "hello"},
+		},
+		{
+			name: "quoted value with spaces",
+			args: []string{"a.txt", "hello world"},
+			want: map[string]any{"path": "a.txt", "content": "hello world"},
+		},
+		{
+			name: "flags",
+			args: []string{"--limit=5", "--force", "--path", "a.txt", "--content=x", "--ignore=a,b", "--ignore", `["c"]`},
+			want: map[string]any{"path": "a.txt", "content": "x", "limit": float64(5), "force": true, "ignore": []any{"a", "b", "c"}},
+		},
+		{
+			name: "dashes match underscores and positionals fill the rest",
+			args: []string{"--some-flag", "a.txt", "body"},
+			want: map[string]any{"path": "a.txt", "content": "body", "some_flag": true},
+		},
+		{
+			name: "dashed parameter names match as written",
+			args: []string{"a.txt", "b", "--max-results=3"},
+			want: map[string]any{"path": "a.txt", "content": "b", "max-results": float64(3)},
+		},
+		{
+			name: "double dash ends flags",
+			args: []string{"a.txt", "--", "--not-a-flag"},
+			want: map[string]any{"path": "a.txt", "content": "--not-a-flag"},
+		},
+		{name: "too many arguments", args: []string{"a.txt", "hello", "world"}, wantErr: `too many arguments: "world"`},
+		{name: "missing required", args: []string{"a.txt"}, wantErr: "missing required argument(s): content"},
+		{name: "unknown flag", args: []string{"--nope=1"}, wantErr: "unknown flag --nope"},
+		{name: "bad integer", args: []string{"a", "b", "--limit=x"}, wantErr: "invalid value for limit"},
+		{name: "enum", args: []string{"a", "b", "--format=pdf"}, wantErr: "is not one of"},
+		{name: "flag without value", args: []string{"a", "b", "--limit"}, wantErr: "flag --limit requires a value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			input, err := BuildCommandInput(info, tt.args)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var got map[string]any
+			require.NoError(t, json.Unmarshal([]byte(input), &got))
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommandUsage(t *testing.T) {
+	t.Parallel()
+
+	info := ToolInfo{
+		Name: "view",
+		Parameters: map[string]any{
+			"file_path": map[string]any{"type": "string", "description": "The path"},
+			"offset":    map[string]any{"type": "integer", "description": "Line offset"},
+			"raw":       map[string]any{"type": "boolean"},
+		},
+		Required: []string{"file_path"},
+	}
+	usage := CommandUsage(info)
+	require.Contains(t, usage, "/view <file_path> [--offset=<integer>] [--raw]")
+	require.Contains(t, usage, "file_path  (string) The path")
+	require.Contains(t, usage, "Quote values that contain spaces.")
+}
@@ -97,12 +97,14 @@ func (t *downloadTool) Run(ctx context.Context, call ToolCall) (ToolResponse, er
 		return NewTextErrorResponse("URL must start with http:// or https://"), nil
 	}
 
-	// Convert relative path to absolute path
-	var filePath string
-	if filepath.IsAbs(params.FilePath) {
-		filePath = params.FilePath
-	} else {
-		filePath = filepath.Join(t.workingDir, params.FilePath)
+	filePath, outside, err := resolveWorkspacePath(t.workingDir, params.FilePath)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, t.permissions, call, DownloadToolName, "download", "Download file", filePath, DownloadPermissionsParams{URL: params.URL, FilePath: filePath, Timeout: params.Timeout}); err != nil {
+			return ToolResponse{}, err
+		}
 	}
 
 	sessionID, messageID := GetContextValues(ctx)
@@ -100,12 +100,18 @@ func (e *editTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		return NewTextErrorResponse("file_path is required"), nil
 	}
 
-	if !filepath.IsAbs(params.FilePath) {
-		params.FilePath = filepath.Join(e.workingDir, params.FilePath)
+	filePath, outside, err := resolveWorkspacePath(e.workingDir, params.FilePath)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, e.permissions, call, EditToolName, "write", "Edit file", filePath, EditPermissionsParams{FilePath: filePath}); err != nil {
+			return ToolResponse{}, err
+		}
 	}
+	params.FilePath = filePath
 
 	var response ToolResponse
-	var err error
 
 	if params.OldString == "" {
 		response, err = e.createNewFile(ctx, params.FilePath, params.NewString, call)
@@ -190,7 +196,7 @@ func (e *editTool) createNewFile(ctx context.Context, filePath, content string,
 	}
 
 	// File can't be in the history so we create a new file history
-	_, err = e.files.Create(ctx, sessionID, filePath, "")
+	_, err = e.files.CreateMissing(ctx, sessionID, filePath)
 	if err != nil {
 		// Log error but don't fail the operation
 		return ToolResponse{}, fmt.Errorf("error creating file history: %w", err)
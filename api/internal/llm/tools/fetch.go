@@ -59,6 +59,10 @@ func (t *fetchTool) Name() string {
 	return FetchToolName
 }
 
+func (t *fetchTool) ReadOnly() bool {
+	return true
+}
+
 func (t *fetchTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        FetchToolName,
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	_ "embed"
 	"encoding/json"
@@ -13,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/upperxcode/jx2ai-agent/api/internal/fsext"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
 )
 
 const GlobToolName = "glob"
@@ -31,12 +33,14 @@ type GlobResponseMetadata struct {
 }
 
 type globTool struct {
-	workingDir string
+	permissions permission.Service
+	workingDir  string
 }
 
-func NewGlobTool(workingDir string) BaseTool {
+func NewGlobTool(permissions permission.Service, workingDir string) BaseTool {
 	return &globTool{
-		workingDir: workingDir,
+		permissions: permissions,
+		workingDir:  workingDir,
 	}
 }
 
@@ -44,6 +48,10 @@ func (g *globTool) Name() string {
 	return GlobToolName
 }
 
+func (g *globTool) ReadOnly() bool {
+	return true
+}
+
 func (g *globTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        GlobToolName,
@@ -72,9 +80,15 @@ func (g *globTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		return NewTextErrorResponse("pattern is required"), nil
 	}
 
-	searchPath := params.Path
-	if searchPath == "" {
-		searchPath = g.workingDir
+	// Resolve the path inside the workspace and request permission if it is outside
+	searchPath, outside, err := resolveWorkspacePath(g.workingDir, cmp.Or(params.Path, g.workingDir))
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, g.permissions, call, GlobToolName, "search", "Search files", searchPath, params); err != nil {
+			return ToolResponse{}, err
+		}
 	}
 
 	files, truncated, err := globFiles(ctx, params.Pattern, searchPath, 100)
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	_ "embed"
 	"encoding/json"
@@ -18,6 +19,7 @@ import (
 	"time"
 
 	"github.com/upperxcode/jx2ai-agent/api/internal/fsext"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
 )
 
 // regexCache provides thread-safe caching of compiled regex patterns
@@ -90,7 +92,8 @@ type GrepResponseMetadata struct {
 }
 
 type grepTool struct {
-	workingDir string
+	permissions permission.Service
+	workingDir  string
 }
 
 const GrepToolName = "grep"
@@ -98,9 +101,10 @@ const GrepToolName = "grep"
 //go:embed grep.md
 var grepDescription []byte
 
-func NewGrepTool(workingDir string) BaseTool {
+func NewGrepTool(permissions permission.Service, workingDir string) BaseTool {
 	return &grepTool{
-		workingDir: workingDir,
+		permissions: permissions,
+		workingDir:  workingDir,
 	}
 }
 
@@ -108,6 +112,10 @@ func (g *grepTool) Name() string {
 	return GrepToolName
 }
 
+func (g *grepTool) ReadOnly() bool {
+	return true
+}
+
 func (g *grepTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        GrepToolName,
@@ -162,9 +170,15 @@ func (g *grepTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		searchPattern = escapeRegexPattern(params.Pattern)
 	}
 
-	searchPath := params.Path
-	if searchPath == "" {
-		searchPath = g.workingDir
+	// Resolve the path inside the workspace and request permission if it is outside
+	searchPath, outside, err := resolveWorkspacePath(g.workingDir, cmp.Or(params.Path, g.workingDir))
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, g.permissions, call, GrepToolName, "search", "Search file contents", searchPath, params); err != nil {
+			return ToolResponse{}, err
+		}
 	}
 
 	matches, truncated, err := searchFiles(ctx, searchPattern, searchPath, params.Include, 100)
@@ -63,6 +63,10 @@ func (l *lsTool) Name() string {
 	return LSToolName
 }
 
+func (l *lsTool) ReadOnly() bool {
+	return true
+}
+
 func (l *lsTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        LSToolName,
@@ -99,43 +103,14 @@ func (l *lsTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error) {
 		return ToolResponse{}, fmt.Errorf("error expanding path: %w", err)
 	}
 
-	if !filepath.IsAbs(searchPath) {
-		searchPath = filepath.Join(l.workingDir, searchPath)
-	}
-
-	// Check if directory is outside working directory and request permission if needed
-	absWorkingDir, err := filepath.Abs(l.workingDir)
-	if err != nil {
-		return ToolResponse{}, fmt.Errorf("error resolving working directory: %w", err)
-	}
-
-	absSearchPath, err := filepath.Abs(searchPath)
+	// Resolve the path inside the workspace and request permission if it is outside
+	searchPath, outside, err := resolveWorkspacePath(l.workingDir, searchPath)
 	if err != nil {
-		return ToolResponse{}, fmt.Errorf("error resolving search path: %w", err)
+		return NewTextErrorResponse(err.Error()), nil
 	}
-
-	relPath, err := filepath.Rel(absWorkingDir, absSearchPath)
-	if err != nil || strings.HasPrefix(relPath, "..") {
-		// Directory is outside working directory, request permission
-		sessionID, messageID := GetContextValues(ctx)
-		if sessionID == "" || messageID == "" {
-			return ToolResponse{}, fmt.Errorf("session ID and message ID are required for accessing directories outside working directory")
-		}
-
-		granted := l.permissions.Request(
-			permission.CreatePermissionRequest{
-				SessionID:   sessionID,
-				Path:        absSearchPath,
-				ToolCallID:  call.ID,
-				ToolName:    LSToolName,
-				Action:      "list",
-				Description: fmt.Sprintf("List directory outside working directory: %s", absSearchPath),
-				Params:      LSPermissionsParams(params),
-			},
-		)
-
-		if !granted {
-			return ToolResponse{}, permission.ErrorPermissionDenied
+	if outside {
+		if err := requestOutsideAccess(ctx, l.permissions, call, LSToolName, "list", "List directory", searchPath, LSPermissionsParams(params)); err != nil {
+			return ToolResponse{}, err
 		}
 	}
 
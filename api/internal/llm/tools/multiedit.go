@@ -122,9 +122,16 @@ func (m *multiEditTool) Run(ctx context.Context, call ToolCall) (ToolResponse, e
 		return NewTextErrorResponse("at least one edit operation is required"), nil
 	}
 
-	if !filepath.IsAbs(params.FilePath) {
-		params.FilePath = filepath.Join(m.workingDir, params.FilePath)
+	filePath, outside, err := resolveWorkspacePath(m.workingDir, params.FilePath)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, m.permissions, call, MultiEditToolName, "write", "Edit file", filePath, MultiEditPermissionsParams{FilePath: filePath}); err != nil {
+			return ToolResponse{}, err
+		}
 	}
+	params.FilePath = filePath
 
 	// Validate all edits before applying any
 	if err := m.validateEdits(params.Edits); err != nil {
@@ -132,7 +139,6 @@ func (m *multiEditTool) Run(ctx context.Context, call ToolCall) (ToolResponse, e
 	}
 
 	var response ToolResponse
-	var err error
 
 	// Handle file creation case (first edit has empty old_string)
 	if len(params.Edits) > 0 && params.Edits[0].OldString == "" {
@@ -238,7 +244,7 @@ func (m *multiEditTool) processMultiEditWithCreation(ctx context.Context, params
 	}
 
 	// Update file history
-	_, err = m.files.Create(ctx, sessionID, params.FilePath, "")
+	_, err = m.files.CreateMissing(ctx, sessionID, params.FilePath)
 	if err != nil {
 		return ToolResponse{}, fmt.Errorf("error creating file history: %w", err)
 	}
@@ -72,6 +72,18 @@ type BaseTool interface {
 	Run(ctx context.Context, params ToolCall) (ToolResponse, error)
 }
 
+// ReadOnlyTool is implemented by tools whose calls have no side effects, so
+// the agent can run several calls of the same turn concurrently.
+type ReadOnlyTool interface {
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether tool declares itself free of side effects.
+func IsReadOnly(tool BaseTool) bool {
+	ro, ok := tool.(ReadOnlyTool)
+	return ok && ro.ReadOnly()
+}
+
 func GetContextValues(ctx context.Context) (string, string) {
 	sessionID := ctx.Value(SessionIDContextKey)
 	messageID := ctx.Value(MessageIDContextKey)
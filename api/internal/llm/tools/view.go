@@ -62,6 +62,10 @@ func (v *viewTool) Name() string {
 	return ViewToolName
 }
 
+func (v *viewTool) ReadOnly() bool {
+	return true
+}
+
 func (v *viewTool) Info() ToolInfo {
 	return ToolInfo{
 		Name:        ViewToolName,
@@ -95,45 +99,14 @@ func (v *viewTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error)
 		return NewTextErrorResponse("file_path is required"), nil
 	}
 
-	// Handle relative paths
-	filePath := params.FilePath
-	if !filepath.IsAbs(filePath) {
-		filePath = filepath.Join(v.workingDir, filePath)
-	}
-
-	// Check if file is outside working directory and request permission if needed
-	absWorkingDir, err := filepath.Abs(v.workingDir)
-	if err != nil {
-		return ToolResponse{}, fmt.Errorf("error resolving working directory: %w", err)
-	}
-
-	absFilePath, err := filepath.Abs(filePath)
+	// Resolve the path inside the workspace and request permission if it is outside
+	filePath, outside, err := resolveWorkspacePath(v.workingDir, params.FilePath)
 	if err != nil {
-		return ToolResponse{}, fmt.Errorf("error resolving file path: %w", err)
+		return NewTextErrorResponse(err.Error()), nil
 	}
-
-	relPath, err := filepath.Rel(absWorkingDir, absFilePath)
-	if err != nil || strings.HasPrefix(relPath, "..") {
-		// File is outside working directory, request permission
-		sessionID, messageID := GetContextValues(ctx)
-		if sessionID == "" || messageID == "" {
-			return ToolResponse{}, fmt.Errorf("session ID and message ID are required for accessing files outside working directory")
-		}
-
-		granted := v.permissions.Request(
-			permission.CreatePermissionRequest{
-				SessionID:   sessionID,
-				Path:        absFilePath,
-				ToolCallID:  call.ID,
-				ToolName:    ViewToolName,
-				Action:      "read",
-				Description: fmt.Sprintf("Read file outside working directory: %s", absFilePath),
-				Params:      ViewPermissionsParams(params),
-			},
-		)
-
-		if !granted {
-			return ToolResponse{}, permission.ErrorPermissionDenied
+	if outside {
+		if err := requestOutsideAccess(ctx, v.permissions, call, ViewToolName, "read", "Read file", filePath, ViewPermissionsParams(params)); err != nil {
+			return ToolResponse{}, err
 		}
 	}
 
@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/fsext"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+// resolveWorkspacePath resolves path, relative to workingDir, through the
+// workspace sandbox with the configured outside-workspace policy. It returns
+// the resolved path and whether the path is outside the workspace and needs
+// the user's permission. Denied paths return an error.
+func resolveWorkspacePath(workingDir, path string) (string, bool, error) {
+	var policy fsext.OutsidePolicy
+	if cfg := config.Get(); cfg != nil && cfg.Permissions != nil {
+		policy = cfg.Permissions.OutsideWorkspace
+	}
+	ws, err := fsext.NewWorkspace(workingDir, policy)
+	if err != nil {
+		return "", false, err
+	}
+	return ws.Check(path)
+}
+
+// requestOutsideAccess asks the user for permission to access a path outside
+// the working directory. The request is always shown to the user: the tool
+// allowlist, auto-approved sessions and skipped requests don't cover it.
+func requestOutsideAccess(ctx context.Context, permissions permission.Service, call ToolCall, toolName, action, description, path string, params any) error {
+	sessionID, messageID := GetContextValues(ctx)
+	if sessionID == "" || messageID == "" {
+		return fmt.Errorf("session ID and message ID are required for accessing paths outside working directory")
+	}
+	granted := permissions.Request(
+		permission.CreatePermissionRequest{
+			SessionID:   sessionID,
+			Path:        path,
+			ToolCallID:  call.ID,
+			ToolName:    toolName,
+			Action:      action,
+			Description: fmt.Sprintf("%s outside working directory: %s", description, path),
+			Params:      params,
+			Outside:     true,
+		},
+	)
+	if !granted {
+		return permission.ErrorPermissionDenied
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/csync"
+	"github.com/upperxcode/jx2ai-agent/api/internal/lsp"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutsideWorkspaceAlwaysAsks(t *testing.T) {
+	workingDir := t.TempDir()
+	outsidePath := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(outsidePath, []byte("secret"), 0o644))
+
+	// Neither the allowlist nor an auto-approved session covers paths outside
+	// the workspace.
+	permissions := permission.NewPermissionService(workingDir, false, []string{ViewToolName, WriteToolName})
+	permissions.AutoApproveSession("session")
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "session")
+	ctx = context.WithValue(ctx, MessageIDContextKey, "message")
+
+	// The user denies every request.
+	requests := permissions.Subscribe(ctx)
+	go func() {
+		for event := range requests {
+			permissions.Deny(event.Payload)
+		}
+	}()
+
+	run := func(tool BaseTool, params any) error {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		_, err = tool.Run(ctx, ToolCall{ID: "call", Name: tool.Name(), Input: string(input)})
+		return err
+	}
+
+	lspClients := csync.NewMap[string, *lsp.Client]()
+	view := NewViewTool(lspClients, permissions, workingDir)
+	require.ErrorIs(t, run(view, ViewParams{FilePath: outsidePath}), permission.ErrorPermissionDenied)
+
+	write := NewWriteTool(lspClients, permissions, nil, workingDir)
+	require.ErrorIs(t, run(write, WriteParams{FilePath: outsidePath, Content: "changed"}), permission.ErrorPermissionDenied)
+
+	content, err := os.ReadFile(outsidePath)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(content))
+
+	// Files inside the workspace are read without asking.
+	insidePath := filepath.Join(workingDir, "notes.txt")
+	require.NoError(t, os.WriteFile(insidePath, []byte("notes"), 0o644))
+	require.NoError(t, run(view, ViewParams{FilePath: insidePath}))
+}
@@ -93,9 +93,14 @@ func (w *writeTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 		return NewTextErrorResponse("content is required"), nil
 	}
 
-	filePath := params.FilePath
-	if !filepath.IsAbs(filePath) {
-		filePath = filepath.Join(w.workingDir, filePath)
+	filePath, outside, err := resolveWorkspacePath(w.workingDir, params.FilePath)
+	if err != nil {
+		return NewTextErrorResponse(err.Error()), nil
+	}
+	if outside {
+		if err := requestOutsideAccess(ctx, w.permissions, call, WriteToolName, "write", "Write file", filePath, WritePermissionsParams{FilePath: filePath, NewContent: params.Content}); err != nil {
+			return ToolResponse{}, err
+		}
 	}
 
 	fileInfo, err := os.Stat(filePath)
@@ -170,7 +175,11 @@ func (w *writeTool) Run(ctx context.Context, call ToolCall) (ToolResponse, error
 	// Check if file exists in history
 	file, err := w.files.GetByPathAndSession(ctx, filePath, sessionID)
 	if err != nil {
-		_, err = w.files.Create(ctx, sessionID, filePath, oldContent)
+		if fileInfo != nil {
+			_, err = w.files.Create(ctx, sessionID, filePath, oldContent)
+		} else {
+			_, err = w.files.CreateMissing(ctx, sessionID, filePath)
+		}
 		if err != nil {
 			// Log error but don't fail the operation
 			return ToolResponse{}, fmt.Errorf("error creating file history: %w", err)
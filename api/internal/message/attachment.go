@@ -1,8 +1,16 @@
 package message
 
+import "strings"
+
 type Attachment struct {
 	FilePath string
 	FileName string
 	MimeType string
 	Content  []byte
 }
+
+// IsText reports whether the attachment is a text file, which is inlined in
+// the prompt instead of being sent as binary content.
+func (a Attachment) IsText() bool {
+	return strings.HasPrefix(a.MimeType, "text/")
+}
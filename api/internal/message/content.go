@@ -3,6 +3,7 @@ package message
 import (
 	"encoding/base64"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
@@ -26,6 +27,12 @@ const (
 	FinishReasonCanceled         FinishReason = "canceled"
 	FinishReasonError            FinishReason = "error"
 	FinishReasonPermissionDenied FinishReason = "permission_denied"
+	// The agent stopped a prompt that used more turns than allowed.
+	FinishReasonMaxTurns FinishReason = "max_turns"
+	// The agent stopped a prompt whose model kept repeating the same tool call.
+	FinishReasonToolLoop FinishReason = "tool_loop"
+	// The agent stopped a prompt that went over the session or prompt budget.
+	FinishReasonBudgetExceeded FinishReason = "budget_exceeded"
 
 	// Should never happen
 	FinishReasonUnknown FinishReason = "unknown"
@@ -133,6 +140,18 @@ func (m *Message) Content() TextContent {
 	return TextContent{}
 }
 
+// PromptContent returns the text sent to the model for a user message: the
+// prompt followed by any text blocks attached to it, such as file contents.
+func (m *Message) PromptContent() string {
+	var texts []string
+	for _, part := range m.Parts {
+		if c, ok := part.(TextContent); ok {
+			texts = append(texts, c.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
 func (m *Message) ReasoningContent() ReasoningContent {
 	for _, part := range m.Parts {
 		if c, ok := part.(ReasoningContent); ok {
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/upperxcode/jx2ai-agent/api/internal/db"
@@ -28,17 +29,28 @@ type Service interface {
 	List(ctx context.Context, sessionID string) ([]Message, error)
 	Delete(ctx context.Context, id string) error
 	DeleteSessionMessages(ctx context.Context, sessionID string) error
+	// DeleteFrom removes messageID and every later message of the session and
+	// returns the removed messages.
+	DeleteFrom(ctx context.Context, sessionID, messageID string) ([]Message, error)
+	// Fork copies the messages of sessionID up to messageID into
+	// newSessionID, keeping their order and timestamps. The tool results
+	// that answer messageID are copied with it. It returns the IDs of the
+	// copied messages mapped to the IDs of the copies. The messages are
+	// copied in a single transaction.
+	Fork(ctx context.Context, sessionID, messageID, newSessionID string) (map[string]string, error)
 }
 
 type service struct {
 	*pubsub.Broker[Message]
-	q db.Querier
+	q  *db.Queries
+	db *sql.DB
 }
 
-func NewService(q db.Querier) Service {
+func NewService(q *db.Queries, db *sql.DB) Service {
 	return &service{
 		Broker: pubsub.NewBroker[Message](),
 		q:      q,
+		db:     db,
 	}
 }
 
@@ -113,6 +125,8 @@ func (s *service) Update(ctx context.Context, message Message) error {
 	err = s.q.UpdateMessage(ctx, db.UpdateMessageParams{
 		ID:         message.ID,
 		Parts:      string(parts),
+		Model:      sql.NullString{String: message.Model, Valid: true},
+		Provider:   sql.NullString{String: message.Provider, Valid: message.Provider != ""},
 		FinishedAt: finishedAt,
 	})
 	if err != nil {
@@ -123,6 +137,88 @@ func (s *service) Update(ctx context.Context, message Message) error {
 	return nil
 }
 
+func (s *service) DeleteFrom(ctx context.Context, sessionID, messageID string) ([]Message, error) {
+	messages, err := s.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	start := slices.IndexFunc(messages, func(m Message) bool { return m.ID == messageID })
+	if start < 0 {
+		return nil, fmt.Errorf("message %s not found in session %s: %w", messageID, sessionID, sql.ErrNoRows)
+	}
+	deleted := messages[start:]
+	for _, message := range deleted {
+		if err := s.q.DeleteMessage(ctx, message.ID); err != nil {
+			return nil, err
+		}
+		s.Publish(pubsub.DeletedEvent, message)
+	}
+	return deleted, nil
+}
+
+func (s *service) Fork(ctx context.Context, sessionID, messageID, newSessionID string) (map[string]string, error) {
+	messages, err := s.List(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	end := slices.IndexFunc(messages, func(m Message) bool { return m.ID == messageID })
+	if end < 0 {
+		return nil, fmt.Errorf("message %s not found in session %s: %w", messageID, sessionID, sql.ErrNoRows)
+	}
+	end++
+	for end < len(messages) && messages[end].Role == Tool {
+		end++
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.q.WithTx(tx)
+
+	ids := make(map[string]string, end)
+	var copied []Message
+	for _, message := range messages[:end] {
+		parts, err := marshallParts(message.Parts)
+		if err != nil {
+			return nil, err
+		}
+		finishedAt := sql.NullInt64{}
+		if f := message.FinishPart(); f != nil {
+			finishedAt.Int64 = f.Time
+			finishedAt.Valid = true
+		}
+		dbMessage, err := qtx.CopyMessage(ctx, db.CopyMessageParams{
+			ID:         uuid.New().String(),
+			SessionID:  newSessionID,
+			Role:       string(message.Role),
+			Parts:      string(parts),
+			Model:      sql.NullString{String: message.Model, Valid: true},
+			Provider:   sql.NullString{String: message.Provider, Valid: message.Provider != ""},
+			CreatedAt:  message.CreatedAt,
+			UpdatedAt:  message.UpdatedAt,
+			FinishedAt: finishedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		forked, err := s.fromDBItem(dbMessage)
+		if err != nil {
+			return nil, err
+		}
+		ids[message.ID] = forked.ID
+		copied = append(copied, forked)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	for _, message := range copied {
+		s.Publish(pubsub.CreatedEvent, message)
+	}
+	return ids, nil
+}
+
 func (s *service) Get(ctx context.Context, id string) (Message, error) {
 	dbMessage, err := s.q.GetMessage(ctx, id)
 	if err != nil {
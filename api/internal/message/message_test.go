@@ -0,0 +1,57 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+func TestFork(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	s := NewService(q, conn)
+
+	sess, err := sessions.Create(ctx, "original")
+	require.NoError(t, err)
+	create := func(role MessageRole, parts ...ContentPart) Message {
+		msg, err := s.Create(ctx, sess.ID, CreateMessageParams{Role: role, Parts: parts, Model: "m", Provider: "p"})
+		require.NoError(t, err)
+		return msg
+	}
+	create(User, TextContent{Text: "read the file"})
+	call := create(Assistant, ToolCall{ID: "call-1", Name: "view", Input: "{}", Finished: true})
+	create(Tool, ToolResult{ToolCallID: "call-1", Content: "contents"})
+	create(Assistant, TextContent{Text: "done"})
+
+	fork, err := sessions.Fork(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, sess.ID, fork.ForkedFromSessionID)
+	require.Empty(t, fork.ParentSessionID)
+
+	ids, err := s.Fork(ctx, sess.ID, call.ID, fork.ID)
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+
+	copied, err := s.List(ctx, fork.ID)
+	require.NoError(t, err)
+	require.Len(t, copied, 3)
+	require.Equal(t, []MessageRole{User, Assistant, Tool}, []MessageRole{copied[0].Role, copied[1].Role, copied[2].Role})
+	require.Equal(t, ids[call.ID], copied[1].ID)
+	require.Equal(t, "read the file", copied[0].Content().Text)
+	require.Equal(t, "contents", copied[2].ToolResults()[0].Content)
+	require.Equal(t, "p", copied[1].Provider)
+
+	original, err := s.List(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, original, 4)
+
+	_, err = s.Fork(ctx, sess.ID, "missing", fork.ID)
+	require.Error(t, err)
+}
@@ -23,6 +23,9 @@ type CreatePermissionRequest struct {
 	Action      string `json:"action"`
 	Params      any    `json:"params"`
 	Path        string `json:"path"`
+	// Outside marks access to a path outside the working directory, which
+	// is always asked to the user.
+	Outside bool `json:"outside,omitempty"`
 }
 
 type PermissionNotification struct {
@@ -51,6 +54,7 @@ type Service interface {
 	AutoApproveSession(sessionID string)
 	SetSkipRequests(skip bool)
 	SkipRequests() bool
+	Pending() []PermissionRequest
 	SubscribeNotifications(ctx context.Context) <-chan pubsub.Event[PermissionNotification]
 }
 
@@ -67,12 +71,18 @@ type permissionService struct {
 	skip                  bool
 	allowedTools          []string
 
-	// used to make sure we only process one request at a time
-	requestMu     sync.Mutex
+	// requests waiting for an answer, in arrival order, and the one shown
+	// to the user
+	queue         []PermissionRequest
 	activeRequest *PermissionRequest
+	queueMu       sync.RWMutex
+
+	// used to make sure we only process one request at a time
+	requestMu sync.Mutex
 }
 
 func (s *permissionService) GrantPersistent(permission PermissionRequest) {
+	s.dequeue(permission.ID)
 	s.notificationBroker.Publish(pubsub.CreatedEvent, PermissionNotification{
 		ToolCallID: permission.ToolCallID,
 		Granted:    true,
@@ -86,12 +96,11 @@ func (s *permissionService) GrantPersistent(permission PermissionRequest) {
 	s.sessionPermissions = append(s.sessionPermissions, permission)
 	s.sessionPermissionsMu.Unlock()
 
-	if s.activeRequest != nil && s.activeRequest.ID == permission.ID {
-		s.activeRequest = nil
-	}
+	s.clearActive(permission.ID)
 }
 
 func (s *permissionService) Grant(permission PermissionRequest) {
+	s.dequeue(permission.ID)
 	s.notificationBroker.Publish(pubsub.CreatedEvent, PermissionNotification{
 		ToolCallID: permission.ToolCallID,
 		Granted:    true,
@@ -101,12 +110,11 @@ func (s *permissionService) Grant(permission PermissionRequest) {
 		respCh <- true
 	}
 
-	if s.activeRequest != nil && s.activeRequest.ID == permission.ID {
-		s.activeRequest = nil
-	}
+	s.clearActive(permission.ID)
 }
 
 func (s *permissionService) Deny(permission PermissionRequest) {
+	s.dequeue(permission.ID)
 	s.notificationBroker.Publish(pubsub.CreatedEvent, PermissionNotification{
 		ToolCallID: permission.ToolCallID,
 		Granted:    false,
@@ -117,13 +125,11 @@ func (s *permissionService) Deny(permission PermissionRequest) {
 		respCh <- false
 	}
 
-	if s.activeRequest != nil && s.activeRequest.ID == permission.ID {
-		s.activeRequest = nil
-	}
+	s.clearActive(permission.ID)
 }
 
 func (s *permissionService) Request(opts CreatePermissionRequest) bool {
-	if s.skip {
+	if s.skip && !opts.Outside {
 		return true
 	}
 
@@ -131,12 +137,10 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	s.notificationBroker.Publish(pubsub.CreatedEvent, PermissionNotification{
 		ToolCallID: opts.ToolCallID,
 	})
-	s.requestMu.Lock()
-	defer s.requestMu.Unlock()
 
 	// Check if the tool/action combination is in the allowlist
 	commandKey := opts.ToolName + ":" + opts.Action
-	if slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName) {
+	if !opts.Outside && (slices.Contains(s.allowedTools, commandKey) || slices.Contains(s.allowedTools, opts.ToolName)) {
 		return true
 	}
 
@@ -144,7 +148,7 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	autoApprove := s.autoApproveSessions[opts.SessionID]
 	s.autoApproveSessionsMu.RUnlock()
 
-	if autoApprove {
+	if autoApprove && !opts.Outside {
 		return true
 	}
 
@@ -172,14 +176,24 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 		Params:      opts.Params,
 	}
 
-	s.sessionPermissionsMu.RLock()
-	for _, p := range s.sessionPermissions {
-		if p.ToolName == permission.ToolName && p.Action == permission.Action && p.SessionID == permission.SessionID && p.Path == permission.Path {
-			s.sessionPermissionsMu.RUnlock()
-			return true
-		}
+	// register the response channel before waiting for our turn so requests
+	// still in the queue can already be answered
+	respCh := make(chan bool, 1)
+	s.pendingRequests.Set(permission.ID, respCh)
+	defer s.pendingRequests.Del(permission.ID)
+
+	s.enqueue(permission)
+	defer s.dequeue(permission.ID)
+
+	s.requestMu.Lock()
+	defer s.requestMu.Unlock()
+
+	// answered while waiting in the queue
+	select {
+	case granted := <-respCh:
+		return granted
+	default:
 	}
-	s.sessionPermissionsMu.RUnlock()
 
 	s.sessionPermissionsMu.RLock()
 	for _, p := range s.sessionPermissions {
@@ -190,11 +204,9 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	}
 	s.sessionPermissionsMu.RUnlock()
 
+	s.queueMu.Lock()
 	s.activeRequest = &permission
-
-	respCh := make(chan bool, 1)
-	s.pendingRequests.Set(permission.ID, respCh)
-	defer s.pendingRequests.Del(permission.ID)
+	s.queueMu.Unlock()
 
 	// Publish the request
 	s.Publish(pubsub.CreatedEvent, permission)
@@ -202,6 +214,35 @@ func (s *permissionService) Request(opts CreatePermissionRequest) bool {
 	return <-respCh
 }
 
+func (s *permissionService) enqueue(permission PermissionRequest) {
+	s.queueMu.Lock()
+	s.queue = append(s.queue, permission)
+	s.queueMu.Unlock()
+}
+
+func (s *permissionService) dequeue(id string) {
+	s.queueMu.Lock()
+	s.queue = slices.DeleteFunc(s.queue, func(p PermissionRequest) bool {
+		return p.ID == id
+	})
+	s.queueMu.Unlock()
+}
+
+func (s *permissionService) clearActive(id string) {
+	s.queueMu.Lock()
+	if s.activeRequest != nil && s.activeRequest.ID == id {
+		s.activeRequest = nil
+	}
+	s.queueMu.Unlock()
+}
+
+// Pending returns the requests still waiting for an answer, oldest first.
+func (s *permissionService) Pending() []PermissionRequest {
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	return slices.Clone(s.queue)
+}
+
 func (s *permissionService) AutoApproveSession(sessionID string) {
 	s.autoApproveSessionsMu.Lock()
 	s.autoApproveSessions[sessionID] = true
@@ -3,6 +3,7 @@ package permission
 import (
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -245,3 +246,63 @@ func TestPermissionService_SequentialProperties(t *testing.T) {
 		assert.True(t, result, "Repeated request should be auto-approved due to persistent permission")
 	})
 }
+
+func TestPermissionService_Pending(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	events := service.Subscribe(t.Context())
+
+	req := CreatePermissionRequest{
+		SessionID:   "pending",
+		ToolName:    "tool",
+		Action:      "action",
+		Path:        "/tmp/file.txt",
+		Description: "Pending request",
+	}
+
+	var result bool
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		result = service.Request(req)
+	})
+
+	event := <-events
+	pending := service.Pending()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, event.Payload.ID, pending[0].ID)
+
+	service.Deny(event.Payload)
+	wg.Wait()
+	assert.False(t, result)
+	assert.Empty(t, service.Pending())
+}
+
+func TestPermissionService_AnswerQueued(t *testing.T) {
+	service := NewPermissionService("/tmp", false, []string{})
+	events := service.Subscribe(t.Context())
+
+	first := CreatePermissionRequest{SessionID: "queue", ToolName: "tool1", Action: "action", Path: "/tmp/a.txt"}
+	second := CreatePermissionRequest{SessionID: "queue", ToolName: "tool2", Action: "action", Path: "/tmp/b.txt"}
+
+	var result1, result2 bool
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		result1 = service.Request(first)
+	})
+	active := <-events
+
+	wg.Go(func() {
+		result2 = service.Request(second)
+	})
+	assert.Eventually(t, func() bool { return len(service.Pending()) == 2 }, time.Second, time.Millisecond)
+
+	// Answer the queued request before the active one.
+	queued := service.Pending()[1]
+	assert.Equal(t, "tool2", queued.ToolName)
+	service.Grant(queued)
+	service.Deny(active.Payload)
+
+	wg.Wait()
+	assert.False(t, result1)
+	assert.True(t, result2)
+	assert.Empty(t, service.Pending())
+}
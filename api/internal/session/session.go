@@ -21,6 +21,12 @@ type Session struct {
 	Cost             float64
 	CreatedAt        int64
 	UpdatedAt        int64
+	// AgentID is the agent that answers the prompts of the session; empty
+	// means the coder.
+	AgentID string
+	// ForkedFromSessionID is the session this one was forked from. A fork is
+	// a session of its own, not a child of the original.
+	ForkedFromSessionID string
 }
 
 type Service interface {
@@ -28,10 +34,30 @@ type Service interface {
 	Create(ctx context.Context, title string) (Session, error)
 	CreateTitleSession(ctx context.Context, parentSessionID string) (Session, error)
 	CreateTaskSession(ctx context.Context, toolCallID, parentSessionID, title string) (Session, error)
+	// Fork creates an empty top-level session, forked from sessionID, to
+	// receive a copy of its history; see message.Service.Fork and
+	// history.Service.Fork.
+	Fork(ctx context.Context, sessionID string) (Session, error)
 	Get(ctx context.Context, id string) (Session, error)
 	List(ctx context.Context) ([]Session, error)
+	ListChildren(ctx context.Context, parentSessionID string) ([]Session, error)
 	Save(ctx context.Context, session Session) (Session, error)
 	Delete(ctx context.Context, id string) error
+
+	// RecordUsage stores the usage of a model response.
+	RecordUsage(ctx context.Context, usage Usage) (Usage, error)
+	// LastUsage returns the usage of the latest response of the session
+	// itself that is still in its history; ok is false when there is none.
+	LastUsage(ctx context.Context, sessionID string) (usage Usage, ok bool, err error)
+	// Usage adds up the usage of the session and its task sessions. Forks
+	// are sessions of their own and count only their own usage.
+	Usage(ctx context.Context, sessionID string) (UsageTotals, error)
+	// ListUsage returns the usage of every response of the session and its
+	// task sessions, oldest first.
+	ListUsage(ctx context.Context, sessionID string) ([]Usage, error)
+	// UsageByModel adds up the usage of the session and its task sessions by
+	// provider and model, most expensive first.
+	UsageByModel(ctx context.Context, sessionID string) ([]ModelUsage, error)
 }
 
 type service struct {
@@ -67,6 +93,25 @@ func (s *service) CreateTaskSession(ctx context.Context, toolCallID, parentSessi
 	return session, nil
 }
 
+func (s *service) Fork(ctx context.Context, sessionID string) (Session, error) {
+	original, err := s.Get(ctx, sessionID)
+	if err != nil {
+		return Session{}, err
+	}
+	dbSession, err := s.q.CreateSession(ctx, db.CreateSessionParams{
+		ID:                  uuid.New().String(),
+		Title:               original.Title + " (fork)",
+		AgentID:             original.AgentID,
+		ForkedFromSessionID: sql.NullString{String: original.ID, Valid: true},
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	session := s.fromDBItem(dbSession)
+	s.Publish(pubsub.CreatedEvent, session)
+	return session, nil
+}
+
 func (s *service) CreateTitleSession(ctx context.Context, parentSessionID string) (Session, error) {
 	dbSession, err := s.q.CreateSession(ctx, db.CreateSessionParams{
 		ID:              "title-" + parentSessionID,
@@ -113,7 +158,8 @@ func (s *service) Save(ctx context.Context, session Session) (Session, error) {
 			String: session.SummaryMessageID,
 			Valid:  session.SummaryMessageID != "",
 		},
-		Cost: session.Cost,
+		AgentID: session.AgentID,
+		Cost:    session.Cost,
 	})
 	if err != nil {
 		return Session{}, err
@@ -135,18 +181,32 @@ func (s *service) List(ctx context.Context) ([]Session, error) {
 	return sessions, nil
 }
 
+func (s *service) ListChildren(ctx context.Context, parentSessionID string) ([]Session, error) {
+	dbSessions, err := s.q.ListChildSessions(ctx, sql.NullString{String: parentSessionID, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]Session, len(dbSessions))
+	for i, dbSession := range dbSessions {
+		sessions[i] = s.fromDBItem(dbSession)
+	}
+	return sessions, nil
+}
+
 func (s service) fromDBItem(item db.Session) Session {
 	return Session{
-		ID:               item.ID,
-		ParentSessionID:  item.ParentSessionID.String,
-		Title:            item.Title,
-		MessageCount:     item.MessageCount,
-		PromptTokens:     item.PromptTokens,
-		CompletionTokens: item.CompletionTokens,
-		SummaryMessageID: item.SummaryMessageID.String,
-		Cost:             item.Cost,
-		CreatedAt:        item.CreatedAt,
-		UpdatedAt:        item.UpdatedAt,
+		ID:                  item.ID,
+		ParentSessionID:     item.ParentSessionID.String,
+		Title:               item.Title,
+		MessageCount:        item.MessageCount,
+		PromptTokens:        item.PromptTokens,
+		CompletionTokens:    item.CompletionTokens,
+		SummaryMessageID:    item.SummaryMessageID.String,
+		AgentID:             item.AgentID,
+		ForkedFromSessionID: item.ForkedFromSessionID.String,
+		Cost:                item.Cost,
+		CreatedAt:           item.CreatedAt,
+		UpdatedAt:           item.UpdatedAt,
 	}
 }
 
@@ -0,0 +1,154 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+)
+
+// Usage is the token usage and cost of one model response, the assistant
+// message identified by MessageID.
+type Usage struct {
+	ID                  string
+	SessionID           string
+	MessageID           string
+	Provider            string
+	Model               string
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+	Cost                float64
+	CreatedAt           int64
+}
+
+// PromptTokens is the number of tokens sent to the model, cached or not.
+func (u Usage) PromptTokens() int64 {
+	return u.InputTokens + u.CacheCreationTokens + u.CacheReadTokens
+}
+
+// Tokens is the total number of tokens of the response.
+func (u Usage) Tokens() int64 {
+	return u.PromptTokens() + u.OutputTokens
+}
+
+// UsageTotals adds up the usage of several responses.
+type UsageTotals struct {
+	Turns               int64
+	InputTokens         int64
+	OutputTokens        int64
+	CacheCreationTokens int64
+	CacheReadTokens     int64
+	Cost                float64
+}
+
+// Tokens is the total number of tokens.
+func (t UsageTotals) Tokens() int64 {
+	return t.InputTokens + t.CacheCreationTokens + t.CacheReadTokens + t.OutputTokens
+}
+
+// ModelUsage is the usage of a session with one model.
+type ModelUsage struct {
+	Provider string
+	Model    string
+	UsageTotals
+}
+
+func (s *service) RecordUsage(ctx context.Context, usage Usage) (Usage, error) {
+	dbUsage, err := s.q.CreateUsage(ctx, db.CreateUsageParams{
+		ID:                  uuid.New().String(),
+		SessionID:           usage.SessionID,
+		MessageID:           usage.MessageID,
+		Provider:            usage.Provider,
+		Model:               usage.Model,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheCreationTokens: usage.CacheCreationTokens,
+		CacheReadTokens:     usage.CacheReadTokens,
+		Cost:                usage.Cost,
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	return fromDBUsage(dbUsage), nil
+}
+
+func (s *service) LastUsage(ctx context.Context, sessionID string) (Usage, bool, error) {
+	dbUsage, err := s.q.GetLastUsage(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Usage{}, false, nil
+	}
+	if err != nil {
+		return Usage{}, false, err
+	}
+	return fromDBUsage(dbUsage), true, nil
+}
+
+func (s *service) Usage(ctx context.Context, sessionID string) (UsageTotals, error) {
+	row, err := s.q.GetSessionUsage(ctx, sessionID)
+	if err != nil {
+		return UsageTotals{}, err
+	}
+	return UsageTotals{
+		Turns:               row.Turns,
+		InputTokens:         row.InputTokens,
+		OutputTokens:        row.OutputTokens,
+		CacheCreationTokens: row.CacheCreationTokens,
+		CacheReadTokens:     row.CacheReadTokens,
+		Cost:                row.Cost,
+	}, nil
+}
+
+func (s *service) ListUsage(ctx context.Context, sessionID string) ([]Usage, error) {
+	dbUsage, err := s.q.ListUsageBySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]Usage, len(dbUsage))
+	for i, item := range dbUsage {
+		usage[i] = fromDBUsage(item)
+	}
+	return usage, nil
+}
+
+func (s *service) UsageByModel(ctx context.Context, sessionID string) ([]ModelUsage, error) {
+	rows, err := s.q.ListUsageByModel(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]ModelUsage, len(rows))
+	for i, row := range rows {
+		usage[i] = ModelUsage{
+			Provider: row.Provider,
+			Model:    row.Model,
+			UsageTotals: UsageTotals{
+				Turns:               row.Turns,
+				InputTokens:         row.InputTokens,
+				OutputTokens:        row.OutputTokens,
+				CacheCreationTokens: row.CacheCreationTokens,
+				CacheReadTokens:     row.CacheReadTokens,
+				Cost:                row.Cost,
+			},
+		}
+	}
+	return usage, nil
+}
+
+func fromDBUsage(item db.Usage) Usage {
+	return Usage{
+		ID:                  item.ID,
+		SessionID:           item.SessionID,
+		MessageID:           item.MessageID,
+		Provider:            item.Provider,
+		Model:               item.Model,
+		InputTokens:         item.InputTokens,
+		OutputTokens:        item.OutputTokens,
+		CacheCreationTokens: item.CacheCreationTokens,
+		CacheReadTokens:     item.CacheReadTokens,
+		Cost:                item.Cost,
+		CreatedAt:           item.CreatedAt,
+	}
+}
@@ -0,0 +1,109 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+)
+
+func TestUsage(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	s := NewService(q)
+
+	parent, err := s.Create(ctx, "parent")
+	require.NoError(t, err)
+	child, err := s.CreateTaskSession(ctx, "call-1", parent.ID, "child")
+	require.NoError(t, err)
+
+	_, ok, err := s.LastUsage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	record := func(sessionID, messageID, model string, in, out, cacheWrite, cacheRead int64, cost float64) {
+		_, err := q.CreateMessage(ctx, db.CreateMessageParams{ID: messageID, SessionID: sessionID, Role: "assistant", Parts: "[]"})
+		require.NoError(t, err)
+		_, err = s.RecordUsage(ctx, Usage{
+			SessionID:           sessionID,
+			MessageID:           messageID,
+			Provider:            "p",
+			Model:               model,
+			InputTokens:         in,
+			OutputTokens:        out,
+			CacheCreationTokens: cacheWrite,
+			CacheReadTokens:     cacheRead,
+			Cost:                cost,
+		})
+		require.NoError(t, err)
+	}
+	record(parent.ID, "m1", "big", 100, 10, 50, 0, 1)
+	record(child.ID, "m2", "small", 20, 5, 0, 0, 0.25)
+	record(parent.ID, "m3", "big", 10, 20, 0, 150, 2)
+	// A fork pays for its own turns; they are not the parent's.
+	fork, err := s.Fork(ctx, parent.ID)
+	require.NoError(t, err)
+	record(fork.ID, "m4", "big", 1000, 100, 0, 0, 10)
+
+	last, ok, err := s.LastUsage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "m3", last.MessageID)
+	require.Equal(t, int64(160), last.PromptTokens())
+	require.Equal(t, int64(180), last.Tokens())
+
+	turns, err := s.ListUsage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.Len(t, turns, 3)
+	require.Equal(t, []string{"m1", "m2", "m3"}, []string{turns[0].MessageID, turns[1].MessageID, turns[2].MessageID})
+	require.Equal(t, child.ID, turns[1].SessionID)
+
+	totals, err := s.Usage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.Equal(t, UsageTotals{
+		Turns:               3,
+		InputTokens:         130,
+		OutputTokens:        35,
+		CacheCreationTokens: 50,
+		CacheReadTokens:     150,
+		Cost:                3.25,
+	}, totals)
+	require.Equal(t, int64(365), totals.Tokens())
+
+	byModel, err := s.UsageByModel(ctx, parent.ID)
+	require.NoError(t, err)
+	require.Len(t, byModel, 2)
+	require.Equal(t, "big", byModel[0].Model)
+	require.Equal(t, int64(2), byModel[0].Turns)
+	require.Equal(t, 3.0, byModel[0].Cost)
+	require.Equal(t, "small", byModel[1].Model)
+
+	forkTotals, err := s.Usage(ctx, fork.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), forkTotals.Turns)
+	require.Equal(t, 10.0, forkTotals.Cost)
+
+	childTotals, err := s.Usage(ctx, child.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), childTotals.Turns)
+
+	// An edit that deletes the latest response takes its context size with
+	// it, while the session still paid for it.
+	require.NoError(t, q.DeleteMessage(ctx, "m3"))
+	last, ok, err = s.LastUsage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "m1", last.MessageID)
+	totals, err = s.Usage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), totals.Turns)
+
+	require.NoError(t, s.Delete(ctx, parent.ID))
+	_, ok, err = s.LastUsage(ctx, parent.ID)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+)
+
+// reasoningEfforts são os valores aceitos em ModelOptions.ReasoningEffort.
+var reasoningEfforts = []string{"low", "medium", "high"}
+
+// ModelInfo descreve um modelo de um provedor para o seletor de modelos.
+type ModelInfo struct {
+	ID                     string  `json:"id"`
+	Name                   string  `json:"name"`
+	ContextWindow          int64   `json:"contextWindow"`
+	DefaultMaxTokens       int64   `json:"defaultMaxTokens"`
+	CostPer1MIn            float64 `json:"costPer1mIn"`
+	CostPer1MOut           float64 `json:"costPer1mOut"`
+	CostPer1MInCached      float64 `json:"costPer1mInCached"`
+	CostPer1MOutCached     float64 `json:"costPer1mOutCached"`
+	CanReason              bool    `json:"canReason"`
+	HasReasoningEffort     bool    `json:"hasReasoningEffort"`
+	DefaultReasoningEffort string  `json:"defaultReasoningEffort"`
+	SupportsImages         bool    `json:"supportsImages"`
+}
+
+// ProviderInfo descreve um provedor habilitado e seus modelos.
+type ProviderInfo struct {
+	ID     string      `json:"id"`
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Models []ModelInfo `json:"models"`
+}
+
+// ModelOptions são as opções por modelo editáveis no seletor.
+type ModelOptions struct {
+	ReasoningEffort string `json:"reasoningEffort"` // low, medium ou high; apenas modelos com HasReasoningEffort.
+	Think           bool   `json:"think"`           // Apenas modelos com CanReason.
+	MaxTokens       int64  `json:"maxTokens"`       // 0 usa DefaultMaxTokens do modelo.
+}
+
+// SelectedModelInfo é o modelo escolhido para um tipo (large ou small).
+type SelectedModelInfo struct {
+	Type     string       `json:"type"`
+	Provider string       `json:"provider"`
+	Model    ModelInfo    `json:"model"`
+	Options  ModelOptions `json:"options"`
+}
+
+func newModelInfo(m catwalk.Model) ModelInfo {
+	return ModelInfo{
+		ID:                     m.ID,
+		Name:                   m.Name,
+		ContextWindow:          m.ContextWindow,
+		DefaultMaxTokens:       m.DefaultMaxTokens,
+		CostPer1MIn:            m.CostPer1MIn,
+		CostPer1MOut:           m.CostPer1MOut,
+		CostPer1MInCached:      m.CostPer1MInCached,
+		CostPer1MOutCached:     m.CostPer1MOutCached,
+		CanReason:              m.CanReason,
+		HasReasoningEffort:     m.HasReasoningEffort,
+		DefaultReasoningEffort: m.DefaultReasoningEffort,
+		SupportsImages:         m.SupportsImages,
+	}
+}
+
+// parseModelType valida o tipo de modelo recebido do frontend.
+func parseModelType(modelType string) (config.SelectedModelType, error) {
+	switch t := config.SelectedModelType(modelType); t {
+	case config.SelectedModelTypeLarge, config.SelectedModelTypeSmall:
+		return t, nil
+	default:
+		return "", fmt.Errorf("tipo de modelo inválido %q: use large ou small", modelType)
+	}
+}
+
+// ListProviders retorna os provedores habilitados, ordenados pelo nome, com seus modelos.
+func (a *App) ListProviders() []ProviderInfo {
+	providers := a.config.EnabledProviders()
+	infos := make([]ProviderInfo, 0, len(providers))
+	for _, p := range providers {
+		info := ProviderInfo{
+			ID:     p.ID,
+			Name:   p.Name,
+			Type:   string(p.Type),
+			Models: make([]ModelInfo, 0, len(p.Models)),
+		}
+		if info.Name == "" {
+			info.Name = p.ID
+		}
+		for _, m := range p.Models {
+			info.Models = append(info.Models, newModelInfo(m))
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(x, y ProviderInfo) int {
+		return strings.Compare(strings.ToLower(x.Name), strings.ToLower(y.Name))
+	})
+	return infos
+}
+
+// SelectedModels retorna os modelos large e small em uso.
+func (a *App) SelectedModels() []SelectedModelInfo {
+	var selected []SelectedModelInfo
+	for _, t := range []config.SelectedModelType{config.SelectedModelTypeLarge, config.SelectedModelTypeSmall} {
+		sm, ok := a.config.Models[t]
+		if !ok {
+			continue
+		}
+		info := SelectedModelInfo{
+			Type:     string(t),
+			Provider: sm.Provider,
+			Model:    ModelInfo{ID: sm.Model},
+			Options: ModelOptions{
+				ReasoningEffort: sm.ReasoningEffort,
+				Think:           sm.Think,
+				MaxTokens:       sm.MaxTokens,
+			},
+		}
+		if m := a.config.GetModel(sm.Provider, sm.Model); m != nil {
+			info.Model = newModelInfo(*m)
+		}
+		selected = append(selected, info)
+	}
+	return selected
+}
+
+// SelectModel troca o modelo large ou small e recarrega os provedores do agente
+// sem reiniciar a aplicação. As opções voltam ao padrão do novo modelo.
+func (a *App) SelectModel(modelType, providerID, modelID string) error {
+	t, err := parseModelType(modelType)
+	if err != nil {
+		return err
+	}
+	m := a.config.GetModel(providerID, modelID)
+	if m == nil {
+		return fmt.Errorf("modelo %s não encontrado no provedor %s", modelID, providerID)
+	}
+	if p, ok := a.config.Providers.Get(providerID); !ok || p.Disable {
+		return fmt.Errorf("provedor %s não está habilitado", providerID)
+	}
+	selected := config.SelectedModel{
+		Provider: providerID,
+		Model:    modelID,
+	}
+	if m.HasReasoningEffort {
+		selected.ReasoningEffort = m.DefaultReasoningEffort
+	}
+	return a.updateSelectedModel(t, selected)
+}
+
+// UpdateModelOptions altera as opções do modelo large ou small em uso.
+// As opções valem a partir da próxima requisição ao provedor.
+func (a *App) UpdateModelOptions(modelType string, opts ModelOptions) error {
+	t, err := parseModelType(modelType)
+	if err != nil {
+		return err
+	}
+	selected, ok := a.config.Models[t]
+	if !ok {
+		return fmt.Errorf("nenhum modelo %s selecionado", t)
+	}
+	m := a.config.GetModel(selected.Provider, selected.Model)
+	if m == nil {
+		return fmt.Errorf("modelo %s não encontrado no provedor %s", selected.Model, selected.Provider)
+	}
+
+	if opts.ReasoningEffort != "" {
+		if !m.HasReasoningEffort {
+			return fmt.Errorf("o modelo %s não suporta esforço de raciocínio", m.ID)
+		}
+		if !slices.Contains(reasoningEfforts, opts.ReasoningEffort) {
+			return fmt.Errorf("esforço de raciocínio inválido %q: use %s", opts.ReasoningEffort, strings.Join(reasoningEfforts, ", "))
+		}
+	}
+	if opts.Think && !m.CanReason {
+		return fmt.Errorf("o modelo %s não suporta raciocínio", m.ID)
+	}
+	if opts.MaxTokens < 0 || (m.ContextWindow > 0 && opts.MaxTokens > m.ContextWindow) {
+		return fmt.Errorf("max tokens deve estar entre 0 e %d", m.ContextWindow)
+	}
+
+	selected.ReasoningEffort = opts.ReasoningEffort
+	selected.Think = opts.Think
+	selected.MaxTokens = opts.MaxTokens
+	return a.updateSelectedModel(t, selected)
+}
+
+// updateSelectedModel grava a escolha na configuração e atualiza os agentes.
+// Se um agente não aceitar o novo modelo a escolha anterior é restaurada, na
+// configuração e nos agentes que já tinham sido atualizados.
+func (a *App) updateSelectedModel(t config.SelectedModelType, selected config.SelectedModel) error {
+	agents := a.allAgents()
+	if slices.ContainsFunc(agents, agent.Service.IsBusy) {
+		return fmt.Errorf("o agente está ocupado; aguarde o fim da requisição atual")
+	}
+	previous, hadPrevious := a.config.Models[t]
+	if selected.Fallbacks == nil {
+		// Trocar de modelo mantém os modelos reserva configurados.
+		selected.Fallbacks = previous.Fallbacks
+	}
+	if err := a.config.UpdatePreferredModel(t, selected); err != nil {
+		return fmt.Errorf("erro ao salvar o modelo: %w", err)
+	}
+	for i, ag := range agents {
+		if err := ag.UpdateModel(); err != nil {
+			if hadPrevious {
+				if rerr := a.config.UpdatePreferredModel(t, previous); rerr != nil {
+					return fmt.Errorf("erro ao atualizar o agente: %w (e ao restaurar o modelo anterior: %v)", err, rerr)
+				}
+				// Os agentes já atualizados voltam ao modelo anterior.
+				for _, updated := range agents[:i] {
+					if rerr := updated.UpdateModel(); rerr != nil {
+						return fmt.Errorf("erro ao atualizar o agente: %w (e ao restaurar o modelo anterior: %v)", err, rerr)
+					}
+				}
+			}
+			return fmt.Errorf("erro ao atualizar o agente: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+)
+
+// modelAgent records the large model of the config each time it is updated.
+type modelAgent struct {
+	agent.Service
+	config *config.Config
+	reject string
+	models []string
+}
+
+func (m *modelAgent) IsBusy() bool { return false }
+
+func (m *modelAgent) UpdateModel() error {
+	model := m.config.Models[config.SelectedModelTypeLarge].Model
+	if model == m.reject {
+		return errors.New("unsupported model")
+	}
+	m.models = append(m.models, model)
+	return nil
+}
+
+func TestUpdateSelectedModelRestoresAgents(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("CRUSH_DISABLE_PROVIDER_AUTO_UPDATE", "1")
+	cfg, err := config.Load(t.TempDir(), t.TempDir(), false)
+	require.NoError(t, err)
+	cfg.Models[config.SelectedModelTypeLarge] = config.SelectedModel{Provider: "p", Model: "old"}
+	cfg.Agents["reviewer"] = config.Agent{ID: "reviewer"}
+
+	a := newTestApp(t)
+	a.config = cfg
+	coder := &modelAgent{config: cfg}
+	reviewer := &modelAgent{config: cfg, reject: "new"}
+	a.coderAgent = coder
+	a.agents = map[string]agent.Service{"reviewer": reviewer}
+
+	err = a.updateSelectedModel(config.SelectedModelTypeLarge, config.SelectedModel{Provider: "p", Model: "new"})
+	require.ErrorContains(t, err, "unsupported model")
+	require.Equal(t, "old", cfg.Models[config.SelectedModelTypeLarge].Model)
+	// The coder took the new model first and went back to the old one.
+	require.Equal(t, []string{"new", "old"}, coder.models)
+	require.Empty(t, reviewer.models)
+}
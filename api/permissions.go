@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+// ErrPermissionNotFound é retornado ao responder um pedido que não está mais na fila.
+var ErrPermissionNotFound = errors.New("pedido de permissão não encontrado")
+
+// PermissionInfo representa um pedido de permissão de uma ferramenta para o frontend.
+// Params carrega o payload específico da ferramenta (por exemplo, o diff montado
+// pelas ferramentas edit e write ou o comando da bash).
+type PermissionInfo struct {
+	ID          string `json:"id"`
+	SessionID   string `json:"sessionId"`
+	ToolCallID  string `json:"toolCallId"`
+	ToolName    string `json:"toolName"`
+	Description string `json:"description"`
+	Action      string `json:"action"`
+	Params      any    `json:"params"`
+	Path        string `json:"path"`
+}
+
+// PermissionNotification é o payload do evento EventPermissionNotification.
+// Granted e Denied falsos indicam que a ferramenta está aguardando uma resposta.
+type PermissionNotification struct {
+	ToolCallID string `json:"toolCallId"`
+	Granted    bool   `json:"granted"`
+	Denied     bool   `json:"denied"`
+}
+
+func newPermissionInfo(p permission.PermissionRequest) PermissionInfo {
+	return PermissionInfo{
+		ID:          p.ID,
+		SessionID:   p.SessionID,
+		ToolCallID:  p.ToolCallID,
+		ToolName:    p.ToolName,
+		Description: p.Description,
+		Action:      p.Action,
+		Params:      p.Params,
+		Path:        p.Path,
+	}
+}
+
+// PendingPermissions retorna a fila de pedidos de permissão aguardando resposta,
+// do mais antigo para o mais recente.
+func (a *App) PendingPermissions() []PermissionInfo {
+	pending := a.permissions.Pending()
+	infos := make([]PermissionInfo, 0, len(pending))
+	for _, p := range pending {
+		infos = append(infos, newPermissionInfo(p))
+	}
+	return infos
+}
+
+// GrantPermission autoriza apenas esta execução da ferramenta.
+func (a *App) GrantPermission(id string) error {
+	p, err := a.pendingPermission(id)
+	if err != nil {
+		return err
+	}
+	a.permissions.Grant(p)
+	return nil
+}
+
+// GrantPermissionForSession autoriza a ferramenta para a mesma ação e caminho
+// até o fim da sessão.
+func (a *App) GrantPermissionForSession(id string) error {
+	p, err := a.pendingPermission(id)
+	if err != nil {
+		return err
+	}
+	a.permissions.GrantPersistent(p)
+	return nil
+}
+
+// DenyPermission nega o pedido; a ferramenta retorna erro de permissão ao agente.
+func (a *App) DenyPermission(id string) error {
+	p, err := a.pendingPermission(id)
+	if err != nil {
+		return err
+	}
+	a.permissions.Deny(p)
+	return nil
+}
+
+func (a *App) pendingPermission(id string) (permission.PermissionRequest, error) {
+	for _, p := range a.permissions.Pending() {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return permission.PermissionRequest{}, fmt.Errorf("%w: %s", ErrPermissionNotFound, id)
+}
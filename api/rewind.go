@@ -0,0 +1,153 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// RevertResult lista os arquivos afetados ao desfazer as mudanças de
+// mensagens descartadas. Só as mudanças feitas pelas ferramentas de edição
+// são conhecidas; comandos do bash não são desfeitos.
+type RevertResult struct {
+	Reverted  []string `json:"reverted"`  // Arquivos que voltaram ao conteúdo anterior.
+	Conflicts []string `json:"conflicts"` // Arquivos alterados desde a última versão registrada; ficam como estão.
+}
+
+// EditMessage substitui o texto de uma mensagem anterior do usuário, mantendo
+// os anexos, e executa o agente novamente a partir dela. A mensagem e as
+// seguintes são descartadas e as mudanças que elas fizeram nos arquivos são
+// desfeitas, exceto nos arquivos alterados desde então (veja RevertResult).
+func (a *App) EditMessage(sessionID, messageID, text string) (RevertResult, error) {
+	if a.coderAgent == nil {
+		return RevertResult{}, fmt.Errorf("agente não configurado")
+	}
+	if strings.TrimSpace(text) == "" {
+		return RevertResult{}, fmt.Errorf("o prompt não pode ser vazio")
+	}
+	if a.IsSessionBusy(sessionID) {
+		return RevertResult{}, fmt.Errorf("a sessão %s está ocupada; cancele a requisição antes de editar", sessionID)
+	}
+	ag, err := a.sessionAgent(sessionID)
+	if err != nil {
+		return RevertResult{}, err
+	}
+	msg, err := a.messages.Get(a.ctx, messageID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return RevertResult{}, fmt.Errorf("erro ao carregar a mensagem %s: %w", messageID, err)
+	}
+	if err != nil || msg.SessionID != sessionID {
+		return RevertResult{}, fmt.Errorf("mensagem %s não encontrada na sessão %s: %w", messageID, sessionID, sql.ErrNoRows)
+	}
+	if msg.Role != message.User {
+		return RevertResult{}, fmt.Errorf("só mensagens do usuário podem ser editadas")
+	}
+
+	// Os arquivos só são desfeitos depois que o agente aceita a edição e
+	// descarta as mensagens, e antes que ele execute o prompt de novo.
+	var result RevertResult
+	undo := func(msgs []message.Message) (err error) {
+		discarded := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			discarded = append(discarded, msg.ID)
+		}
+		result, err = a.revertMessages(sessionID, discarded)
+		return err
+	}
+	if _, err := ag.Edit(a.ctx, sessionID, messageID, text, undo); err != nil {
+		return result, fmt.Errorf("erro ao reenviar a mensagem: %w", err)
+	}
+	a.currentSession = sessionID
+	return result, nil
+}
+
+// revertMessages desfaz as mudanças que as mensagens fizeram nos arquivos e
+// remove as versões que elas registraram.
+func (a *App) revertMessages(sessionID string, messageIDs []string) (RevertResult, error) {
+	files, err := a.files.ListBySession(a.ctx, sessionID)
+	if err != nil {
+		return RevertResult{}, fmt.Errorf("erro ao carregar o histórico de arquivos da sessão %s: %w", sessionID, err)
+	}
+	ids := make(map[string]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		ids[id] = true
+	}
+	result, err := revertFiles(history.PlanRevert(files, ids), false)
+	if err != nil {
+		return result, err
+	}
+	// As versões gravadas ao restaurar checkpoints das mensagens vão junto.
+	discarded := slices.Clone(messageIDs)
+	for _, id := range messageIDs {
+		discarded = append(discarded, history.RestoreMessageID(id))
+	}
+	if err := a.files.DeleteMessageFiles(a.ctx, sessionID, discarded); err != nil {
+		return result, fmt.Errorf("erro ao remover o histórico de arquivos descartado: %w", err)
+	}
+	return result, nil
+}
+
+// revertFiles devolve os arquivos ao conteúdo anterior. Um arquivo que não tem
+// mais o conteúdo deixado pelas mensagens é um conflito e só é alterado com
+// overwrite.
+func revertFiles(reverts []history.Revert, overwrite bool) (RevertResult, error) {
+	result := RevertResult{Reverted: []string{}, Conflicts: []string{}}
+	for _, r := range reverts {
+		current, exists, err := readCurrent(r.Path)
+		if err != nil {
+			return result, err
+		}
+		if !exists && r.Created {
+			// Já removido; não há o que desfazer.
+			continue
+		}
+		if current != r.After {
+			result.Conflicts = append(result.Conflicts, r.Path)
+			if !overwrite {
+				continue
+			}
+		}
+		if err := revertFile(r); err != nil {
+			return result, err
+		}
+		result.Reverted = append(result.Reverted, r.Path)
+	}
+	return result, nil
+}
+
+// readCurrent lê o conteúdo atual de um arquivo; um arquivo inexistente tem
+// conteúdo vazio.
+func readCurrent(path string) (string, bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("erro ao ler o arquivo '%s': %w", path, err)
+	}
+	return string(content), true, nil
+}
+
+func revertFile(r history.Revert) error {
+	if r.Created {
+		if err := os.Remove(r.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("erro ao remover o arquivo '%s': %w", r.Path, err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return fmt.Errorf("erro ao criar o diretório de '%s': %w", r.Path, err)
+	}
+	if err := os.WriteFile(r.Path, []byte(r.Before), 0o644); err != nil {
+		return fmt.Errorf("erro ao restaurar o arquivo '%s': %w", r.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/llm/agent"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+)
+
+// editAgent discards the messages like the agent does, without running the
+// prompt again.
+type editAgent struct {
+	agent.Service
+	messages message.Service
+	err      error
+}
+
+func (e *editAgent) IsSessionBusy(string) bool { return false }
+
+func (e *editAgent) Edit(ctx context.Context, sessionID, messageID, content string, undo func([]message.Message) error) (<-chan agent.AgentEvent, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	deleted, err := e.messages.DeleteFrom(ctx, sessionID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return nil, undo(deleted)
+}
+
+func TestEditMessage(t *testing.T) {
+	t.Parallel()
+	a := newTestApp(t)
+	ctx := t.Context()
+	messages := a.messages
+	ag := &editAgent{messages: messages}
+	a.coderAgent = ag
+
+	sess, err := a.sessions.Create(ctx, "session")
+	require.NoError(t, err)
+	prompt, err := messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "change a.go"}},
+	})
+	require.NoError(t, err)
+	answer, err := messages.Create(ctx, sess.ID, message.CreateMessageParams{Role: message.Assistant})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "a.go")
+	turnCtx := history.WithMessageID(ctx, answer.ID)
+	_, err = a.files.Create(turnCtx, sess.ID, path, "before")
+	require.NoError(t, err)
+	_, err = a.files.CreateVersion(turnCtx, sess.ID, path, "after")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("after"), 0o644))
+	content := func() string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// An edit the agent refuses leaves the files and messages alone.
+	ag.err = errors.New("refused")
+	_, err = a.EditMessage(sess.ID, prompt.ID, "change b.go")
+	require.ErrorContains(t, err, "refused")
+	require.Equal(t, "after", content())
+	msgs, err := messages.List(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	_, err = a.EditMessage(sess.ID, answer.ID, "change b.go")
+	require.ErrorContains(t, err, "só mensagens do usuário")
+
+	ag.err = nil
+	result, err := a.EditMessage(sess.ID, prompt.ID, "change b.go")
+	require.NoError(t, err)
+	require.Equal(t, []string{path}, result.Reverted)
+	require.Empty(t, result.Conflicts)
+	require.Equal(t, "before", content())
+	files, err := a.files.ListBySession(ctx, sess.ID)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
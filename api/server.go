@@ -0,0 +1,491 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// serverKeepAlive é o intervalo dos comentários enviados para manter o stream SSE aberto.
+	serverKeepAlive = 30 * time.Second
+	// serverEventBuffer é quantos eventos cada cliente SSE pode acumular antes de bloquear.
+	serverEventBuffer = 64
+)
+
+// Server expõe o agente, as sessões e as permissões por HTTP para plugins de
+// editores, sem a janela do Wails. Toda requisição precisa do token em
+// "Authorization: Bearer <token>" ou, para o EventSource que não envia
+// cabeçalhos, no parâmetro ?token=.
+//
+//	GET    /agents                   agentes que podem responder às sessões
+//	GET    /sessions                 lista as sessões (ListSessions)
+//	POST   /sessions                 cria uma sessão: {"title"}
+//	GET    /sessions/{id}            sessão e mensagens
+//	PATCH  /sessions/{id}            renomeia: {"title"}
+//	DELETE /sessions/{id}            remove a sessão e as filhas
+//	PUT    /sessions/{id}/agent      escolhe o agente da sessão: {"agent"}; vazio é o coder
+//	GET    /sessions/{id}/usage      tokens e custo: totais, por resposta e por modelo
+//	POST   /sessions/{id}/fork       copia até uma mensagem para uma nova sessão principal,
+//	                                 ligada à original por forkedFrom: {"messageId"}
+//	PUT    /sessions/{id}/messages/{messageId}
+//	                                 edita e reenvia uma mensagem do usuário: {"prompt"}
+//	GET    /sessions/{id}/checkpoints
+//	                                 checkpoints da sessão, um por resposta do agente
+//	GET    /sessions/{id}/checkpoints/{messageId}
+//	                                 prévia das mudanças ao restaurar o checkpoint
+//	POST   /sessions/{id}/checkpoints/{messageId}/restore
+//	                                 restaura os arquivos: {"overwrite"} sobrescreve os conflitos
+//	POST   /sessions/{id}/prompt     envia um prompt: {"prompt"}; id "new" cria a sessão
+//	POST   /sessions/{id}/cancel     cancela a requisição em andamento
+//	GET    /permissions              pedidos aguardando resposta
+//	POST   /permissions/{id}         responde: {"action": "grant" | "grant_session" | "deny"}
+//	GET    /events                   stream SSE com os mesmos eventos do frontend
+type Server struct {
+	app   *App
+	token string
+	mux   *http.ServeMux
+}
+
+// NewServer cria o servidor da App. Um token vazio é gerado aleatoriamente; veja Token.
+func (a *App) NewServer(token string) (*Server, error) {
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("erro ao gerar o token do servidor: %w", err)
+		}
+		token = hex.EncodeToString(buf)
+	}
+	s := &Server{app: a, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /agents", s.handleListAgents)
+	s.mux.HandleFunc("GET /sessions", s.handleListSessions)
+	s.mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	s.mux.HandleFunc("GET /sessions/{id}", s.handleGetSession)
+	s.mux.HandleFunc("PATCH /sessions/{id}", s.handleRenameSession)
+	s.mux.HandleFunc("DELETE /sessions/{id}", s.handleDeleteSession)
+	s.mux.HandleFunc("PUT /sessions/{id}/agent", s.handleSetSessionAgent)
+	s.mux.HandleFunc("GET /sessions/{id}/usage", s.handleSessionUsage)
+	s.mux.HandleFunc("POST /sessions/{id}/fork", s.handleForkSession)
+	s.mux.HandleFunc("PUT /sessions/{id}/messages/{messageId}", s.handleEditMessage)
+	s.mux.HandleFunc("GET /sessions/{id}/checkpoints", s.handleListCheckpoints)
+	s.mux.HandleFunc("GET /sessions/{id}/checkpoints/{messageId}", s.handlePreviewCheckpoint)
+	s.mux.HandleFunc("POST /sessions/{id}/checkpoints/{messageId}/restore", s.handleRestoreCheckpoint)
+	s.mux.HandleFunc("POST /sessions/{id}/prompt", s.handlePrompt)
+	s.mux.HandleFunc("POST /sessions/{id}/cancel", s.handleCancel)
+	s.mux.HandleFunc("GET /permissions", s.handlePendingPermissions)
+	s.mux.HandleFunc("POST /permissions/{id}", s.handleAnswerPermission)
+	s.mux.HandleFunc("GET /events", s.handleEvents)
+	return s, nil
+}
+
+// Token retorna o token exigido pelas requisições.
+func (s *Server) Token() string {
+	return s.token
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("token inválido"))
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized compara o token em tempo constante. O token protege o servidor de
+// páginas web abertas no navegador, que também alcançam endereços locais.
+func (s *Server) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = auth
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// Listen abre o socket do servidor. Endereços "unix:/caminho" usam um socket
+// Unix; os demais são endereços TCP como "127.0.0.1:7777".
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// removeStaleSocket remove o socket de uma execução anterior que não foi
+// encerrada. Um arquivo que não é socket, ou um socket que ainda aceita
+// conexões de outra instância, é mantido e retorna erro.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("erro ao verificar o socket %s: %w", path, err)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("%s já existe e não é um socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("o socket %s está em uso por outra instância", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("erro ao remover o socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// Serve atende as requisições em l até ctx ser cancelado.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shutdown server", "error", err)
+		}
+	}()
+	slog.Info("Server listening", "addr", l.Addr().String())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// errorStatus escolhe o status HTTP de um erro dos serviços.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, ErrPermissionNotFound), errors.Is(err, ErrAgentNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func readJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("corpo da requisição inválido: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.app.ListAgents())
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.app.ListSessions()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		title = defaultSessionTitle
+	}
+	sess, err := s.app.sessions.Create(r.Context(), title)
+	if err != nil {
+		writeError(w, errorStatus(err), fmt.Errorf("erro ao criar a sessão: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusCreated, newSessionInfo(sess))
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	detail, err := s.app.sessionDetail(r.PathValue("id"))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+func (s *Server) handleRenameSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Title string `json:"title"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(body.Title) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("o título não pode ser vazio"))
+		return
+	}
+	info, err := s.app.RenameSession(r.PathValue("id"), body.Title)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if err := s.app.DeleteSession(r.PathValue("id")); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSetSessionAgent(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Agent string `json:"agent"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, err := s.app.SetSessionAgent(r.PathValue("id"), body.Agent)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (s *Server) handleSessionUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.app.SessionUsage(r.PathValue("id"))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+func (s *Server) handleForkSession(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		MessageID string `json:"messageId"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	detail, err := s.app.ForkSession(r.PathValue("id"), body.MessageID)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, detail)
+}
+
+func (s *Server) handleEditMessage(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := s.app.EditMessage(r.PathValue("id"), r.PathValue("messageId"), body.Prompt)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
+
+func (s *Server) handleListCheckpoints(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := s.app.ListCheckpoints(r.PathValue("id"))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, checkpoints)
+}
+
+func (s *Server) handlePreviewCheckpoint(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.app.PreviewCheckpoint(r.PathValue("id"), r.PathValue("messageId"))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+func (s *Server) handleRestoreCheckpoint(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Overwrite bool `json:"overwrite"`
+	}
+	// O corpo é opcional.
+	if err := readJSON(r, &body); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, err := s.app.RestoreCheckpoint(r.PathValue("id"), r.PathValue("messageId"), body.Overwrite)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Prompt string `json:"prompt"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if strings.TrimSpace(body.Prompt) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("o prompt não pode ser vazio"))
+		return
+	}
+	sessionID := r.PathValue("id")
+	if sessionID == "new" {
+		sessionID = ""
+	} else if _, err := s.app.sessions.Get(r.Context(), sessionID); err != nil {
+		writeError(w, errorStatus(err), fmt.Errorf("erro ao obter a sessão %s: %w", sessionID, err))
+		return
+	}
+	queued := s.app.IsSessionBusy(sessionID)
+	sessionID, err := s.app.startPrompt(sessionID, body.Prompt)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	// A resposta chega pelo stream de /events.
+	writeJSON(w, http.StatusAccepted, map[string]any{"sessionId": sessionID, "queued": queued})
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	s.app.CancelPrompt(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePendingPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.app.PendingPermissions())
+}
+
+func (s *Server) handleAnswerPermission(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Action string `json:"action"`
+	}
+	if err := readJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id := r.PathValue("id")
+	var err error
+	switch body.Action {
+	case "grant":
+		err = s.app.GrantPermission(id)
+	case "grant_session":
+		err = s.app.GrantPermissionForSession(id)
+	case "deny":
+		err = s.app.DenyPermission(id)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("ação inválida %q: use grant, grant_session ou deny", body.Action))
+		return
+	}
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serverEvent é um evento aguardando para ser escrito no stream SSE.
+type serverEvent struct {
+	name string
+	data any
+}
+
+// handleEvents mantém um stream SSE com os eventos dos serviços. Cada cliente
+// tem as próprias assinaturas dos brokers, encerradas quando ele desconecta.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming não suportado"))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	var wg sync.WaitGroup
+	// As assinaturas são encerradas antes de aguardar os goroutines.
+	defer wg.Wait()
+	defer cancel()
+
+	events := make(chan serverEvent, serverEventBuffer)
+	s.app.subscribeEvents(ctx, &wg, func(name string, data any) {
+		select {
+		case events <- serverEvent{name: name, data: data}:
+		case <-ctx.Done():
+		}
+	})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(serverKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event.data)
+			if err != nil {
+				slog.Error("Failed to encode event", "event", event.name, "error", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/permission"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	a := newTestApp(t)
+	a.permissions = permission.NewPermissionService(t.TempDir(), false, nil)
+	srv, err := a.NewServer("secret")
+	require.NoError(t, err)
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts, srv.Token()
+}
+
+func TestServerAuth(t *testing.T) {
+	t.Parallel()
+	ts, token := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "wrong header token", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "wrong query token", query: "?token=wrong", want: http.StatusUnauthorized},
+		{name: "wrong header wins over query", query: "?token=" + token, header: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "header token", header: "Bearer " + token, want: http.StatusOK},
+		{name: "query token", query: "?token=" + token, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+"/sessions"+tt.query, nil)
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	t.Parallel()
+	ts, token := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/events")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+"/events?token="+token, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	require.Equal(t, ": connected", <-lines)
+
+	// The subscriptions start in the background, so keep creating sessions
+	// until one of them is streamed.
+	createSession := func() {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, ts.URL+"/sessions", strings.NewReader(`{"title": "from the editor"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	createSession()
+	timeout := time.After(5 * time.Second)
+	retry := time.NewTicker(50 * time.Millisecond)
+	defer retry.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			require.True(t, ok, "the stream ended")
+			if line != "event: "+EventSession {
+				continue
+			}
+			data := <-lines
+			require.True(t, strings.HasPrefix(data, "data: "))
+			require.Contains(t, data, `"from the editor"`)
+			return
+		case <-retry.C:
+			createSession()
+		case <-timeout:
+			t.Fatal("no session event streamed")
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets")
+	}
+	t.Parallel()
+	dir := t.TempDir()
+
+	// A regular file is never removed.
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0o644))
+	_, err := Listen("unix:" + file)
+	require.ErrorContains(t, err, "não é um socket")
+	_, err = os.Stat(file)
+	require.NoError(t, err)
+
+	// Nor is the socket of a running instance.
+	path := filepath.Join(dir, "s.sock")
+	l, err := Listen("unix:" + path)
+	require.NoError(t, err)
+	_, err = Listen("unix:" + path)
+	require.ErrorContains(t, err, "em uso por outra instância")
+
+	// The socket left by an instance that did not shut down is replaced.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+	l, err = Listen("unix:" + path)
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+// SessionInfo representa uma sessão para o navegador de sessões do frontend.
+type SessionInfo struct {
+	ID               string        `json:"id"`
+	ParentSessionID  string        `json:"parentSessionId"`
+	Title            string        `json:"title"`
+	MessageCount     int64         `json:"messageCount"`
+	PromptTokens     int64         `json:"promptTokens"`
+	CompletionTokens int64         `json:"completionTokens"`
+	Cost             float64       `json:"cost"`
+	CreatedAt        int64         `json:"createdAt"`
+	UpdatedAt        int64         `json:"updatedAt"`
+	Agent            string        `json:"agent"`      // ID do agente da sessão; vazio é o coder.
+	ForkedFrom       string        `json:"forkedFrom"` // Sessão da qual esta é uma cópia; vazio se não for.
+	Children         []SessionInfo `json:"children"`   // Sessões de tarefas criadas por sub-agentes.
+}
+
+// SessionDetail é retornado ao abrir uma sessão: os dados da sessão e o histórico de mensagens.
+type SessionDetail struct {
+	Session  SessionInfo   `json:"session"`
+	Messages []MessageInfo `json:"messages"`
+}
+
+// SessionEvent é o payload do evento EventSession.
+type SessionEvent struct {
+	Type    string      `json:"type"` // created, updated ou deleted
+	Session SessionInfo `json:"session"`
+}
+
+func newSessionInfo(s session.Session) SessionInfo {
+	return SessionInfo{
+		ID:               s.ID,
+		ParentSessionID:  s.ParentSessionID,
+		Title:            s.Title,
+		MessageCount:     s.MessageCount,
+		PromptTokens:     s.PromptTokens,
+		CompletionTokens: s.CompletionTokens,
+		Cost:             s.Cost,
+		CreatedAt:        s.CreatedAt,
+		UpdatedAt:        s.UpdatedAt,
+		Agent:            s.AgentID,
+		ForkedFrom:       s.ForkedFromSessionID,
+		Children:         []SessionInfo{},
+	}
+}
+
+// sessionTree monta a sessão com as sessões filhas agrupadas recursivamente.
+func (a *App) sessionTree(s session.Session) (SessionInfo, error) {
+	info := newSessionInfo(s)
+	children, err := a.sessions.ListChildren(a.ctx, s.ID)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao listar as sessões filhas de %s: %w", s.ID, err)
+	}
+	for _, child := range children {
+		childInfo, err := a.sessionTree(child)
+		if err != nil {
+			return SessionInfo{}, err
+		}
+		info.Children = append(info.Children, childInfo)
+	}
+	return info, nil
+}
+
+// ListSessions retorna as sessões principais, da mais recente para a mais antiga,
+// com as sessões de tarefas agrupadas em Children.
+func (a *App) ListSessions() ([]SessionInfo, error) {
+	sessions, err := a.sessions.List(a.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar as sessões: %w", err)
+	}
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		info, err := a.sessionTree(s)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// OpenSession carrega uma sessão e todas as suas mensagens e a torna a sessão atual da UI.
+func (a *App) OpenSession(id string) (SessionDetail, error) {
+	detail, err := a.sessionDetail(id)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	a.currentSession = id
+	return detail, nil
+}
+
+// sessionDetail carrega uma sessão, com as sessões filhas, e todas as suas mensagens.
+func (a *App) sessionDetail(id string) (SessionDetail, error) {
+	s, err := a.sessions.Get(a.ctx, id)
+	if err != nil {
+		return SessionDetail{}, fmt.Errorf("erro ao abrir a sessão %s: %w", id, err)
+	}
+	info, err := a.sessionTree(s)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	msgs, err := a.messages.List(a.ctx, id)
+	if err != nil {
+		return SessionDetail{}, fmt.Errorf("erro ao carregar as mensagens da sessão %s: %w", id, err)
+	}
+	detail := SessionDetail{
+		Session:  info,
+		Messages: make([]MessageInfo, 0, len(msgs)),
+	}
+	for _, msg := range msgs {
+		detail.Messages = append(detail.Messages, newMessageInfo(msg))
+	}
+	return detail, nil
+}
+
+// CreateSession cria uma nova sessão vazia e a torna a sessão atual da UI.
+// Um título vazio usa o título padrão.
+func (a *App) CreateSession(title string) (SessionInfo, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = defaultSessionTitle
+	}
+	s, err := a.sessions.Create(a.ctx, title)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao criar a sessão: %w", err)
+	}
+	a.currentSession = s.ID
+	return newSessionInfo(s), nil
+}
+
+// ForkSession copia a sessão até a mensagem messageID, incluindo os resultados
+// das ferramentas que a respondem, para uma nova sessão principal, e a torna a
+// sessão atual da UI. O resumo e o histórico de arquivos das mensagens
+// copiadas vão junto; a sessão original não muda, e remover uma das duas não
+// remove a outra.
+func (a *App) ForkSession(id, messageID string) (SessionDetail, error) {
+	s, err := a.sessions.Get(a.ctx, id)
+	if err != nil {
+		return SessionDetail{}, fmt.Errorf("erro ao obter a sessão %s: %w", id, err)
+	}
+	fork, err := a.sessions.Fork(a.ctx, id)
+	if err != nil {
+		return SessionDetail{}, fmt.Errorf("erro ao criar a cópia da sessão %s: %w", id, err)
+	}
+	if err := a.copySession(s, fork, messageID); err != nil {
+		if delErr := a.sessions.Delete(a.ctx, fork.ID); delErr != nil {
+			slog.Error("Failed to remove incomplete session fork", "session", fork.ID, "error", delErr)
+		}
+		return SessionDetail{}, err
+	}
+	detail, err := a.sessionDetail(fork.ID)
+	if err != nil {
+		return SessionDetail{}, err
+	}
+	a.currentSession = fork.ID
+	return detail, nil
+}
+
+// copySession copia as mensagens de s até messageID, o histórico de arquivos
+// e o resumo para a sessão fork.
+func (a *App) copySession(s, fork session.Session, messageID string) error {
+	ids, err := a.messages.Fork(a.ctx, s.ID, messageID, fork.ID)
+	if err != nil {
+		return fmt.Errorf("erro ao copiar as mensagens da sessão %s: %w", s.ID, err)
+	}
+	if err := a.files.Fork(a.ctx, s.ID, fork.ID, ids); err != nil {
+		return fmt.Errorf("erro ao copiar o histórico de arquivos da sessão %s: %w", s.ID, err)
+	}
+	if summaryID, ok := ids[s.SummaryMessageID]; ok && s.SummaryMessageID != "" {
+		fork, err = a.sessions.Get(a.ctx, fork.ID)
+		if err != nil {
+			return fmt.Errorf("erro ao obter a sessão %s: %w", fork.ID, err)
+		}
+		fork.SummaryMessageID = summaryID
+		if _, err := a.sessions.Save(a.ctx, fork); err != nil {
+			return fmt.Errorf("erro ao gravar o resumo da sessão %s: %w", fork.ID, err)
+		}
+	}
+	return nil
+}
+
+// RenameSession altera o título de uma sessão.
+func (a *App) RenameSession(id, title string) (SessionInfo, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return SessionInfo{}, fmt.Errorf("o título não pode ser vazio")
+	}
+	s, err := a.sessions.Get(a.ctx, id)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao obter a sessão %s: %w", id, err)
+	}
+	s.Title = title
+	s, err = a.sessions.Save(a.ctx, s)
+	if err != nil {
+		return SessionInfo{}, fmt.Errorf("erro ao renomear a sessão %s: %w", id, err)
+	}
+	return newSessionInfo(s), nil
+}
+
+// DeleteSession cancela qualquer requisição em andamento e remove a sessão
+// junto com suas sessões filhas. Mensagens e arquivos são removidos em cascata.
+func (a *App) DeleteSession(id string) error {
+	children, err := a.sessions.ListChildren(a.ctx, id)
+	if err != nil {
+		return fmt.Errorf("erro ao listar as sessões filhas de %s: %w", id, err)
+	}
+	for _, child := range children {
+		if err := a.DeleteSession(child.ID); err != nil {
+			return err
+		}
+	}
+	a.CancelPrompt(id)
+	if err := a.sessions.Delete(a.ctx, id); err != nil {
+		return fmt.Errorf("erro ao remover a sessão %s: %w", id, err)
+	}
+	if a.currentSession == id {
+		a.currentSession = ""
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/upperxcode/jx2ai-agent/api/internal/config"
+	"github.com/upperxcode/jx2ai-agent/api/internal/db"
+	"github.com/upperxcode/jx2ai-agent/api/internal/history"
+	"github.com/upperxcode/jx2ai-agent/api/internal/message"
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+// newTestApp returns an App with the services on a new database and no agent.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	ctx := t.Context()
+	conn, err := db.Connect(ctx, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+	return &App{
+		ctx:      ctx,
+		config:   &config.Config{},
+		files:    history.NewService(q, conn),
+		sessions: session.NewService(q),
+		messages: message.NewService(q, conn),
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	t.Parallel()
+	a := newTestApp(t)
+	ctx := t.Context()
+
+	original, err := a.sessions.Create(ctx, "original")
+	require.NoError(t, err)
+	prompt, err := a.messages.Create(ctx, original.ID, message.CreateMessageParams{
+		Role:  message.User,
+		Parts: []message.ContentPart{message.TextContent{Text: "hello"}},
+	})
+	require.NoError(t, err)
+	_, err = a.sessions.CreateTaskSession(ctx, "call", original.ID, "task")
+	require.NoError(t, err)
+
+	fork, err := a.ForkSession(original.ID, prompt.ID)
+	require.NoError(t, err)
+	require.Equal(t, original.ID, fork.Session.ForkedFrom)
+	require.Empty(t, fork.Session.ParentSessionID)
+	require.Len(t, fork.Messages, 1)
+
+	// The fork is listed on its own, and only the task session is a child.
+	sessions, err := a.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, s := range sessions {
+		if s.ID == original.ID {
+			require.Len(t, s.Children, 1)
+			require.Equal(t, "call", s.Children[0].ID)
+		} else {
+			require.Equal(t, fork.Session.ID, s.ID)
+			require.Empty(t, s.Children)
+		}
+	}
+
+	// Deleting the original keeps the fork.
+	require.NoError(t, a.DeleteSession(original.ID))
+	detail, err := a.OpenSession(fork.Session.ID)
+	require.NoError(t, err)
+	require.Len(t, detail.Messages, 1)
+	_, err = a.sessions.Get(ctx, "call")
+	require.Error(t, err)
+}
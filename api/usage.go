@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/upperxcode/jx2ai-agent/api/internal/session"
+)
+
+// UsageTotals soma os tokens e o custo de várias respostas do modelo.
+type UsageTotals struct {
+	Turns               int64   `json:"turns"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"` // Tokens gravados no cache do provedor.
+	CacheReadTokens     int64   `json:"cacheReadTokens"`     // Tokens lidos do cache do provedor.
+	TotalTokens         int64   `json:"totalTokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// TurnUsage é o uso de uma resposta do modelo, a mensagem MessageID.
+type TurnUsage struct {
+	SessionID           string  `json:"sessionId"` // Difere da sessão consultada nas respostas dos sub-agentes.
+	MessageID           string  `json:"messageId"`
+	Provider            string  `json:"provider"`
+	Model               string  `json:"model"`
+	InputTokens         int64   `json:"inputTokens"`
+	OutputTokens        int64   `json:"outputTokens"`
+	CacheCreationTokens int64   `json:"cacheCreationTokens"`
+	CacheReadTokens     int64   `json:"cacheReadTokens"`
+	TotalTokens         int64   `json:"totalTokens"`
+	Cost                float64 `json:"cost"`
+	CreatedAt           int64   `json:"createdAt"` // Unix, em segundos.
+}
+
+// ModelUsage é o uso de uma sessão com um modelo.
+type ModelUsage struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	UsageTotals
+}
+
+// SessionUsage é o uso de tokens e o custo de uma sessão, incluindo as
+// sessões de tarefas dos sub-agentes.
+type SessionUsage struct {
+	SessionID string       `json:"sessionId"`
+	Totals    UsageTotals  `json:"totals"`
+	Turns     []TurnUsage  `json:"turns"`   // Da resposta mais antiga para a mais recente.
+	ByModel   []ModelUsage `json:"byModel"` // Do modelo mais caro para o mais barato.
+}
+
+// SessionUsage retorna o uso de tokens e o custo da sessão: os totais, o uso
+// de cada resposta do modelo e os totais por modelo.
+func (a *App) SessionUsage(sessionID string) (SessionUsage, error) {
+	if _, err := a.sessions.Get(a.ctx, sessionID); err != nil {
+		return SessionUsage{}, fmt.Errorf("erro ao buscar a sessão %s: %w", sessionID, err)
+	}
+	totals, err := a.sessions.Usage(a.ctx, sessionID)
+	if err != nil {
+		return SessionUsage{}, fmt.Errorf("erro ao somar o uso da sessão: %w", err)
+	}
+	turns, err := a.sessions.ListUsage(a.ctx, sessionID)
+	if err != nil {
+		return SessionUsage{}, fmt.Errorf("erro ao listar o uso da sessão: %w", err)
+	}
+	byModel, err := a.sessions.UsageByModel(a.ctx, sessionID)
+	if err != nil {
+		return SessionUsage{}, fmt.Errorf("erro ao somar o uso por modelo: %w", err)
+	}
+
+	usage := SessionUsage{
+		SessionID: sessionID,
+		Totals:    newUsageTotals(totals),
+		Turns:     make([]TurnUsage, len(turns)),
+		ByModel:   make([]ModelUsage, len(byModel)),
+	}
+	for i, t := range turns {
+		usage.Turns[i] = TurnUsage{
+			SessionID:           t.SessionID,
+			MessageID:           t.MessageID,
+			Provider:            t.Provider,
+			Model:               t.Model,
+			InputTokens:         t.InputTokens,
+			OutputTokens:        t.OutputTokens,
+			CacheCreationTokens: t.CacheCreationTokens,
+			CacheReadTokens:     t.CacheReadTokens,
+			TotalTokens:         t.Tokens(),
+			Cost:                t.Cost,
+			CreatedAt:           t.CreatedAt,
+		}
+	}
+	for i, m := range byModel {
+		usage.ByModel[i] = ModelUsage{
+			Provider:    m.Provider,
+			Model:       m.Model,
+			UsageTotals: newUsageTotals(m.UsageTotals),
+		}
+	}
+	return usage, nil
+}
+
+func newUsageTotals(t session.UsageTotals) UsageTotals {
+	return UsageTotals{
+		Turns:               t.Turns,
+		InputTokens:         t.InputTokens,
+		OutputTokens:        t.OutputTokens,
+		CacheCreationTokens: t.CacheCreationTokens,
+		CacheReadTokens:     t.CacheReadTokens,
+		TotalTokens:         t.Tokens(),
+		Cost:                t.Cost,
+	}
+}
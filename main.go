@@ -3,7 +3,14 @@ package main
 import (
 	"context"
 	"embed"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/upperxcode/jx2ai-agent/api"
 
@@ -19,7 +26,31 @@ import (
 var assets embed.FS
 
 func main() {
+	prompt := flag.String("p", "", "executa o prompt sem interface gráfica e encerra; a entrada padrão, se houver, é anexada ao prompt")
+	format := flag.String("format", api.FormatText, "formato da saída do modo headless: text ou json")
+	permissions := flag.String("permissions", api.PermissionsDeny, "política de permissões do modo headless: deny (apenas permissions.allowed_tools) ou allow")
+	agentID := flag.String("agent", "", "agente do modo headless: coder (padrão) ou um dos agentes definidos em agents no crush.json")
+	serve := flag.String("serve", "", "inicia o servidor HTTP para editores sem interface gráfica, em host:porta ou unix:/caminho")
+	token := flag.String("token", os.Getenv("JXAI_SERVER_TOKEN"), "token exigido pelo servidor (padrão: $JXAI_SERVER_TOKEN ou um token aleatório)")
+	flag.Parse()
+
+	headless := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "p" {
+			headless = true
+		}
+	})
+	if headless {
+		os.Exit(runHeadless(*prompt, *format, *permissions, *agentID))
+	}
+	if *serve != "" {
+		os.Exit(runServer(*serve, *token))
+	}
+
 	// Inicializa a configuração da aplicação
+	if _, err := api.Config(); err != nil {
+		log.Fatalf("Erro ao carregar a configuração: %v", err)
+	}
 
 	// Create an instance of the app structure
 	app, err := api.NewAppWithServices(context.Background())
@@ -45,6 +76,7 @@ func main() {
 
 		LogLevel:         logger.DEBUG,
 		OnStartup:        app.Startup,
+		OnShutdown:       app.Shutdown,
 		BackgroundColour: &options.RGBA{R: 0, G: 0, B: 0, A: 0}, // Transparente
 
 		Menu:   nil,
@@ -52,7 +84,6 @@ func main() {
 		//OnStartup:         app.Startup,
 		//OnDomReady:        app.DomReady,
 		//OnBeforeClose:     app.BeforeClose,
-		//OnShutdown:        app.Shutdown,
 		WindowStartState: options.Normal,
 		Bind: []any{
 			app,
@@ -91,3 +122,98 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runHeadless executa o agente sem abrir a janela, para uso em scripts e CI, e
+// retorna o código de saída do processo.
+func runHeadless(prompt, format, permissions, agentID string) int {
+	input, err := readStdin()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao ler a entrada padrão: %v\n", err)
+		return api.ExitError
+	}
+	if input != "" {
+		prompt = strings.TrimSpace(prompt + "\n\n" + input)
+	}
+	opts := api.HeadlessOptions{
+		Prompt:      prompt,
+		Format:      format,
+		Permissions: permissions,
+		Agent:       agentID,
+		Output:      os.Stdout,
+	}
+	if err := api.ValidateHeadlessOptions(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro: %v\n", err)
+		flag.Usage()
+		return api.ExitUsage
+	}
+
+	if _, err := api.Config(); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao carregar a configuração: %v\n", err)
+		return api.ExitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := api.NewAppWithServices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao inicializar a aplicação: %v\n", err)
+		return api.ExitError
+	}
+	defer app.Shutdown(context.Background())
+
+	code, err := app.RunHeadless(ctx, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro: %v\n", err)
+	}
+	return code
+}
+
+// runServer expõe o agente por HTTP até o processo receber SIGINT ou SIGTERM.
+func runServer(addr, token string) int {
+	if _, err := api.Config(); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao carregar a configuração: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app, err := api.NewAppWithServices(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao inicializar a aplicação: %v\n", err)
+		return 1
+	}
+	defer app.Shutdown(context.Background())
+
+	server, err := app.NewServer(token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro: %v\n", err)
+		return 1
+	}
+	listener, err := api.Listen(addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erro ao abrir %s: %v\n", addr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Servidor escutando em %s\nToken: %s\n", listener.Addr(), server.Token())
+	if err := server.Serve(ctx, listener); err != nil {
+		fmt.Fprintf(os.Stderr, "Erro no servidor: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readStdin lê a entrada padrão quando ela vem de um pipe ou arquivo. Em um
+// terminal não há o que ler e a execução não deve ficar esperando.
+func readStdin() (string, error) {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+		return "", nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}